@@ -4,6 +4,7 @@ import (
 	"context"
 	"github.com/langowen/exchange/deploy/config"
 	fetcherApp "github.com/langowen/exchange/internal/api_service/app"
+	"log"
 	"log/slog"
 	"os"
 	"os/signal"
@@ -11,11 +12,23 @@ import (
 )
 
 func main() {
-	cfg := config.NewConfig()
+	flags := config.ParseFlags(&config.ApiConfig{})
+
+	cfg, err := config.LoadApiConfig(flags.Path)
+	if err != nil {
+		log.Fatalf("Error reading config: %v", err)
+	}
+
+	if flags.PrintConfig {
+		if err = config.Print(os.Stdout, cfg); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 
-	app := fetcherApp.NewFetcherApp(cfg)
+	app := fetcherApp.NewFetcherApp(cfg, flags.Path)
 	serverDone := app.Start(ctx)
 
 	done := make(chan os.Signal, 1)
@@ -4,6 +4,7 @@ import (
 	"context"
 	"github.com/langowen/exchange/deploy/config"
 	"github.com/langowen/exchange/internal/currency_fetcher/app"
+	"log"
 	"log/slog"
 	"os"
 	"os/signal"
@@ -13,9 +14,21 @@ import (
 func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 
-	cfg := config.NewConfig()
+	flags := config.ParseFlags(&config.FetcherConfig{})
 
-	app := apiApp.NewApiApp(cfg)
+	cfg, err := config.LoadFetcherConfig(flags.Path)
+	if err != nil {
+		log.Fatalf("Error reading config: %v", err)
+	}
+
+	if flags.PrintConfig {
+		if err = config.Print(os.Stdout, cfg); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	app := apiApp.NewApiApp(cfg, flags.Path)
 
 	go func() {
 		done := make(chan os.Signal, 1)
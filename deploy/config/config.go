@@ -1,57 +1,339 @@
 package config
 
 import (
+	"fmt"
 	"github.com/ilyakaznacheev/cleanenv"
 	"github.com/joho/godotenv"
-	"log"
+	"net/netip"
+	"net/url"
+	"os"
+	"strings"
 	"time"
 )
 
-type Config struct {
-	Storage    Storage
-	HTTPServer HTTPServer
-	Fetcher    Fetcher
-	Redis      Redis
+// ApiConfig is the config of the api_service binary.
+type ApiConfig struct {
+	Storage      Storage      `yaml:"storage"`
+	HTTPServer   HTTPServer   `yaml:"http_server"`
+	Redis        Redis        `yaml:"redis"`
+	Tracing      Tracing      `yaml:"tracing"`
+	Freshness    Freshness    `yaml:"freshness"`
+	Auth         Auth         `yaml:"auth"`
+	Registration Registration `yaml:"registration"`
+	Events       Events       `yaml:"events"`
+	Shutdown     Shutdown     `yaml:"shutdown"`
+	Log          Log          `yaml:"log"`
+}
+
+// FetcherConfig is the config of the currency_fetcher binary.
+type FetcherConfig struct {
+	Storage    Storage    `yaml:"storage"`
+	Fetcher    Fetcher    `yaml:"fetcher"`
+	Monitoring Monitoring `yaml:"monitoring"`
+	Redis      Redis      `yaml:"redis"`
+	Events     Events     `yaml:"events"`
+	Outbox     Outbox     `yaml:"outbox"`
+	Webhooks   Webhooks   `yaml:"webhooks"`
+	Alerts     Alerts     `yaml:"alerts"`
+	Tracing    Tracing    `yaml:"tracing"`
+	Shutdown   Shutdown   `yaml:"shutdown"`
+	Log        Log        `yaml:"log"`
 }
 
 type Storage struct {
-	Timeout  time.Duration `env:"BD_TIMEOUT" env-default:"10s"`
-	Host     string        `env:"BD_HOST" env-required:"true"`
-	Port     int           `env:"BD_PORT" env-required:"true"`
-	User     string        `env:"BD_USER" env-required:"true"`
-	Password string        `env:"BD_PASSWORD" env-required:"true"`
-	DBName   string        `env:"BD_DBNAME" env-required:"true"`
-	SSLMode  string        `env:"BD_SSL_MODE" env-default:"disable"`
-	Schema   string        `env:"BD_SCHEMA" env-default:"dev"`
+	URL      Secret        `yaml:"url" env:"DATABASE_URL" env-description:"Postgres DSN, used instead of the individual connection fields when set, or read from DATABASE_URL_FILE"`
+	Timeout  time.Duration `yaml:"timeout" env:"BD_TIMEOUT" env-default:"10s" env-description:"Postgres connect and ping timeout"`
+	Host     string        `yaml:"host" env:"BD_HOST" env-description:"Postgres host"`
+	Port     int           `yaml:"port" env:"BD_PORT" env-default:"5432" env-description:"Postgres port"`
+	User     string        `yaml:"user" env:"BD_USER" env-description:"Postgres user"`
+	Password Secret        `yaml:"password" env:"BD_PASSWORD" env-description:"Postgres password, or read from BD_PASSWORD_FILE"`
+	DBName   string        `yaml:"db_name" env:"BD_DBNAME" env-description:"Postgres database name"`
+	SSLMode  string        `yaml:"ssl_mode" env:"BD_SSL_MODE" env-default:"disable" env-description:"Postgres sslmode, set it in the URL instead when storage.url is used"`
+	Schema   string        `yaml:"schema" env:"BD_SCHEMA" env-default:"dev" env-description:"Postgres search_path, also added to storage.url unless it sets one"`
+	MaxConns int32         `yaml:"max_conns" env:"BD_MAX_CONNS" env-default:"25" env-description:"Maximum size of the connection pool"`
+	MinConns int32         `yaml:"min_conns" env:"BD_MIN_CONNS" env-default:"5" env-description:"Connections kept open when idle"`
+
+	SSLRootCert string `yaml:"ssl_root_cert" env:"BD_SSL_ROOT_CERT" env-description:"CA certificate used to verify the Postgres server"`
+	SSLCert     string `yaml:"ssl_cert" env:"BD_SSL_CERT" env-description:"Client certificate presented to Postgres"`
+	SSLKey      string `yaml:"ssl_key" env:"BD_SSL_KEY" env-description:"Private key of the Postgres client certificate"`
+}
+
+// DSN returns DATABASE_URL when set, with Schema as its search_path unless
+// the URL sets one, and builds a key/value DSN from the individual fields
+// otherwise.
+func (s Storage) DSN() string {
+	if s.URL != "" {
+		return withSearchPath(s.URL.Value(), s.Schema)
+	}
+
+	dsn := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s search_path=%s",
+		quoteDSN(s.Host), s.Port, quoteDSN(s.User), quoteDSN(s.Password.Value()), quoteDSN(s.DBName), quoteDSN(s.SSLMode), quoteDSN(s.Schema))
+
+	for _, param := range [][2]string{{"sslrootcert", s.SSLRootCert}, {"sslcert", s.SSLCert}, {"sslkey", s.SSLKey}} {
+		if param[1] != "" {
+			dsn += " " + param[0] + "=" + quoteDSN(param[1])
+		}
+	}
+
+	return dsn
+}
+
+// withSearchPath adds search_path to a URL or key/value DSN.
+func withSearchPath(dsn, schema string) string {
+	if schema == "" || strings.Contains(dsn, "search_path") {
+		return dsn
+	}
+
+	if u, err := url.Parse(dsn); err == nil && (u.Scheme == "postgres" || u.Scheme == "postgresql") {
+		q := u.Query()
+		q.Set("search_path", schema)
+		u.RawQuery = q.Encode()
+
+		return u.String()
+	}
+
+	return dsn + " search_path=" + quoteDSN(schema)
+}
+
+func quoteDSN(value string) string {
+	if value != "" && !strings.ContainsAny(value, ` '\`) {
+		return value
+	}
+
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
 }
 
 type HTTPServer struct {
-	Port        string        `env:"HTTP_PORT" env-default:"8082"`
-	Timeout     time.Duration `env:"HTTP_TIMEOUT" env-default:"2m"`
-	IdleTimeout time.Duration `env:"HTTP_IDLE_TIMEOUT" env-default:"60s"`
+	Port        string        `yaml:"port" env:"HTTP_PORT" env-default:"8082" env-description:"Public API port"`
+	Timeout     time.Duration `yaml:"timeout" env:"HTTP_TIMEOUT" env-default:"2m" env-description:"Read and write timeout of the public API"`
+	IdleTimeout time.Duration `yaml:"idle_timeout" env:"HTTP_IDLE_TIMEOUT" env-default:"60s" env-description:"Keep-alive idle timeout of the public API"`
+	TLS         ServerTLS     `yaml:"tls"`
+
+	TrustedProxies []string `yaml:"trusted_proxies" env:"HTTP_TRUSTED_PROXIES" env-separator:"," env-description:"Addresses or CIDRs of the proxies whose X-Forwarded-For and X-Real-IP headers are honoured"`
+}
+
+// TrustedProxyPrefixes parses TrustedProxies. A bare address is a single-host
+// prefix.
+func (h HTTPServer) TrustedProxyPrefixes() ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(h.TrustedProxies))
+	for _, value := range h.TrustedProxies {
+		value = strings.TrimSpace(value)
+
+		if addr, err := netip.ParseAddr(value); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q", value)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+
+	return prefixes, nil
+}
+
+// ServerTLS enables HTTPS when CertFile is set. ClientAuth is none, optional
+// (verify a client certificate if one is presented) or require.
+type ServerTLS struct {
+	CertFile     string `yaml:"cert_file" env:"HTTP_TLS_CERT" env-description:"Server certificate, enables HTTPS"`
+	KeyFile      string `yaml:"key_file" env:"HTTP_TLS_KEY" env-description:"Private key of the server certificate"`
+	ClientCAFile string `yaml:"client_ca_file" env:"HTTP_TLS_CLIENT_CA" env-description:"CA certificate used to verify client certificates"`
+	ClientAuth   string `yaml:"client_auth" env:"HTTP_TLS_CLIENT_AUTH" env-default:"none" env-description:"Client certificate verification: none, optional or require"`
+}
+
+type Monitoring struct {
+	Port        string        `yaml:"port" env:"FETCHER_HTTP_PORT" env-default:"8083" env-description:"Port of the fetcher metrics and health endpoints"`
+	Timeout     time.Duration `yaml:"timeout" env:"FETCHER_HTTP_TIMEOUT" env-default:"2m" env-description:"Read and write timeout of the monitoring server"`
+	IdleTimeout time.Duration `yaml:"idle_timeout" env:"FETCHER_HTTP_IDLE_TIMEOUT" env-default:"60s" env-description:"Keep-alive idle timeout of the monitoring server"`
 }
 
 type Fetcher struct {
-	URL         string        `env:"FETCHER_URL" env-default:"https://min-api.cryptocompare.com/data/pricemulti"`
-	Timeout     time.Duration `env:"FETCHER_TIMEOUT" env-default:"10s"`
-	TimeTickers time.Duration `env:"FETCHER_TIME_TICKERS" env-default:"10s"`
+	URL               string        `yaml:"url" env:"FETCHER_URL" env-default:"https://min-api.cryptocompare.com/data/pricemulti" env-description:"Provider endpoint"`
+	Timeout           time.Duration `yaml:"timeout" env:"FETCHER_TIMEOUT" env-default:"10s" env-description:"Timeout of a single provider request"`
+	MaxFetchAge       time.Duration `yaml:"max_fetch_age" env:"FETCHER_MAX_FETCH_AGE" env-default:"1m" env-description:"Age of the last successful fetch after which the fetcher is not ready"`
+	TimeTickers       time.Duration `yaml:"time_tickers" env:"FETCHER_TIME_TICKERS" env-default:"10s" env-description:"Default refresh interval of a cryptocurrency"`
+	ScheduleTick      time.Duration `yaml:"schedule_tick" env:"FETCHER_SCHEDULE_TICK" env-default:"1s" env-description:"How often due cryptocurrencies are looked up"`
+	ScheduleRefresh   time.Duration `yaml:"schedule_refresh" env:"FETCHER_SCHEDULE_REFRESH" env-default:"30s" env-description:"How often tracked cryptocurrencies and their refresh intervals are reloaded"`
+	LeaderLockID      int64         `yaml:"leader_lock_id" env:"FETCHER_LEADER_LOCK_ID" env-default:"7263001" env-description:"Postgres advisory lock used for leader election"`
+	LeaderRetry       time.Duration `yaml:"leader_retry" env:"FETCHER_LEADER_RETRY" env-default:"2s" env-description:"How often followers try to become the leader"`
+	Provider          string        `yaml:"provider" env:"FETCHER_PROVIDER" env-default:"cryptocompare" env-description:"Provider name used in metrics and quotas, only changed by a restart"`
+	RequestsPerMinute int           `yaml:"requests_per_minute" env:"FETCHER_REQUESTS_PER_MINUTE" env-default:"30" env-description:"Provider requests per minute, 0 for unlimited"`
+	RequestsPerMonth  int           `yaml:"requests_per_month" env:"FETCHER_REQUESTS_PER_MONTH" env-default:"100000" env-description:"Provider requests per month, 0 for unlimited"`
+	MaxURLLength      int           `yaml:"max_url_length" env:"FETCHER_MAX_URL_LENGTH" env-default:"2000" env-description:"Longest provider URL before requests are split, 0 for no limit"`
+	Retries           int           `yaml:"retries" env:"FETCHER_RETRIES" env-default:"3" env-description:"Retries of a failed provider request"`
+	RetryBaseDelay    time.Duration `yaml:"retry_base_delay" env:"FETCHER_RETRY_BASE_DELAY" env-default:"200ms" env-description:"First retry delay, doubled on every attempt"`
+	RetryMaxDelay     time.Duration `yaml:"retry_max_delay" env:"FETCHER_RETRY_MAX_DELAY" env-default:"5s" env-description:"Upper bound of the retry delay"`
+	BreakerThreshold  int           `yaml:"breaker_threshold" env:"FETCHER_BREAKER_THRESHOLD" env-default:"5" env-description:"Consecutive failures that open the circuit breaker, 0 to disable it"`
+	BreakerCooldown   time.Duration `yaml:"breaker_cooldown" env:"FETCHER_BREAKER_COOLDOWN" env-default:"30s" env-description:"How long the circuit breaker stays open"`
 }
 
 type Redis struct {
-	Host     string `yaml:"host" env:"REDIS_HOST" env-required:"true"`
-	Password string `yaml:"password" env:"REDIS_PASSWORD" env-default:""`
-	DB       int    `yaml:"db" env:"REDIS_DB" env-default:"5"`
+	Mode             string    `yaml:"mode" env:"REDIS_MODE" env-default:"single" env-description:"Redis deployment: single, sentinel or cluster"`
+	Host             string    `yaml:"host" env:"REDIS_HOST" env-description:"Redis address in single mode, optional with the nats event bus"`
+	Addrs            []string  `yaml:"addrs" env:"REDIS_ADDRS" env-separator:"," env-description:"Sentinel or cluster node addresses"`
+	MasterName       string    `yaml:"master_name" env:"REDIS_MASTER_NAME" env-description:"Name of the master monitored by Sentinel"`
+	SentinelPassword Secret    `yaml:"sentinel_password" env:"REDIS_SENTINEL_PASSWORD" env-description:"Sentinel password, or read from REDIS_SENTINEL_PASSWORD_FILE"`
+	Password         Secret    `yaml:"password" env:"REDIS_PASSWORD" env-default:"" env-description:"Redis password, or read from REDIS_PASSWORD_FILE"`
+	DB               int       `yaml:"db" env:"REDIS_DB" env-default:"-1" env-description:"Redis database, -1 for 5 in single and sentinel mode and 0 in cluster mode"`
+	TLS              ClientTLS `yaml:"tls"`
+}
+
+// Configured reports whether a Redis address is set. Only the redis event
+// bus requires Redis.
+func (r Redis) Configured() bool {
+	return r.Host != "" || len(r.Addrs) > 0
+}
+
+// Database returns DB, or the default of the mode when DB is negative: 0 in
+// cluster mode, which has no other databases, and 5 otherwise.
+func (r Redis) Database() int {
+	if r.DB >= 0 {
+		return r.DB
+	}
+	if r.Mode == "cluster" {
+		return 0
+	}
+
+	return 5
 }
 
-func NewConfig() *Config {
-	cfg := &Config{}
+type ClientTLS struct {
+	Enabled    bool   `yaml:"enabled" env:"REDIS_TLS" env-default:"false" env-description:"Connect to Redis over TLS"`
+	CAFile     string `yaml:"ca_file" env:"REDIS_TLS_CA" env-description:"CA certificate used to verify Redis, the system pool when empty"`
+	CertFile   string `yaml:"cert_file" env:"REDIS_TLS_CERT" env-description:"Client certificate presented to Redis"`
+	KeyFile    string `yaml:"key_file" env:"REDIS_TLS_KEY" env-description:"Private key of the Redis client certificate"`
+	ServerName string `yaml:"server_name" env:"REDIS_TLS_SERVER_NAME" env-description:"Expected Redis server name, the host of each node when empty"`
+}
 
+type Freshness struct {
+	MaxAge time.Duration `yaml:"max_age" env:"RATES_MAX_AGE" env-default:"5m" env-description:"Default age after which a rate is stale"`
+}
+
+// Auth configures API keys. Enabled only covers the read-only /rates routes:
+// webhooks and alert rules belong to a key and admin routes need an admin key,
+// so those require one whatever Enabled says.
+type Auth struct {
+	Enabled           bool   `yaml:"enabled" env:"AUTH_ENABLED" env-default:"false" env-description:"Require an API key on the read-only /rates routes; webhook, alert and admin routes always require one"`
+	DefaultRateLimit  int    `yaml:"default_rate_limit" env:"AUTH_DEFAULT_RATE_LIMIT" env-default:"60" env-description:"Requests per minute of keys without their own limit"`
+	BootstrapAdminKey Secret `yaml:"bootstrap_admin_key" env:"AUTH_BOOTSTRAP_ADMIN_KEY" env-default:"" env-description:"Admin API key registered on startup, or read from AUTH_BOOTSTRAP_ADMIN_KEY_FILE"`
+}
+
+type Registration struct {
+	Policy      string        `yaml:"policy" env:"REGISTRATION_POLICY" env-default:"open" env-description:"Auto-registration policy: open, allowlist, pattern or disabled"`
+	Allowlist   []string      `yaml:"allowlist" env:"REGISTRATION_ALLOWLIST" env-separator:"," env-description:"Codes allowed by the allowlist policy"`
+	Denylist    []string      `yaml:"denylist" env:"REGISTRATION_DENYLIST" env-separator:"," env-description:"Codes never registered"`
+	Pattern     string        `yaml:"pattern" env:"REGISTRATION_PATTERN" env-default:"^[A-Z0-9]{2,5}$" env-description:"Codes allowed by the pattern policy"`
+	MaxTracked  int           `yaml:"max_tracked" env:"REGISTRATION_MAX_TRACKED" env-default:"100" env-description:"Maximum number of tracked cryptocurrencies, 0 for unlimited"`
+	ClientQuota int           `yaml:"client_quota" env:"REGISTRATION_CLIENT_QUOTA" env-default:"10" env-description:"Registrations per client and window, 0 for unlimited"`
+	QuotaWindow time.Duration `yaml:"quota_window" env:"REGISTRATION_QUOTA_WINDOW" env-default:"24h" env-description:"Window of the per-client registration quota"`
+	Wait        time.Duration `yaml:"wait" env:"REGISTRATION_WAIT" env-default:"3s" env-description:"How long a request waits for the first rate of a new cryptocurrency"`
+}
+
+type Tracing struct {
+	Exporter     string  `yaml:"exporter" env:"TRACING_EXPORTER" env-default:"none" env-description:"Trace exporter: none, stdout or otlp"`
+	OTLPEndpoint string  `yaml:"otlp_endpoint" env:"TRACING_OTLP_ENDPOINT" env-default:"localhost:4318" env-description:"OTLP/HTTP collector address"`
+	OTLPInsecure bool    `yaml:"otlp_insecure" env:"TRACING_OTLP_INSECURE" env-default:"true" env-description:"Talk to the OTLP collector without TLS"`
+	SampleRatio  float64 `yaml:"sample_ratio" env:"TRACING_SAMPLE_RATIO" env-default:"1" env-description:"Share of root traces sampled"`
+}
+
+type Events struct {
+	Backend       string        `yaml:"backend" env:"EVENTS_BACKEND" env-default:"redis" env-description:"Event bus backend: redis or nats"`
+	Consumer      string        `yaml:"consumer" env:"EVENTS_CONSUMER" env-description:"Name of this instance in consumer groups, the hostname when empty"`
+	MaxLen        int64         `yaml:"max_len" env:"EVENTS_MAX_LEN" env-default:"10000" env-description:"Approximate number of events kept per Redis stream, or in the NATS stream"`
+	ClaimIdle     time.Duration `yaml:"claim_idle" env:"EVENTS_CLAIM_IDLE" env-default:"30s" env-description:"Time after which unacknowledged events are delivered again"`
+	MaxDeliveries int           `yaml:"max_deliveries" env:"EVENTS_MAX_DELIVERIES" env-default:"10" env-description:"Deliveries of a failing event to a group before it moves to the <topic>.dead topic, 0 for unlimited"`
+	NATS          NATS          `yaml:"nats"`
+}
+
+type NATS struct {
+	URL           string `yaml:"url" env:"EVENTS_NATS_URL" env-default:"nats://localhost:4222" env-description:"NATS server URLs, comma separated"`
+	Token         Secret `yaml:"token" env:"EVENTS_NATS_TOKEN" env-description:"NATS authentication token, or read from EVENTS_NATS_TOKEN_FILE"`
+	Stream        string `yaml:"stream" env:"EVENTS_NATS_STREAM" env-default:"EXCHANGE" env-description:"JetStream stream holding all events"`
+	SubjectPrefix string `yaml:"subject_prefix" env:"EVENTS_NATS_SUBJECT_PREFIX" env-default:"exchange" env-description:"Prefix of the event subjects"`
+}
+
+// ConsumerName returns Consumer, falling back to the hostname.
+func (e Events) ConsumerName() string {
+	if e.Consumer != "" {
+		return e.Consumer
+	}
+
+	if hostname, err := os.Hostname(); err == nil {
+		return hostname
+	}
+
+	return "default"
+}
+
+type Outbox struct {
+	Interval  time.Duration `yaml:"interval" env:"OUTBOX_INTERVAL" env-default:"1s" env-description:"How often pending outbox events are polled when no local write signals them"`
+	BatchSize int           `yaml:"batch_size" env:"OUTBOX_BATCH_SIZE" env-default:"100" env-description:"Outbox events relayed per transaction"`
+	Retention time.Duration `yaml:"retention" env:"OUTBOX_RETENTION" env-default:"24h" env-description:"How long published outbox events are kept"`
+}
+
+type Webhooks struct {
+	Interval       time.Duration `yaml:"interval" env:"WEBHOOK_INTERVAL" env-default:"1s" env-description:"How often due webhook deliveries are polled"`
+	BatchSize      int           `yaml:"batch_size" env:"WEBHOOK_BATCH_SIZE" env-default:"20" env-description:"Webhook deliveries claimed per poll"`
+	Timeout        time.Duration `yaml:"timeout" env:"WEBHOOK_TIMEOUT" env-default:"10s" env-description:"Timeout of a webhook request"`
+	MaxAttempts    int           `yaml:"max_attempts" env:"WEBHOOK_MAX_ATTEMPTS" env-default:"8" env-description:"Attempts before a webhook delivery goes to the dead letters"`
+	RetryBaseDelay time.Duration `yaml:"retry_base_delay" env:"WEBHOOK_RETRY_BASE_DELAY" env-default:"10s" env-description:"Delay before the first webhook retry, doubled on each further one"`
+	RetryMaxDelay  time.Duration `yaml:"retry_max_delay" env:"WEBHOOK_RETRY_MAX_DELAY" env-default:"1h" env-description:"Upper bound of the delay between webhook retries"`
+}
+
+type Alerts struct {
+	Refresh time.Duration `yaml:"refresh" env:"ALERT_REFRESH" env-default:"30s" env-description:"How often alert rules are reloaded from Postgres"`
+}
+
+type Shutdown struct {
+	Timeout time.Duration `yaml:"timeout" env:"SHUTDOWN_TIMEOUT" env-default:"5s" env-description:"Time given to servers and exporters to finish on shutdown"`
+}
+
+type Log struct {
+	Level string `yaml:"level" env:"LOG_LEVEL" env-default:"debug" env-description:"Log level: debug, info, warn or error"`
+}
+
+type validatable interface {
+	Validate() error
+}
+
+// load reads the file at path, if any, and the environment, which takes
+// precedence over the file, and validates the result.
+func load(path string, cfg validatable) error {
 	_ = godotenv.Load(".env")
 
-	err := cleanenv.ReadEnv(cfg)
+	var err error
+	if path != "" {
+		err = cleanenv.ReadConfig(path, cfg)
+	} else {
+		err = cleanenv.ReadEnv(cfg)
+	}
 	if err != nil {
-		log.Fatal("Error reading env")
+		return err
+	}
+
+	if err = readSecretFiles(cfg); err != nil {
+		return err
+	}
+
+	return cfg.Validate()
+}
+
+func LoadApiConfig(path string) (*ApiConfig, error) {
+	cfg := &ApiConfig{}
+	if err := load(path, cfg); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+func LoadFetcherConfig(path string) (*FetcherConfig, error) {
+	cfg := &FetcherConfig{}
+	if err := load(path, cfg); err != nil {
+		return nil, err
 	}
 
-	return cfg
+	return cfg, nil
 }
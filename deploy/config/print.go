@@ -0,0 +1,39 @@
+package config
+
+import (
+	"flag"
+	"github.com/ilyakaznacheev/cleanenv"
+	"gopkg.in/yaml.v3"
+	"io"
+	"os"
+)
+
+// Flags are the command line flags shared by both binaries.
+type Flags struct {
+	Path        string
+	PrintConfig bool
+}
+
+// ParseFlags parses the command line. cfg is only used to list the supported
+// environment variables in -help.
+func ParseFlags(cfg any) Flags {
+	var flags Flags
+
+	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	fs.StringVar(&flags.Path, "config", os.Getenv("CONFIG_PATH"), "path to a YAML or TOML config file, defaults to $CONFIG_PATH")
+	fs.BoolVar(&flags.PrintConfig, "print-config", false, "print the effective config with secrets redacted and exit")
+	fs.Usage = cleanenv.FUsage(fs.Output(), cfg, nil, fs.PrintDefaults)
+
+	_ = fs.Parse(os.Args[1:])
+
+	return flags
+}
+
+// Print writes cfg as YAML. Secrets are redacted by their own type.
+func Print(w io.Writer, cfg any) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	defer enc.Close()
+
+	return enc.Encode(cfg)
+}
@@ -0,0 +1,110 @@
+package config
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// Reloader re-reads the config on SIGHUP and hands the result to subscribers.
+// Only fields that are safe to change at runtime are taken from the new
+// config; everything else keeps its startup value until the next restart.
+type Reloader[T any, P reloadable[T]] struct {
+	path string
+
+	mu          sync.Mutex
+	current     P
+	subscribers []func(P)
+}
+
+type reloadable[T any] interface {
+	*T
+	validatable
+	applySafe(src *T)
+}
+
+func NewReloader[T any, P reloadable[T]](path string, cfg P) *Reloader[T, P] {
+	return &Reloader[T, P]{
+		path:    path,
+		current: cfg,
+	}
+}
+
+func (r *Reloader[T, P]) Subscribe(fn func(P)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.subscribers = append(r.subscribers, fn)
+}
+
+// Watch reloads the config on every SIGHUP until ctx is done. Reloading
+// needs a config file: the process environment cannot change at runtime, so
+// without one SIGHUP is only logged and ignored.
+func (r *Reloader[T, P]) Watch(ctx context.Context) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	go func() {
+		defer signal.Stop(signals)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-signals:
+				if r.path == "" {
+					slog.Warn("Config reload needs a config file, ignoring SIGHUP")
+					continue
+				}
+				if err := r.Reload(); err != nil {
+					slog.Error("Failed to reload config, keeping the current one", "error", err)
+					continue
+				}
+				slog.Info("Config reloaded")
+			}
+		}
+	}()
+}
+
+func (r *Reloader[T, P]) Reload() error {
+	var loaded T
+	if err := load(r.path, P(&loaded)); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	next := P(new(T))
+	*next = *r.current
+	next.applySafe(&loaded)
+	r.current = next
+
+	for _, fn := range r.subscribers {
+		fn(next)
+	}
+
+	return nil
+}
+
+// applySafe copies the hot-reloadable fields from src.
+func (c *ApiConfig) applySafe(src *ApiConfig) {
+	c.Log.Level = src.Log.Level
+	c.Freshness = src.Freshness
+	c.Auth.DefaultRateLimit = src.Auth.DefaultRateLimit
+	c.Registration = src.Registration
+}
+
+func (c *FetcherConfig) applySafe(src *FetcherConfig) {
+	c.Log.Level = src.Log.Level
+
+	c.Fetcher.URL = src.Fetcher.URL
+	c.Fetcher.TimeTickers = src.Fetcher.TimeTickers
+	c.Fetcher.MaxFetchAge = src.Fetcher.MaxFetchAge
+	c.Fetcher.MaxURLLength = src.Fetcher.MaxURLLength
+	c.Fetcher.RequestsPerMinute = src.Fetcher.RequestsPerMinute
+	c.Fetcher.RequestsPerMonth = src.Fetcher.RequestsPerMonth
+}
@@ -0,0 +1,98 @@
+package config
+
+import (
+	"encoding/json"
+	"github.com/pkg/errors"
+	"log/slog"
+	"os"
+	"reflect"
+	"strings"
+)
+
+const redacted = "[REDACTED]"
+
+// Secret is a config value that never shows up in logs, JSON or printed
+// configs. Use Value to get the actual secret.
+type Secret string
+
+func (s Secret) Value() string {
+	return string(s)
+}
+
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+
+	return redacted
+}
+
+func (s Secret) GoString() string {
+	return s.String()
+}
+
+func (s Secret) LogValue() slog.Value {
+	return slog.StringValue(s.String())
+}
+
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+func (s Secret) MarshalYAML() (any, error) {
+	return s.String(), nil
+}
+
+func (s Secret) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+var secretType = reflect.TypeOf(Secret(""))
+
+// readSecretFiles fills every Secret field whose env variable has a *_FILE
+// variant set, e.g. BD_PASSWORD_FILE, with the content of that file. Trailing
+// newlines are dropped, as most tools write them when mounting secrets.
+func readSecretFiles(cfg any) error {
+	const op = "config.readSecretFiles"
+
+	return walkSecrets(reflect.ValueOf(cfg).Elem(), func(field reflect.Value, env string) error {
+		path := os.Getenv(env + "_FILE")
+		if path == "" {
+			return nil
+		}
+
+		if os.Getenv(env) != "" {
+			return errors.Errorf("%s: both %s and %s_FILE are set", op, env, env)
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return errors.Wrapf(err, "%s: %s_FILE", op, env)
+		}
+
+		field.Set(reflect.ValueOf(Secret(strings.TrimRight(string(content), "\r\n"))))
+
+		return nil
+	})
+}
+
+func walkSecrets(v reflect.Value, fn func(field reflect.Value, env string) error) error {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+
+		switch {
+		case field.Type() == secretType:
+			if env := v.Type().Field(i).Tag.Get("env"); env != "" {
+				if err := fn(field, env); err != nil {
+					return err
+				}
+			}
+		case field.Kind() == reflect.Struct:
+			if err := walkSecrets(field, fn); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
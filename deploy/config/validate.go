@@ -0,0 +1,257 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ValidationError lists every problem found in a config, so that operators
+// can fix them all in one go.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid config:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+type validator struct {
+	problems []string
+}
+
+func (v *validator) check(ok bool, field, format string, args ...any) {
+	if !ok {
+		v.problems = append(v.problems, field+": "+fmt.Sprintf(format, args...))
+	}
+}
+
+func (v *validator) positive(field string, d time.Duration) {
+	v.check(d > 0, field, "must be a positive duration, got %s", d)
+}
+
+func (v *validator) port(field, value string) {
+	port, err := strconv.Atoi(value)
+	v.check(err == nil && port > 0 && port < 65536, field, "must be a port number, got %q", value)
+}
+
+// file checks that an optional file exists.
+func (v *validator) file(field, path string) {
+	if path == "" {
+		return
+	}
+
+	_, err := os.Stat(path)
+	v.check(err == nil, field, "%v", err)
+}
+
+// keyPair checks that a certificate and its key are set together.
+func (v *validator) keyPair(field, cert, key string) {
+	v.check((cert == "") == (key == ""), field, "certificate and key must be set together")
+	v.file(field, cert)
+	v.file(strings.Replace(field, "cert", "key", 1), key)
+}
+
+func (v *validator) oneOf(field, value string, allowed ...string) {
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	v.check(false, field, "must be one of %s, got %q", strings.Join(allowed, ", "), value)
+}
+
+func (c *ApiConfig) Validate() error {
+	v := &validator{}
+
+	c.Storage.validate(v)
+	c.HTTPServer.validate(v)
+	if c.Events.Backend == "redis" || c.Redis.Configured() {
+		c.Redis.validate(v)
+	}
+	c.Events.validate(v)
+	c.Tracing.validate(v)
+	c.Shutdown.validate(v)
+	c.Log.validate(v)
+
+	v.positive("freshness.max_age", c.Freshness.MaxAge)
+	v.check(c.Auth.DefaultRateLimit > 0, "auth.default_rate_limit", "must be positive, got %d", c.Auth.DefaultRateLimit)
+	c.Registration.validate(v)
+
+	return v.err()
+}
+
+func (c *FetcherConfig) Validate() error {
+	v := &validator{}
+
+	c.Storage.validate(v)
+	c.Fetcher.validate(v)
+	if c.Events.Backend == "redis" {
+		c.Redis.validate(v)
+	}
+	c.Events.validate(v)
+	c.Outbox.validate(v)
+	c.Webhooks.validate(v)
+	v.positive("alerts.refresh", c.Alerts.Refresh)
+	c.Tracing.validate(v)
+	c.Shutdown.validate(v)
+	c.Log.validate(v)
+
+	v.port("monitoring.port", c.Monitoring.Port)
+	v.positive("monitoring.timeout", c.Monitoring.Timeout)
+	v.positive("monitoring.idle_timeout", c.Monitoring.IdleTimeout)
+
+	return v.err()
+}
+
+func (v *validator) err() error {
+	if len(v.problems) > 0 {
+		return &ValidationError{Problems: v.problems}
+	}
+
+	return nil
+}
+
+func (s *Storage) validate(v *validator) {
+	v.positive("storage.timeout", s.Timeout)
+	if s.URL == "" {
+		v.check(s.Host != "", "storage.host", "is required without storage.url")
+		v.check(s.User != "", "storage.user", "is required without storage.url")
+		v.check(s.DBName != "", "storage.db_name", "is required without storage.url")
+		v.check(s.Port > 0 && s.Port < 65536, "storage.port", "must be a port number, got %d", s.Port)
+		v.oneOf("storage.ssl_mode", s.SSLMode, "disable", "allow", "prefer", "require", "verify-ca", "verify-full")
+	} else {
+		// Only the default can be told apart from an explicit value.
+		v.check(s.SSLMode == "disable", "storage.ssl_mode", "is ignored with storage.url, set sslmode in the URL instead")
+		v.check(s.SSLRootCert == "" && s.SSLCert == "" && s.SSLKey == "", "storage.ssl_root_cert", "ssl_root_cert, ssl_cert and ssl_key are ignored with storage.url, set sslrootcert, sslcert and sslkey in the URL instead")
+	}
+	v.file("storage.ssl_root_cert", s.SSLRootCert)
+	v.keyPair("storage.ssl_cert", s.SSLCert, s.SSLKey)
+	v.check(s.MaxConns > 0, "storage.max_conns", "must be positive, got %d", s.MaxConns)
+	v.check(s.MinConns >= 0 && s.MinConns <= s.MaxConns, "storage.min_conns", "must be within [0, max_conns], got %d", s.MinConns)
+}
+
+func (h *HTTPServer) validate(v *validator) {
+	v.port("http_server.port", h.Port)
+	v.positive("http_server.timeout", h.Timeout)
+	v.positive("http_server.idle_timeout", h.IdleTimeout)
+	if _, err := h.TrustedProxyPrefixes(); err != nil {
+		v.check(false, "http_server.trusted_proxies", "%v", err)
+	}
+
+	tls := h.TLS
+	v.keyPair("http_server.tls.cert_file", tls.CertFile, tls.KeyFile)
+	v.file("http_server.tls.client_ca_file", tls.ClientCAFile)
+	v.oneOf("http_server.tls.client_auth", tls.ClientAuth, "none", "optional", "require")
+	if tls.ClientAuth != "none" {
+		v.check(tls.CertFile != "", "http_server.tls.client_auth", "requires http_server.tls.cert_file")
+		v.check(tls.ClientCAFile != "", "http_server.tls.client_auth", "requires http_server.tls.client_ca_file")
+	}
+}
+
+func (r *Redis) validate(v *validator) {
+	v.oneOf("redis.mode", r.Mode, "single", "sentinel", "cluster")
+	switch r.Mode {
+	case "single":
+		v.check(r.Host != "", "redis.host", "is required in single mode")
+	case "sentinel":
+		v.check(len(r.Addrs) > 0, "redis.addrs", "is required in sentinel mode")
+		v.check(r.MasterName != "", "redis.master_name", "is required in sentinel mode")
+	case "cluster":
+		v.check(len(r.Addrs) > 0, "redis.addrs", "is required in cluster mode")
+		v.check(r.Database() == 0, "redis.db", "must be 0 in cluster mode, got %d", r.DB)
+	}
+	v.check(r.DB >= -1, "redis.db", "must be -1 for the default or a database number, got %d", r.DB)
+
+	v.file("redis.tls.ca_file", r.TLS.CAFile)
+	v.keyPair("redis.tls.cert_file", r.TLS.CertFile, r.TLS.KeyFile)
+	v.check(r.TLS.Enabled || (r.TLS.CAFile == "" && r.TLS.CertFile == ""), "redis.tls", "certificates are set but TLS is not enabled")
+}
+
+func (e *Events) validate(v *validator) {
+	v.oneOf("events.backend", e.Backend, "redis", "nats")
+	if e.Backend == "nats" {
+		v.check(e.NATS.URL != "", "events.nats.url", "is required with the nats backend")
+		v.check(e.NATS.Stream != "" && !strings.ContainsAny(e.NATS.Stream, ". *>"), "events.nats.stream", "must be a name without dots, spaces or wildcards, got %q", e.NATS.Stream)
+		v.check(e.NATS.SubjectPrefix != "" && !strings.ContainsAny(e.NATS.SubjectPrefix, " *>"), "events.nats.subject_prefix", "must be a subject without wildcards, got %q", e.NATS.SubjectPrefix)
+	}
+	v.check(e.MaxLen > 0, "events.max_len", "must be positive, got %d", e.MaxLen)
+	v.positive("events.claim_idle", e.ClaimIdle)
+	v.check(e.MaxDeliveries >= 0, "events.max_deliveries", "must not be negative, got %d", e.MaxDeliveries)
+}
+
+func (o *Outbox) validate(v *validator) {
+	v.positive("outbox.interval", o.Interval)
+	v.check(o.BatchSize > 0, "outbox.batch_size", "must be positive, got %d", o.BatchSize)
+	v.check(o.Retention >= time.Hour, "outbox.retention", "must be at least 1h, got %s", o.Retention)
+}
+
+func (w *Webhooks) validate(v *validator) {
+	v.positive("webhooks.interval", w.Interval)
+	v.check(w.BatchSize > 0, "webhooks.batch_size", "must be positive, got %d", w.BatchSize)
+	v.positive("webhooks.timeout", w.Timeout)
+	v.check(w.MaxAttempts > 0, "webhooks.max_attempts", "must be positive, got %d", w.MaxAttempts)
+	v.positive("webhooks.retry_base_delay", w.RetryBaseDelay)
+	v.check(w.RetryMaxDelay >= w.RetryBaseDelay, "webhooks.retry_max_delay", "must not be below retry_base_delay, got %s", w.RetryMaxDelay)
+}
+
+func (t *Tracing) validate(v *validator) {
+	v.oneOf("tracing.exporter", t.Exporter, "none", "stdout", "otlp")
+	v.check(t.SampleRatio >= 0 && t.SampleRatio <= 1, "tracing.sample_ratio", "must be within [0, 1], got %g", t.SampleRatio)
+}
+
+func (s *Shutdown) validate(v *validator) {
+	v.positive("shutdown.timeout", s.Timeout)
+}
+
+func (l *Log) validate(v *validator) {
+	if _, err := ParseLevel(l.Level); err != nil {
+		v.check(false, "log.level", "%v", err)
+	}
+}
+
+func (r *Registration) validate(v *validator) {
+	v.oneOf("registration.policy", r.Policy, "open", "allowlist", "pattern", "disabled")
+	if _, err := regexp.Compile(r.Pattern); err != nil {
+		v.check(false, "registration.pattern", "is not a valid regexp: %v", err)
+	}
+	v.check(r.Policy != "allowlist" || len(r.Allowlist) > 0, "registration.allowlist", "must not be empty with the allowlist policy")
+	v.check(r.MaxTracked >= 0, "registration.max_tracked", "must not be negative, got %d", r.MaxTracked)
+	v.check(r.ClientQuota >= 0, "registration.client_quota", "must not be negative, got %d", r.ClientQuota)
+	v.positive("registration.quota_window", r.QuotaWindow)
+	v.positive("registration.wait", r.Wait)
+}
+
+func (f *Fetcher) validate(v *validator) {
+	u, err := url.Parse(f.URL)
+	v.check(err == nil && u.Scheme != "" && u.Host != "", "fetcher.url", "must be an absolute URL, got %q", f.URL)
+	v.check(f.Provider != "", "fetcher.provider", "is required")
+	v.positive("fetcher.timeout", f.Timeout)
+	v.positive("fetcher.max_fetch_age", f.MaxFetchAge)
+	v.positive("fetcher.time_tickers", f.TimeTickers)
+	v.positive("fetcher.schedule_tick", f.ScheduleTick)
+	v.positive("fetcher.schedule_refresh", f.ScheduleRefresh)
+	v.positive("fetcher.leader_retry", f.LeaderRetry)
+	v.check(f.RequestsPerMinute >= 0, "fetcher.requests_per_minute", "must not be negative, got %d", f.RequestsPerMinute)
+	v.check(f.RequestsPerMonth >= 0, "fetcher.requests_per_month", "must not be negative, got %d", f.RequestsPerMonth)
+	v.check(f.MaxURLLength >= 0, "fetcher.max_url_length", "must not be negative, got %d", f.MaxURLLength)
+	v.check(f.Retries >= 0, "fetcher.retries", "must not be negative, got %d", f.Retries)
+	v.check(f.RetryBaseDelay >= 0, "fetcher.retry_base_delay", "must not be negative, got %s", f.RetryBaseDelay)
+	v.check(f.RetryMaxDelay >= f.RetryBaseDelay, "fetcher.retry_max_delay", "must not be below retry_base_delay, got %s", f.RetryMaxDelay)
+	v.check(f.BreakerThreshold >= 0, "fetcher.breaker_threshold", "must not be negative, got %d", f.BreakerThreshold)
+	v.check(f.BreakerThreshold == 0 || f.BreakerCooldown > 0, "fetcher.breaker_cooldown", "must be positive when the breaker is enabled, got %s", f.BreakerCooldown)
+}
+
+func ParseLevel(level string) (slog.Level, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return 0, fmt.Errorf("unknown log level %q", level)
+	}
+
+	return l, nil
+}
@@ -0,0 +1 @@
+ALTER TABLE cryptocurrencies DROP COLUMN IF EXISTS refresh_interval_sec;
@@ -0,0 +1,4 @@
+ALTER TABLE cryptocurrencies
+    ADD COLUMN refresh_interval_sec INTEGER CHECK (refresh_interval_sec > 0);
+
+UPDATE cryptocurrencies SET refresh_interval_sec = 5 WHERE code IN ('BTC', 'ETH');
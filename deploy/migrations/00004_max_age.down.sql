@@ -0,0 +1 @@
+ALTER TABLE cryptocurrencies DROP COLUMN IF EXISTS max_age_sec;
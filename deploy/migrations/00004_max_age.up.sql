@@ -0,0 +1,4 @@
+ALTER TABLE cryptocurrencies
+    ADD COLUMN max_age_sec INTEGER CHECK (max_age_sec > 0);
+
+UPDATE cryptocurrencies SET max_age_sec = 60 WHERE code IN ('BTC', 'ETH');
@@ -0,0 +1,9 @@
+CREATE TABLE api_keys (
+                          id SERIAL PRIMARY KEY,
+                          name VARCHAR(100) NOT NULL,
+                          key_hash CHAR(64) UNIQUE NOT NULL,
+                          scope VARCHAR(20) NOT NULL DEFAULT 'public' CHECK (scope IN ('public', 'admin')),
+                          rate_limit INTEGER CHECK (rate_limit > 0),
+                          created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+                          revoked_at TIMESTAMPTZ
+);
@@ -0,0 +1,2 @@
+ALTER TABLE cryptocurrencies
+    ADD COLUMN active BOOLEAN NOT NULL DEFAULT TRUE;
@@ -0,0 +1,14 @@
+CREATE TABLE audit_log (
+                           id BIGSERIAL PRIMARY KEY,
+                           actor VARCHAR(150) NOT NULL,
+                           action VARCHAR(50) NOT NULL,
+                           target VARCHAR(100) NOT NULL DEFAULT '',
+                           request_id VARCHAR(100) NOT NULL DEFAULT '',
+                           remote_ip VARCHAR(64) NOT NULL DEFAULT '',
+                           details JSONB,
+                           created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_audit_log_created_at ON audit_log(created_at);
+CREATE INDEX idx_audit_log_action ON audit_log(action);
+CREATE INDEX idx_audit_log_actor ON audit_log(actor);
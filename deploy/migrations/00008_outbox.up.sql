@@ -0,0 +1,13 @@
+CREATE TABLE outbox (
+                        id BIGSERIAL PRIMARY KEY,
+                        topic VARCHAR(100) NOT NULL,
+                        payload JSONB NOT NULL,
+                        headers JSONB NOT NULL DEFAULT '{}',
+                        attempts INT NOT NULL DEFAULT 0,
+                        last_error TEXT,
+                        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+                        published_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_outbox_unpublished ON outbox(id) WHERE published_at IS NULL;
+CREATE INDEX idx_outbox_published_at ON outbox(published_at) WHERE published_at IS NOT NULL;
@@ -0,0 +1,44 @@
+CREATE TABLE webhooks (
+                          id BIGSERIAL PRIMARY KEY,
+                          api_key_id INTEGER REFERENCES api_keys(id) ON DELETE CASCADE,
+                          url TEXT NOT NULL,
+                          secret VARCHAR(100) NOT NULL,
+                          crypto VARCHAR(5) NOT NULL,
+                          fiat VARCHAR(5) NOT NULL,
+                          condition VARCHAR(20) NOT NULL CHECK (condition IN ('crosses', 'crosses_above', 'crosses_below', 'moves')),
+                          threshold DOUBLE PRECISION NOT NULL,
+                          window_sec INTEGER CHECK (window_sec > 0),
+                          last_fired_at TIMESTAMPTZ,
+                          created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_webhooks_pair ON webhooks(crypto, fiat);
+CREATE INDEX idx_webhooks_api_key ON webhooks(api_key_id);
+
+CREATE TABLE webhook_deliveries (
+                                    id BIGSERIAL PRIMARY KEY,
+                                    webhook_id BIGINT NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+                                    event_id VARCHAR(100) NOT NULL,
+                                    payload JSONB NOT NULL,
+                                    attempts INTEGER NOT NULL DEFAULT 0,
+                                    last_error TEXT,
+                                    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+                                    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+                                    CONSTRAINT unique_webhook_event UNIQUE (webhook_id, event_id)
+);
+
+CREATE INDEX idx_webhook_deliveries_next_attempt ON webhook_deliveries(next_attempt_at);
+
+CREATE TABLE webhook_dead_letters (
+                                      id BIGSERIAL PRIMARY KEY,
+                                      webhook_id BIGINT NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+                                      event_id VARCHAR(100) NOT NULL,
+                                      payload JSONB NOT NULL,
+                                      attempts INTEGER NOT NULL,
+                                      last_error TEXT,
+                                      created_at TIMESTAMPTZ NOT NULL,
+                                      failed_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_webhook_dead_letters_webhook ON webhook_dead_letters(webhook_id);
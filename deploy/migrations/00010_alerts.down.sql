@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS alert_firings;
+DROP TABLE IF EXISTS alert_rules;
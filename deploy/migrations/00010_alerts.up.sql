@@ -0,0 +1,36 @@
+CREATE TABLE alert_rules (
+                             id BIGSERIAL PRIMARY KEY,
+                             api_key_id INTEGER REFERENCES api_keys(id) ON DELETE CASCADE,
+                             crypto VARCHAR(5) NOT NULL,
+                             fiat VARCHAR(5) NOT NULL,
+                             operator VARCHAR(20) NOT NULL CHECK (operator IN ('above', 'below', 'crosses_above', 'crosses_below')),
+                             threshold DOUBLE PRECISION NOT NULL,
+                             cooldown_sec INTEGER NOT NULL DEFAULT 0 CHECK (cooldown_sec >= 0),
+                             channel VARCHAR(20) NOT NULL DEFAULT 'none' CHECK (channel IN ('none', 'webhook')),
+                             webhook_id BIGINT REFERENCES webhooks(id) ON DELETE CASCADE,
+                             active BOOLEAN NOT NULL DEFAULT TRUE,
+                             last_fired_at TIMESTAMPTZ,
+                             created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+                             CONSTRAINT alert_rules_webhook_channel CHECK ((channel = 'webhook') = (webhook_id IS NOT NULL))
+);
+
+CREATE INDEX idx_alert_rules_pair ON alert_rules(crypto, fiat) WHERE active;
+CREATE INDEX idx_alert_rules_api_key ON alert_rules(api_key_id);
+
+CREATE TABLE alert_firings (
+                               id BIGSERIAL PRIMARY KEY,
+                               rule_id BIGINT NOT NULL REFERENCES alert_rules(id) ON DELETE CASCADE,
+                               event_id VARCHAR(100) NOT NULL,
+                               crypto VARCHAR(5) NOT NULL,
+                               fiat VARCHAR(5) NOT NULL,
+                               operator VARCHAR(20) NOT NULL,
+                               threshold DOUBLE PRECISION NOT NULL,
+                               rate DOUBLE PRECISION NOT NULL,
+                               previous DOUBLE PRECISION,
+                               fired_at TIMESTAMPTZ NOT NULL,
+
+                               CONSTRAINT unique_alert_firing UNIQUE (rule_id, event_id)
+);
+
+CREATE INDEX idx_alert_firings_fired_at ON alert_firings(fired_at);
@@ -0,0 +1,7 @@
+CREATE TABLE provider_usage (
+                                provider VARCHAR(50) NOT NULL,
+                                month DATE NOT NULL,
+                                requests INTEGER NOT NULL DEFAULT 0,
+
+                                PRIMARY KEY (provider, month)
+);
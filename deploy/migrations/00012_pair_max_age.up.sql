@@ -0,0 +1,7 @@
+CREATE TABLE pair_max_ages (
+                               crypto_id INTEGER NOT NULL REFERENCES cryptocurrencies(id) ON DELETE CASCADE,
+                               fiat_id INTEGER NOT NULL REFERENCES fiat_currencies(id) ON DELETE CASCADE,
+                               max_age_sec INTEGER NOT NULL CHECK (max_age_sec > 0),
+
+                               PRIMARY KEY (crypto_id, fiat_id)
+);
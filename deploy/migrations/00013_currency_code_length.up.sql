@@ -0,0 +1,5 @@
+ALTER TABLE cryptocurrencies ALTER COLUMN code TYPE VARCHAR(10);
+ALTER TABLE fiat_currencies ALTER COLUMN code TYPE VARCHAR(10);
+ALTER TABLE webhooks ALTER COLUMN crypto TYPE VARCHAR(10), ALTER COLUMN fiat TYPE VARCHAR(10);
+ALTER TABLE alert_rules ALTER COLUMN crypto TYPE VARCHAR(10), ALTER COLUMN fiat TYPE VARCHAR(10);
+ALTER TABLE alert_firings ALTER COLUMN crypto TYPE VARCHAR(10), ALTER COLUMN fiat TYPE VARCHAR(10);
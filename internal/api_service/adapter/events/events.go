@@ -0,0 +1,112 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/langowen/exchange/internal/entities"
+	"github.com/langowen/exchange/internal/eventbus"
+	"github.com/langowen/exchange/internal/tracing"
+	"github.com/pkg/errors"
+	"log/slog"
+	"sync"
+)
+
+const listenerBuffer = 16
+
+// Events publishes registration requests and fans their results out to the
+// requests waiting for them. Every api_service replica sees every result.
+type Events struct {
+	bus eventbus.EventBus
+
+	mu        sync.Mutex
+	listeners map[chan entities.RegistrationResult]struct{}
+}
+
+func New(bus eventbus.EventBus) *Events {
+	return &Events{
+		bus:       bus,
+		listeners: make(map[chan entities.RegistrationResult]struct{}),
+	}
+}
+
+// Run consumes registration results until ctx is done.
+func (e *Events) Run(ctx context.Context) error {
+	const op = "events.Run"
+
+	if err := e.bus.Subscribe(ctx, eventbus.TopicCurrencyRegistered, "", e.fanOut); err != nil {
+		return errors.Wrap(err, op)
+	}
+
+	return nil
+}
+
+// RequestCurrency asks the fetcher to track currency unless maxTracked
+// currencies are tracked already, and waits for the result, which is nil once
+// its first rates are saved, or until ctx is done.
+func (e *Events) RequestCurrency(ctx context.Context, currency string, maxTracked int) error {
+	const op = "events.RequestCurrency"
+
+	payload, err := entities.CurrencyMessage{Currency: currency, MaxTracked: maxTracked}.Marshal()
+	if err != nil {
+		return errors.Wrap(err, op)
+	}
+
+	// Listen before publishing, so that a fast result is not missed.
+	results := e.listen(ctx)
+
+	if err = e.bus.Publish(ctx, eventbus.TopicCurrencyRequested, []byte(payload), tracing.Inject(ctx)); err != nil {
+		return errors.Wrap(err, op)
+	}
+
+	for result := range results {
+		// Results of other currencies registered concurrently share the channel.
+		if result.Currency == currency {
+			return errors.Wrap(result.Err(), op)
+		}
+	}
+
+	return errors.Wrap(ctx.Err(), op)
+}
+
+// listen streams registration results until ctx is done. Results for slow
+// listeners are dropped.
+func (e *Events) listen(ctx context.Context) <-chan entities.RegistrationResult {
+	listener := make(chan entities.RegistrationResult, listenerBuffer)
+
+	e.mu.Lock()
+	e.listeners[listener] = struct{}{}
+	e.mu.Unlock()
+
+	context.AfterFunc(ctx, func() {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+
+		delete(e.listeners, listener)
+		close(listener)
+	})
+
+	return listener
+}
+
+func (e *Events) fanOut(_ context.Context, event eventbus.Event) error {
+	var result entities.RegistrationResult
+	if err := json.Unmarshal(event.Payload, &result); err != nil {
+		slog.Error("Dropping malformed registration result", "id", event.ID, "error", err)
+		return nil
+	}
+
+	slog.Debug("Received message", "currency", result.Currency, "status", result.Status, "id", event.ID)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for listener := range e.listeners {
+		select {
+		case listener <- result:
+		default:
+			slog.Warn("Listener is too slow, dropping registration result", "currency", result.Currency)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,137 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/langowen/exchange/internal/entities"
+	"github.com/langowen/exchange/internal/eventbus"
+	"github.com/langowen/exchange/internal/eventbus/membus"
+	"github.com/pkg/errors"
+	"testing"
+	"time"
+)
+
+// fetcher answers every registration request with the result of answer.
+func fetcher(t *testing.T, ctx context.Context, bus eventbus.EventBus, answer func(request entities.CurrencyMessage) []entities.RegistrationResult) {
+	t.Helper()
+
+	go func() {
+		_ = bus.Subscribe(ctx, eventbus.TopicCurrencyRequested, "currency_fetcher", func(ctx context.Context, event eventbus.Event) error {
+			for _, result := range answer(entities.ParseCurrencyMessage(string(event.Payload))) {
+				payload, err := json.Marshal(result)
+				if err != nil {
+					return err
+				}
+				if err = bus.Publish(ctx, eventbus.TopicCurrencyRegistered, payload, nil); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}()
+}
+
+func start(t *testing.T, answer func(request entities.CurrencyMessage) []entities.RegistrationResult) *Events {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	bus := membus.New()
+	t.Cleanup(func() {
+		_ = bus.Close()
+	})
+
+	e := New(bus)
+	go func() {
+		_ = e.Run(ctx)
+	}()
+	fetcher(t, ctx, bus, answer)
+
+	// Run subscribes asynchronously and broadcasts are not replayed, so make
+	// sure it listens before the first request.
+	time.Sleep(20 * time.Millisecond)
+
+	return e
+}
+
+func TestRequestCurrency(t *testing.T) {
+	tests := []struct {
+		name    string
+		answer  func(request entities.CurrencyMessage) []entities.RegistrationResult
+		wantErr error
+	}{
+		{
+			name: "tracked",
+			answer: func(request entities.CurrencyMessage) []entities.RegistrationResult {
+				return []entities.RegistrationResult{{Currency: request.Currency, Status: entities.RegistrationTracked}}
+			},
+		},
+		{
+			name: "unavailable",
+			answer: func(request entities.CurrencyMessage) []entities.RegistrationResult {
+				return []entities.RegistrationResult{{Currency: request.Currency, Status: entities.RegistrationUnavailable, Reason: "provider request failed"}}
+			},
+			wantErr: entities.ErrRateUnavailable,
+		},
+		{
+			name: "rejected over the cap",
+			answer: func(request entities.CurrencyMessage) []entities.RegistrationResult {
+				if request.MaxTracked != 3 {
+					t.Errorf("MaxTracked = %d, want 3", request.MaxTracked)
+				}
+				return []entities.RegistrationResult{{Currency: request.Currency, Status: entities.RegistrationRejected, Reason: "limit of 3 tracked currencies reached"}}
+			},
+			wantErr: entities.ErrRegistrationForbidden,
+		},
+		{
+			name: "results of other currencies are skipped",
+			answer: func(request entities.CurrencyMessage) []entities.RegistrationResult {
+				return []entities.RegistrationResult{
+					{Currency: "ETH", Status: entities.RegistrationUnavailable},
+					{Currency: request.Currency, Status: entities.RegistrationTracked},
+				}
+			},
+		},
+		{
+			name: "no answer",
+			answer: func(entities.CurrencyMessage) []entities.RegistrationResult {
+				return nil
+			},
+			wantErr: context.DeadlineExceeded,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := start(t, tt.answer)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+
+			err := e.RequestCurrency(ctx, "BTC", 3)
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("RequestCurrency returned %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("RequestCurrency returned %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestListenersAreRemoved(t *testing.T) {
+	e := start(t, func(entities.CurrencyMessage) []entities.RegistrationResult {
+		return nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_ = e.RequestCurrency(ctx, "BTC", 3)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(e.listeners) != 0 {
+		t.Fatalf("%d listeners left after the request returned", len(e.listeners))
+	}
+}
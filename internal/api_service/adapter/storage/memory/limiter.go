@@ -0,0 +1,112 @@
+package memory
+
+import (
+	"context"
+	"github.com/langowen/exchange/internal/entities"
+	"math"
+	"sync"
+	"time"
+)
+
+const sweepInterval = time.Minute
+
+// Limiter keeps token buckets and counters in process memory. It replaces the
+// Redis limiter when api_service runs without Redis, so every replica enforces
+// the limits on its own.
+type Limiter struct {
+	mu        sync.Mutex
+	now       func() time.Time
+	buckets   map[string]*bucket
+	counters  map[string]*counter
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	ts      time.Time
+	expires time.Time
+}
+
+type counter struct {
+	count   int64
+	expires time.Time
+}
+
+func NewLimiter() *Limiter {
+	return &Limiter{
+		now:      time.Now,
+		buckets:  make(map[string]*bucket),
+		counters: make(map[string]*counter),
+	}
+}
+
+// TakeToken works like the Redis token bucket: it refills continuously at
+// limit/period and holds at most limit tokens.
+func (l *Limiter) TakeToken(_ context.Context, name string, limit int, period time.Duration) (*entities.RateLimit, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b := l.buckets[name]
+	if b == nil {
+		b = &bucket{tokens: float64(limit), ts: now}
+		l.buckets[name] = b
+	}
+
+	rate := float64(limit) / float64(period)
+	b.tokens = math.Min(float64(limit), b.tokens+float64(max(0, now.Sub(b.ts)))*rate)
+	b.ts = now
+	b.expires = now.Add(period)
+
+	res := &entities.RateLimit{Limit: limit}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = time.Duration(math.Ceil((1 - b.tokens) / rate))
+	}
+	res.Remaining = int(b.tokens)
+	res.Reset = time.Duration(math.Ceil((float64(limit) - b.tokens) / rate))
+
+	return res, nil
+}
+
+// Increment counts an event in a fixed window that starts with the first
+// event, and returns the count so far.
+func (l *Limiter) Increment(_ context.Context, name string, window time.Duration) (int64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	c := l.counters[name]
+	if c == nil || !now.Before(c.expires) {
+		c = &counter{expires: now.Add(window)}
+		l.counters[name] = c
+	}
+	c.count++
+
+	return c.count, nil
+}
+
+// sweep drops expired buckets and counters, at most once per sweepInterval.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+
+	for name, b := range l.buckets {
+		if !now.Before(b.expires) {
+			delete(l.buckets, name)
+		}
+	}
+	for name, c := range l.counters {
+		if !now.Before(c.expires) {
+			delete(l.counters, name)
+		}
+	}
+}
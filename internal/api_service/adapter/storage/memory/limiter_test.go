@@ -0,0 +1,78 @@
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	return c.now
+}
+
+func newLimiter() (*Limiter, *clock) {
+	c := &clock{now: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}
+	l := NewLimiter()
+	l.now = c.Now
+
+	return l, c
+}
+
+func TestTakeToken(t *testing.T) {
+	l, c := newLimiter()
+	ctx := context.Background()
+
+	for i := range 3 {
+		res, _ := l.TakeToken(ctx, "key:1", 3, time.Minute)
+		if !res.Allowed || res.Remaining != 2-i {
+			t.Fatalf("take %d: got %+v, want allowed with %d remaining", i+1, res, 2-i)
+		}
+	}
+
+	res, _ := l.TakeToken(ctx, "key:1", 3, time.Minute)
+	if res.Allowed {
+		t.Fatal("took a fourth token out of three")
+	}
+	if res.RetryAfter != 20*time.Second {
+		t.Errorf("RetryAfter = %v, want 20s for one token at 3 per minute", res.RetryAfter)
+	}
+	if res.Reset != time.Minute {
+		t.Errorf("Reset = %v, want a minute to refill", res.Reset)
+	}
+
+	if res, _ = l.TakeToken(ctx, "key:2", 3, time.Minute); !res.Allowed {
+		t.Error("buckets are not separate")
+	}
+
+	c.now = c.now.Add(20 * time.Second)
+	if res, _ = l.TakeToken(ctx, "key:1", 3, time.Minute); !res.Allowed || res.Remaining != 0 {
+		t.Errorf("after 20s got %+v, want one refilled token", res)
+	}
+
+	c.now = c.now.Add(time.Hour)
+	if res, _ = l.TakeToken(ctx, "key:1", 3, time.Minute); res.Remaining != 2 {
+		t.Errorf("after an hour got %+v, want a full bucket", res)
+	}
+}
+
+func TestIncrement(t *testing.T) {
+	l, c := newLimiter()
+	ctx := context.Background()
+
+	for want := int64(1); want <= 3; want++ {
+		if got, _ := l.Increment(ctx, "registrations:10.0.0.1", time.Hour); got != want {
+			t.Fatalf("Increment = %d, want %d", got, want)
+		}
+		c.now = c.now.Add(10 * time.Minute)
+	}
+
+	// The hour-long window started with the first event.
+	c.now = c.now.Add(30 * time.Minute)
+	if got, _ := l.Increment(ctx, "registrations:10.0.0.1", time.Hour); got != 1 {
+		t.Errorf("Increment after the window = %d, want 1", got)
+	}
+}
@@ -0,0 +1,240 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/langowen/exchange/internal/entities"
+	"github.com/langowen/exchange/internal/metrics"
+	"github.com/pkg/errors"
+	"strings"
+	"time"
+)
+
+// Alert rules are filtered by owner like webhooks: a zero apiKeyID matches
+// every rule.
+
+const alertRuleColumns = `id, COALESCE(api_key_id, 0), crypto, fiat, operator, threshold, cooldown_sec, channel, COALESCE(webhook_id, 0), active, last_fired_at, created_at`
+
+func scanAlertRule(row pgx.Row) (*entities.AlertRule, error) {
+	var (
+		rule        entities.AlertRule
+		cooldownSec int
+	)
+
+	err := row.Scan(&rule.ID, &rule.APIKeyID, &rule.Crypto, &rule.Fiat, &rule.Operator, &rule.Threshold,
+		&cooldownSec, &rule.Channel, &rule.WebhookID, &rule.Active, &rule.LastFiredAt, &rule.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	rule.Cooldown = time.Duration(cooldownSec) * time.Second
+
+	return &rule, nil
+}
+
+func (s *Storage) CreateAlertRule(ctx context.Context, rule *entities.AlertRule) error {
+	const op = "storage.postgres.CreateAlertRule"
+
+	defer metrics.ObserveDBQuery("CreateAlertRule")()
+
+	query := `
+        INSERT INTO alert_rules (api_key_id, crypto, fiat, operator, threshold, cooldown_sec, channel, webhook_id, active)
+        VALUES (NULLIF($1, 0), $2, $3, $4, $5, $6, $7, NULLIF($8, 0), $9)
+        RETURNING id, created_at
+    `
+
+	err := s.db.QueryRow(ctx, query,
+		rule.APIKeyID,
+		rule.Crypto,
+		rule.Fiat,
+		rule.Operator,
+		rule.Threshold,
+		int(rule.Cooldown/time.Second),
+		rule.Channel,
+		rule.WebhookID,
+		rule.Active,
+	).Scan(&rule.ID, &rule.CreatedAt)
+	if err != nil {
+		return errors.Wrap(err, op)
+	}
+
+	return nil
+}
+
+func (s *Storage) ListAlertRules(ctx context.Context, apiKeyID int) ([]entities.AlertRule, error) {
+	const op = "storage.postgres.ListAlertRules"
+
+	defer metrics.ObserveDBQuery("ListAlertRules")()
+
+	rows, err := s.db.Query(ctx, `
+        SELECT `+alertRuleColumns+`
+        FROM alert_rules
+        WHERE $1 = 0 OR api_key_id = $1
+        ORDER BY id
+    `, apiKeyID)
+	if err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+	defer rows.Close()
+
+	rules := make([]entities.AlertRule, 0)
+	for rows.Next() {
+		rule, err := scanAlertRule(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, op)
+		}
+		rules = append(rules, *rule)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+
+	return rules, nil
+}
+
+func (s *Storage) GetAlertRule(ctx context.Context, id int64, apiKeyID int) (*entities.AlertRule, error) {
+	const op = "storage.postgres.GetAlertRule"
+
+	defer metrics.ObserveDBQuery("GetAlertRule")()
+
+	row := s.db.QueryRow(ctx, `
+        SELECT `+alertRuleColumns+`
+        FROM alert_rules
+        WHERE id = $1 AND ($2 = 0 OR api_key_id = $2)
+    `, id, apiKeyID)
+
+	rule, err := scanAlertRule(row)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, entities.ErrNotFound
+		}
+		return nil, errors.Wrap(err, op)
+	}
+
+	return rule, nil
+}
+
+// UpdateAlertRule replaces the user fields of the rule. The cooldown keeps
+// counting from the last firing.
+func (s *Storage) UpdateAlertRule(ctx context.Context, rule *entities.AlertRule, apiKeyID int) error {
+	const op = "storage.postgres.UpdateAlertRule"
+
+	defer metrics.ObserveDBQuery("UpdateAlertRule")()
+
+	query := `
+        UPDATE alert_rules
+        SET crypto = $3, fiat = $4, operator = $5, threshold = $6, cooldown_sec = $7,
+            channel = $8, webhook_id = NULLIF($9, 0), active = $10
+        WHERE id = $1 AND ($2 = 0 OR api_key_id = $2)
+        RETURNING COALESCE(api_key_id, 0), last_fired_at, created_at
+    `
+
+	err := s.db.QueryRow(ctx, query,
+		rule.ID,
+		apiKeyID,
+		rule.Crypto,
+		rule.Fiat,
+		rule.Operator,
+		rule.Threshold,
+		int(rule.Cooldown/time.Second),
+		rule.Channel,
+		rule.WebhookID,
+		rule.Active,
+	).Scan(&rule.APIKeyID, &rule.LastFiredAt, &rule.CreatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return entities.ErrNotFound
+		}
+		return errors.Wrap(err, op)
+	}
+
+	return nil
+}
+
+func (s *Storage) DeleteAlertRule(ctx context.Context, id int64, apiKeyID int) error {
+	const op = "storage.postgres.DeleteAlertRule"
+
+	defer metrics.ObserveDBQuery("DeleteAlertRule")()
+
+	tag, err := s.db.Exec(ctx, `DELETE FROM alert_rules WHERE id = $1 AND ($2 = 0 OR api_key_id = $2)`, id, apiKeyID)
+	if err != nil {
+		return errors.Wrap(err, op)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return entities.ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *Storage) ListAlertFirings(ctx context.Context, filter entities.AlertFiringFilter) ([]entities.AlertFiring, int, error) {
+	const op = "storage.postgres.ListAlertFirings"
+
+	defer metrics.ObserveDBQuery("ListAlertFirings")()
+
+	var (
+		conds []string
+		args  []any
+	)
+	where := func(cond string, arg any) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+
+	if filter.APIKeyID != 0 {
+		where("r.api_key_id = $%d", filter.APIKeyID)
+	}
+	if filter.RuleID != 0 {
+		where("f.rule_id = $%d", filter.RuleID)
+	}
+	if !filter.From.IsZero() {
+		where("f.fired_at >= $%d", filter.From)
+	}
+	if !filter.To.IsZero() {
+		where("f.fired_at < $%d", filter.To)
+	}
+
+	whereClause := ""
+	if len(conds) > 0 {
+		whereClause = "WHERE " + strings.Join(conds, " AND ")
+	}
+
+	from := `FROM alert_firings f JOIN alert_rules r ON r.id = f.rule_id `
+
+	var total int
+	if err := s.db.QueryRow(ctx, `SELECT COUNT(*) `+from+whereClause, args...).Scan(&total); err != nil {
+		return nil, 0, errors.Wrap(err, op)
+	}
+
+	args = append(args, filter.Limit, filter.Offset)
+	query := fmt.Sprintf(`
+        SELECT f.id, f.rule_id, f.event_id, f.crypto, f.fiat, f.operator, f.threshold, f.rate, f.previous, f.fired_at
+        %s%s
+        ORDER BY f.fired_at DESC, f.id DESC
+        LIMIT $%d OFFSET $%d
+    `, from, whereClause, len(args)-1, len(args))
+
+	rows, err := s.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, op)
+	}
+	defer rows.Close()
+
+	firings := make([]entities.AlertFiring, 0, filter.Limit)
+	for rows.Next() {
+		var f entities.AlertFiring
+		err = rows.Scan(&f.ID, &f.RuleID, &f.EventID, &f.Crypto, &f.Fiat, &f.Operator, &f.Threshold, &f.Rate, &f.Previous, &f.FiredAt)
+		if err != nil {
+			return nil, 0, errors.Wrap(err, op)
+		}
+		firings = append(firings, f)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, 0, errors.Wrap(err, op)
+	}
+
+	return firings, total, nil
+}
@@ -0,0 +1,99 @@
+package postgres
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5"
+	"github.com/langowen/exchange/internal/entities"
+	"github.com/langowen/exchange/internal/metrics"
+	"github.com/pkg/errors"
+)
+
+func (s *Storage) GetAPIKeyByHash(ctx context.Context, hash string) (*entities.APIKey, error) {
+	const op = "storage.postgres.GetAPIKeyByHash"
+
+	defer metrics.ObserveDBQuery("GetAPIKeyByHash")()
+
+	query := `
+        SELECT id, name, scope, COALESCE(rate_limit, 0), created_at, revoked_at
+        FROM api_keys
+        WHERE key_hash = $1
+    `
+
+	var key entities.APIKey
+	err := s.db.QueryRow(ctx, query, hash).Scan(&key.ID, &key.Name, &key.Scope, &key.RateLimit, &key.CreatedAt, &key.RevokedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, entities.ErrNotFound
+		}
+		return nil, errors.Wrap(err, op)
+	}
+
+	return &key, nil
+}
+
+func (s *Storage) CreateAPIKey(ctx context.Context, key *entities.APIKey, hash string) error {
+	const op = "storage.postgres.CreateAPIKey"
+
+	defer metrics.ObserveDBQuery("CreateAPIKey")()
+
+	query := `
+        INSERT INTO api_keys (name, key_hash, scope, rate_limit)
+        VALUES ($1, $2, $3, NULLIF($4, 0))
+        ON CONFLICT (key_hash) DO UPDATE SET name = api_keys.name
+        RETURNING id, created_at
+    `
+
+	if err := s.db.QueryRow(ctx, query, key.Name, hash, key.Scope, key.RateLimit).Scan(&key.ID, &key.CreatedAt); err != nil {
+		return errors.Wrap(err, op)
+	}
+
+	return nil
+}
+
+func (s *Storage) ListAPIKeys(ctx context.Context) ([]entities.APIKey, error) {
+	const op = "storage.postgres.ListAPIKeys"
+
+	defer metrics.ObserveDBQuery("ListAPIKeys")()
+
+	rows, err := s.db.Query(ctx, `
+        SELECT id, name, scope, COALESCE(rate_limit, 0), created_at, revoked_at
+        FROM api_keys
+        ORDER BY id
+    `)
+	if err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+	defer rows.Close()
+
+	keys := make([]entities.APIKey, 0)
+	for rows.Next() {
+		var key entities.APIKey
+		if err = rows.Scan(&key.ID, &key.Name, &key.Scope, &key.RateLimit, &key.CreatedAt, &key.RevokedAt); err != nil {
+			return nil, errors.Wrap(err, op)
+		}
+		keys = append(keys, key)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+
+	return keys, nil
+}
+
+func (s *Storage) RevokeAPIKey(ctx context.Context, id int) error {
+	const op = "storage.postgres.RevokeAPIKey"
+
+	defer metrics.ObserveDBQuery("RevokeAPIKey")()
+
+	tag, err := s.db.Exec(ctx, `UPDATE api_keys SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL`, id)
+	if err != nil {
+		return errors.Wrap(err, op)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return entities.ErrNotFound
+	}
+
+	return nil
+}
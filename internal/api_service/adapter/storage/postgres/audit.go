@@ -0,0 +1,107 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"github.com/langowen/exchange/internal/entities"
+	"github.com/langowen/exchange/internal/metrics"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+func (s *Storage) SaveAuditEntry(ctx context.Context, entry *entities.AuditEntry) error {
+	const op = "storage.postgres.SaveAuditEntry"
+
+	defer metrics.ObserveDBQuery("SaveAuditEntry")()
+
+	query := `
+        INSERT INTO audit_log (actor, action, target, request_id, remote_ip, details)
+        VALUES ($1, $2, $3, $4, $5, $6)
+        RETURNING id, created_at
+    `
+
+	err := s.db.QueryRow(ctx, query,
+		entry.Actor,
+		entry.Action,
+		entry.Target,
+		entry.RequestID,
+		entry.RemoteIP,
+		entry.Details,
+	).Scan(&entry.ID, &entry.CreatedAt)
+	if err != nil {
+		return errors.Wrap(err, op)
+	}
+
+	return nil
+}
+
+func (s *Storage) ListAuditEntries(ctx context.Context, filter entities.AuditFilter) ([]entities.AuditEntry, int, error) {
+	const op = "storage.postgres.ListAuditEntries"
+
+	defer metrics.ObserveDBQuery("ListAuditEntries")()
+
+	var (
+		conds []string
+		args  []any
+	)
+	where := func(cond string, arg any) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+
+	if filter.Actor != "" {
+		where("actor = $%d", filter.Actor)
+	}
+	if filter.Action != "" {
+		where("action = $%d", filter.Action)
+	}
+	if filter.Target != "" {
+		where("target = $%d", filter.Target)
+	}
+	if !filter.From.IsZero() {
+		where("created_at >= $%d", filter.From)
+	}
+	if !filter.To.IsZero() {
+		where("created_at < $%d", filter.To)
+	}
+
+	whereClause := ""
+	if len(conds) > 0 {
+		whereClause = "WHERE " + strings.Join(conds, " AND ")
+	}
+
+	var total int
+	if err := s.db.QueryRow(ctx, `SELECT COUNT(*) FROM audit_log `+whereClause, args...).Scan(&total); err != nil {
+		return nil, 0, errors.Wrap(err, op)
+	}
+
+	args = append(args, filter.Limit, filter.Offset)
+	query := fmt.Sprintf(`
+        SELECT id, actor, action, target, request_id, remote_ip, details, created_at
+        FROM audit_log
+        %s
+        ORDER BY created_at DESC, id DESC
+        LIMIT $%d OFFSET $%d
+    `, whereClause, len(args)-1, len(args))
+
+	rows, err := s.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, op)
+	}
+	defer rows.Close()
+
+	entries := make([]entities.AuditEntry, 0, filter.Limit)
+	for rows.Next() {
+		var e entities.AuditEntry
+		if err = rows.Scan(&e.ID, &e.Actor, &e.Action, &e.Target, &e.RequestID, &e.RemoteIP, &e.Details, &e.CreatedAt); err != nil {
+			return nil, 0, errors.Wrap(err, op)
+		}
+		entries = append(entries, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, 0, errors.Wrap(err, op)
+	}
+
+	return entries, total, nil
+}
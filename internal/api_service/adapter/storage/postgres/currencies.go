@@ -0,0 +1,133 @@
+package postgres
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/langowen/exchange/internal/entities"
+	"github.com/langowen/exchange/internal/metrics"
+	"github.com/pkg/errors"
+)
+
+const uniqueViolation = "23505"
+
+func (s *Storage) ListCurrencies(ctx context.Context) ([]entities.Cryptocurrency, error) {
+	const op = "storage.postgres.ListCurrencies"
+
+	defer metrics.ObserveDBQuery("ListCurrencies")()
+
+	rows, err := s.db.Query(ctx, `
+        SELECT code, active, COALESCE(refresh_interval_sec, 0), COALESCE(max_age_sec, 0)
+        FROM cryptocurrencies
+        ORDER BY code
+    `)
+	if err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+	defer rows.Close()
+
+	currencies := make([]entities.Cryptocurrency, 0)
+	for rows.Next() {
+		var c entities.Cryptocurrency
+		if err = rows.Scan(&c.Code, &c.Active, &c.RefreshIntervalSec, &c.MaxAgeSec); err != nil {
+			return nil, errors.Wrap(err, op)
+		}
+		currencies = append(currencies, c)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+
+	return currencies, nil
+}
+
+func (s *Storage) CountCurrencies(ctx context.Context) (int, error) {
+	const op = "storage.postgres.CountCurrencies"
+
+	defer metrics.ObserveDBQuery("CountCurrencies")()
+
+	var count int
+	if err := s.db.QueryRow(ctx, `SELECT COUNT(*) FROM cryptocurrencies`).Scan(&count); err != nil {
+		return 0, errors.Wrap(err, op)
+	}
+
+	return count, nil
+}
+
+func (s *Storage) SetCurrencyActive(ctx context.Context, code string, active bool) error {
+	const op = "storage.postgres.SetCurrencyActive"
+
+	defer metrics.ObserveDBQuery("SetCurrencyActive")()
+
+	tag, err := s.db.Exec(ctx, `UPDATE cryptocurrencies SET active = $2 WHERE code = $1`, code, active)
+	if err != nil {
+		return errors.Wrap(err, op)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return entities.ErrNotFound
+	}
+
+	return nil
+}
+
+// RenameCurrency renames the crypto together with the webhooks, alert rules
+// and firings that refer to it by code, so they keep matching its rates.
+func (s *Storage) RenameCurrency(ctx context.Context, code, newCode string) (err error) {
+	const op = "storage.postgres.RenameCurrency"
+
+	defer metrics.ObserveDBQuery("RenameCurrency")()
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return errors.Wrap(err, op)
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback(ctx)
+		}
+	}()
+
+	tag, err := tx.Exec(ctx, `UPDATE cryptocurrencies SET code = $2 WHERE code = $1`, code, newCode)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+			return entities.ErrAlreadyExists
+		}
+		return errors.Wrap(err, op)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return entities.ErrNotFound
+	}
+
+	for _, table := range []string{"webhooks", "alert_rules", "alert_firings"} {
+		if _, err = tx.Exec(ctx, `UPDATE `+table+` SET crypto = $2 WHERE crypto = $1`, code, newCode); err != nil {
+			return errors.Wrap(err, op)
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return errors.Wrap(err, op)
+	}
+
+	return nil
+}
+
+// DeleteCurrency removes the crypto together with its whole rate history.
+func (s *Storage) DeleteCurrency(ctx context.Context, code string) error {
+	const op = "storage.postgres.DeleteCurrency"
+
+	defer metrics.ObserveDBQuery("DeleteCurrency")()
+
+	tag, err := s.db.Exec(ctx, `DELETE FROM cryptocurrencies WHERE code = $1`, code)
+	if err != nil {
+		return errors.Wrap(err, op)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return entities.ErrNotFound
+	}
+
+	return nil
+}
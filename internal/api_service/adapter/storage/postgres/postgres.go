@@ -4,8 +4,11 @@ import (
 	"context"
 	"fmt"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/langowen/exchange/deploy/config"
 	"github.com/langowen/exchange/internal/api_service/service"
 	"github.com/langowen/exchange/internal/entities"
+	"github.com/langowen/exchange/internal/metrics"
+	"github.com/langowen/exchange/internal/tracing"
 	"github.com/pkg/errors"
 	"log/slog"
 	"time"
@@ -21,19 +24,20 @@ func NewStorage(pool *pgxpool.Pool) *Storage {
 	}
 }
 
-func InitStorage(ctx context.Context, dsn string) (*Storage, error) {
+func InitStorage(ctx context.Context, cfg config.Storage) (*Storage, error) {
 	const op = "storage.postgres.New"
 
-	poolConfig, err := pgxpool.ParseConfig(dsn)
+	poolConfig, err := pgxpool.ParseConfig(cfg.DSN())
 	if err != nil {
 		return nil, errors.Wrap(err, op)
 	}
-	poolConfig.MaxConns = 25
-	poolConfig.MinConns = 5
+	poolConfig.MaxConns = cfg.MaxConns
+	poolConfig.MinConns = cfg.MinConns
 	poolConfig.MaxConnLifetime = 10 * time.Minute
 	poolConfig.MaxConnIdleTime = 5 * time.Minute
+	poolConfig.ConnConfig.Tracer = tracing.NewPgxTracer()
 
-	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, cfg.Timeout)
 	defer cancel()
 
 	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
@@ -52,18 +56,19 @@ func InitStorage(ctx context.Context, dsn string) (*Storage, error) {
 	return storageBD, nil
 }
 
-func (s *Storage) GetRate(ctx context.Context, currency string, date time.Time, opts ...service.Option) (*entities.ExchangeRate, error) {
+// GetRate aggregates, or picks the latest of, the rates of currency saved
+// within [from, to). Currencies disabled by an admin have no rates.
+func (s *Storage) GetRate(ctx context.Context, currency string, from, to time.Time, opts ...service.Option) (*entities.ExchangeRate, error) {
 	const op = "storage.postgres.GetRates"
 
+	defer metrics.ObserveDBQuery("GetRate")()
+
 	options := &service.Options{}
 
 	for _, opt := range opts {
 		opt(options)
 	}
 
-	startOfDay := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, date.Location())
-	endOfDay := startOfDay.Add(24 * time.Hour)
-
 	var query string
 	switch options.FuncType {
 	case service.Avg, service.Min, service.Max:
@@ -76,7 +81,7 @@ func (s *Storage) GetRate(ctx context.Context, currency string, date time.Time,
                  FROM exchange_rates er
                  JOIN cryptocurrencies c ON er.crypto_id = c.id
 			     JOIN fiat_currencies f ON er.fiat_id = f.id
-			     WHERE c.code = $1 AND er.timestamp BETWEEN $2 AND $3 
+			     WHERE c.code = $1 AND c.active AND er.timestamp >= $2 AND er.timestamp < $3 
 			     GROUP BY c.code, f.code, c.id, f.id
              )
              SELECT crypto_code, fiat_code, amount, max_timestamp
@@ -92,7 +97,7 @@ func (s *Storage) GetRate(ctx context.Context, currency string, date time.Time,
                 FROM exchange_rates er
                 JOIN cryptocurrencies c ON er.crypto_id = c.id
                 JOIN fiat_currencies f ON er.fiat_id = f.id
-                WHERE c.code = $1 AND er.timestamp BETWEEN $2 AND $3
+                WHERE c.code = $1 AND c.active AND er.timestamp >= $2 AND er.timestamp < $3
             )
             SELECT crypto_code, fiat_code, amount, timestamp
             FROM RankedRates
@@ -101,7 +106,7 @@ func (s *Storage) GetRate(ctx context.Context, currency string, date time.Time,
         `
 	}
 
-	rows, err := s.db.Query(ctx, query, currency, startOfDay, endOfDay)
+	rows, err := s.db.Query(ctx, query, currency, from, to)
 	if err != nil {
 		return nil, errors.Wrap(err, op)
 	}
@@ -121,8 +126,9 @@ func (s *Storage) GetRate(ctx context.Context, currency string, date time.Time,
 		}
 
 		fiatPrices = append(fiatPrices, entities.FiatPrice{
-			Currency: fiatCode,
-			Amount:   amount,
+			Currency:   fiatCode,
+			Amount:     amount,
+			DateUpdate: timestamp,
 		})
 
 		if timestamp.After(latestTimestamp) {
@@ -135,7 +141,7 @@ func (s *Storage) GetRate(ctx context.Context, currency string, date time.Time,
 	}
 
 	if len(fiatPrices) == 0 {
-		return nil, fmt.Errorf("%s: no rates found for currency %s", op, currency)
+		return nil, errors.Wrapf(entities.ErrNotFound, "%s: no rates found for currency %s", op, currency)
 	}
 
 	rate, err := entities.NewRate(cryptoCode, fiatPrices, latestTimestamp)
@@ -146,17 +152,17 @@ func (s *Storage) GetRate(ctx context.Context, currency string, date time.Time,
 	return rate, nil
 }
 
-func (s *Storage) GetAllRates(ctx context.Context, date time.Time, opts ...service.Option) ([]entities.ExchangeRate, error) {
+// GetAllRates is GetRate for every active crypto.
+func (s *Storage) GetAllRates(ctx context.Context, from, to time.Time, opts ...service.Option) ([]entities.ExchangeRate, error) {
 	const op = "storage.postgres.GetAllRates"
 
+	defer metrics.ObserveDBQuery("GetAllRates")()
+
 	options := &service.Options{}
 	for _, opt := range opts {
 		opt(options)
 	}
 
-	startOfDay := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, date.Location())
-	endOfDay := startOfDay.Add(24 * time.Hour)
-
 	var query string
 	var isAggregate bool
 
@@ -172,7 +178,7 @@ func (s *Storage) GetAllRates(ctx context.Context, date time.Time, opts ...servi
             FROM exchange_rates er
             JOIN cryptocurrencies c ON er.crypto_id = c.id
             JOIN fiat_currencies f ON er.fiat_id = f.id
-            WHERE er.timestamp BETWEEN $1 AND $2
+            WHERE c.active AND er.timestamp >= $1 AND er.timestamp < $2
             GROUP BY c.code, f.code
             ORDER BY crypto_code, fiat_code
         `, options.FuncType.String())
@@ -183,6 +189,7 @@ func (s *Storage) GetAllRates(ctx context.Context, date time.Time, opts ...servi
                 c.code as crypto_code,
                 array_agg(f.code) as fiat_codes,
                 array_agg(er.amount) as amounts,
+                array_agg(er.timestamp) as timestamps,
                 MAX(er.timestamp) as timestamp
             FROM (
                 SELECT 
@@ -192,17 +199,17 @@ func (s *Storage) GetAllRates(ctx context.Context, date time.Time, opts ...servi
                     timestamp,
                     ROW_NUMBER() OVER (PARTITION BY crypto_id, fiat_id ORDER BY timestamp DESC) as rn
                 FROM exchange_rates
-                WHERE timestamp BETWEEN $1 AND $2
+                WHERE timestamp >= $1 AND timestamp < $2
             ) er
             JOIN cryptocurrencies c ON er.crypto_id = c.id
             JOIN fiat_currencies f ON er.fiat_id = f.id
-            WHERE er.rn = 1
+            WHERE er.rn = 1 AND c.active
             GROUP BY c.code
             ORDER BY crypto_code
         `
 	}
 
-	rows, err := s.db.Query(ctx, query, startOfDay, endOfDay)
+	rows, err := s.db.Query(ctx, query, from, to)
 	if err != nil {
 		return nil, errors.Wrap(err, op)
 	}
@@ -224,8 +231,9 @@ func (s *Storage) GetAllRates(ctx context.Context, date time.Time, opts ...servi
 			for i := range rates {
 				if rates[i].Title == cryptoCode {
 					rates[i].FiatValues = append(rates[i].FiatValues, entities.FiatPrice{
-						Currency: fiatCode,
-						Amount:   amount,
+						Currency:   fiatCode,
+						Amount:     amount,
+						DateUpdate: timestamp,
 					})
 					if timestamp.After(rates[i].DateUpdate) {
 						rates[i].DateUpdate = timestamp
@@ -239,8 +247,9 @@ func (s *Storage) GetAllRates(ctx context.Context, date time.Time, opts ...servi
 				rates = append(rates, entities.ExchangeRate{
 					Title: cryptoCode,
 					FiatValues: []entities.FiatPrice{{
-						Currency: fiatCode,
-						Amount:   amount,
+						Currency:   fiatCode,
+						Amount:     amount,
+						DateUpdate: timestamp,
 					}},
 					DateUpdate: timestamp,
 				})
@@ -249,17 +258,19 @@ func (s *Storage) GetAllRates(ctx context.Context, date time.Time, opts ...servi
 			var cryptoCode string
 			var fiatCodes []string
 			var amounts []float64
+			var timestamps []time.Time
 			var timestamp time.Time
 
-			if err := rows.Scan(&cryptoCode, &fiatCodes, &amounts, &timestamp); err != nil {
+			if err := rows.Scan(&cryptoCode, &fiatCodes, &amounts, &timestamps, &timestamp); err != nil {
 				return nil, errors.Wrap(err, op)
 			}
 
 			fiatPrices := make([]entities.FiatPrice, len(fiatCodes))
 			for i := range fiatCodes {
 				fiatPrices[i] = entities.FiatPrice{
-					Currency: fiatCodes[i],
-					Amount:   amounts[i],
+					Currency:   fiatCodes[i],
+					Amount:     amounts[i],
+					DateUpdate: timestamps[i],
 				}
 			}
 
@@ -281,6 +292,8 @@ func (s *Storage) GetAllRates(ctx context.Context, date time.Time, opts ...servi
 func (s *Storage) ExistsRate(ctx context.Context, currency string) (bool, error) {
 	const op = "storage.postgres.ExistsRate"
 
+	defer metrics.ObserveDBQuery("ExistsRate")()
+
 	query := `SELECT EXISTS(SELECT 1 FROM cryptocurrencies WHERE code = $1)`
 
 	var exists bool
@@ -291,3 +304,50 @@ func (s *Storage) ExistsRate(ctx context.Context, currency string) (bool, error)
 
 	return exists, nil
 }
+
+// GetMaxAges returns the max age of every pair that has one, either of its
+// own or inherited from its crypto.
+func (s *Storage) GetMaxAges(ctx context.Context) (map[entities.Pair]time.Duration, error) {
+	const op = "storage.postgres.GetMaxAges"
+
+	defer metrics.ObserveDBQuery("GetMaxAges")()
+
+	rows, err := s.db.Query(ctx, `
+		SELECT c.code, f.code, COALESCE(p.max_age_sec, c.max_age_sec)
+		FROM cryptocurrencies c
+		CROSS JOIN fiat_currencies f
+		LEFT JOIN pair_max_ages p ON p.crypto_id = c.id AND p.fiat_id = f.id
+		WHERE COALESCE(p.max_age_sec, c.max_age_sec) IS NOT NULL`)
+	if err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+	defer rows.Close()
+
+	maxAges := make(map[entities.Pair]time.Duration)
+	for rows.Next() {
+		var pair entities.Pair
+		var seconds int
+
+		if err = rows.Scan(&pair.Crypto, &pair.Fiat, &seconds); err != nil {
+			return nil, errors.Wrap(err, op)
+		}
+
+		maxAges[pair] = time.Duration(seconds) * time.Second
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+
+	return maxAges, nil
+}
+
+func (s *Storage) Ping(ctx context.Context) error {
+	const op = "storage.postgres.Ping"
+
+	if err := s.db.Ping(ctx); err != nil {
+		return errors.Wrap(err, op)
+	}
+
+	return nil
+}
@@ -0,0 +1,71 @@
+package postgres
+
+import (
+	"context"
+	"github.com/langowen/exchange/internal/entities"
+	"github.com/langowen/exchange/internal/metrics"
+	"github.com/pkg/errors"
+	"time"
+)
+
+// GetRateStats computes the statistics of every fiat of currency over the
+// rates saved within [from, to).
+func (s *Storage) GetRateStats(ctx context.Context, currency string, from, to time.Time) ([]entities.FiatStats, error) {
+	const op = "storage.postgres.GetRateStats"
+
+	defer metrics.ObserveDBQuery("GetRateStats")()
+
+	query := `
+        WITH samples AS (
+            SELECT f.code AS fiat_code, er.amount::float8 AS amount, er.timestamp,
+                LEAD(er.timestamp) OVER (PARTITION BY er.fiat_id ORDER BY er.timestamp) AS next_timestamp
+            FROM exchange_rates er
+            JOIN cryptocurrencies c ON er.crypto_id = c.id
+            JOIN fiat_currencies f ON er.fiat_id = f.id
+            WHERE c.code = $1 AND er.timestamp >= $2 AND er.timestamp < $3
+        )
+        SELECT fiat_code,
+            (ARRAY_AGG(amount ORDER BY timestamp DESC))[1] AS current,
+            MAX(timestamp) AS current_at,
+            (ARRAY_AGG(amount ORDER BY timestamp))[1] AS open,
+            MIN(timestamp) AS open_at,
+            MAX(amount) AS high,
+            MIN(amount) AS low,
+            AVG(amount) AS avg,
+            COALESCE(
+                SUM(amount * EXTRACT(EPOCH FROM next_timestamp - timestamp))
+                    / NULLIF(EXTRACT(EPOCH FROM MAX(timestamp) - MIN(timestamp)), 0),
+                AVG(amount)
+            )::float8 AS twap,
+            COALESCE(STDDEV_SAMP(amount), 0) AS stddev,
+            COUNT(*) AS count
+        FROM samples
+        GROUP BY fiat_code
+        ORDER BY fiat_code
+    `
+
+	rows, err := s.db.Query(ctx, query, currency, from, to)
+	if err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+	defer rows.Close()
+
+	stats := make([]entities.FiatStats, 0)
+	for rows.Next() {
+		var st entities.FiatStats
+
+		err = rows.Scan(&st.Currency, &st.Current, &st.CurrentAt, &st.Open, &st.OpenAt,
+			&st.High, &st.Low, &st.Avg, &st.TWAP, &st.StdDev, &st.Count)
+		if err != nil {
+			return nil, errors.Wrap(err, op)
+		}
+
+		stats = append(stats, st)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+
+	return stats, nil
+}
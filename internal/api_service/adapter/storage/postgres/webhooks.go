@@ -0,0 +1,217 @@
+package postgres
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5"
+	"github.com/langowen/exchange/internal/entities"
+	"github.com/langowen/exchange/internal/metrics"
+	"github.com/pkg/errors"
+	"time"
+)
+
+// Webhooks are filtered by owner with ($2 = 0 OR api_key_id = $2): a zero
+// apiKeyID matches every webhook.
+
+const webhookColumns = `id, COALESCE(api_key_id, 0), url, crypto, fiat, condition, threshold, COALESCE(window_sec, 0), last_fired_at, created_at`
+
+func scanWebhook(row pgx.Row) (*entities.Webhook, error) {
+	var (
+		hook      entities.Webhook
+		windowSec int
+	)
+
+	err := row.Scan(&hook.ID, &hook.APIKeyID, &hook.URL, &hook.Crypto, &hook.Fiat, &hook.Condition,
+		&hook.Threshold, &windowSec, &hook.LastFiredAt, &hook.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	hook.Window = time.Duration(windowSec) * time.Second
+
+	return &hook, nil
+}
+
+func (s *Storage) CreateWebhook(ctx context.Context, hook *entities.Webhook) error {
+	const op = "storage.postgres.CreateWebhook"
+
+	defer metrics.ObserveDBQuery("CreateWebhook")()
+
+	query := `
+        INSERT INTO webhooks (api_key_id, url, secret, crypto, fiat, condition, threshold, window_sec)
+        VALUES (NULLIF($1, 0), $2, $3, $4, $5, $6, $7, NULLIF($8, 0))
+        RETURNING id, created_at
+    `
+
+	err := s.db.QueryRow(ctx, query,
+		hook.APIKeyID,
+		hook.URL,
+		hook.Secret,
+		hook.Crypto,
+		hook.Fiat,
+		hook.Condition,
+		hook.Threshold,
+		int(hook.Window/time.Second),
+	).Scan(&hook.ID, &hook.CreatedAt)
+	if err != nil {
+		return errors.Wrap(err, op)
+	}
+
+	return nil
+}
+
+func (s *Storage) ListWebhooks(ctx context.Context, apiKeyID int) ([]entities.Webhook, error) {
+	const op = "storage.postgres.ListWebhooks"
+
+	defer metrics.ObserveDBQuery("ListWebhooks")()
+
+	rows, err := s.db.Query(ctx, `
+        SELECT `+webhookColumns+`
+        FROM webhooks
+        WHERE $1 = 0 OR api_key_id = $1
+        ORDER BY id
+    `, apiKeyID)
+	if err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+	defer rows.Close()
+
+	hooks := make([]entities.Webhook, 0)
+	for rows.Next() {
+		hook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, op)
+		}
+		hooks = append(hooks, *hook)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+
+	return hooks, nil
+}
+
+func (s *Storage) GetWebhook(ctx context.Context, id int64, apiKeyID int) (*entities.Webhook, error) {
+	const op = "storage.postgres.GetWebhook"
+
+	defer metrics.ObserveDBQuery("GetWebhook")()
+
+	row := s.db.QueryRow(ctx, `
+        SELECT `+webhookColumns+`
+        FROM webhooks
+        WHERE id = $1 AND ($2 = 0 OR api_key_id = $2)
+    `, id, apiKeyID)
+
+	hook, err := scanWebhook(row)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, entities.ErrNotFound
+		}
+		return nil, errors.Wrap(err, op)
+	}
+
+	return hook, nil
+}
+
+// DeleteWebhook drops the webhook together with its pending deliveries and
+// dead letters.
+func (s *Storage) DeleteWebhook(ctx context.Context, id int64, apiKeyID int) error {
+	const op = "storage.postgres.DeleteWebhook"
+
+	defer metrics.ObserveDBQuery("DeleteWebhook")()
+
+	tag, err := s.db.Exec(ctx, `DELETE FROM webhooks WHERE id = $1 AND ($2 = 0 OR api_key_id = $2)`, id, apiKeyID)
+	if err != nil {
+		return errors.Wrap(err, op)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return entities.ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *Storage) ListWebhookDeadLetters(ctx context.Context, webhookID int64, limit int) ([]entities.WebhookDelivery, error) {
+	const op = "storage.postgres.ListWebhookDeadLetters"
+
+	defer metrics.ObserveDBQuery("ListWebhookDeadLetters")()
+
+	rows, err := s.db.Query(ctx, `
+        SELECT id, webhook_id, event_id, payload, attempts, COALESCE(last_error, ''), created_at, failed_at
+        FROM webhook_dead_letters
+        WHERE webhook_id = $1
+        ORDER BY id DESC
+        LIMIT $2
+    `, webhookID, limit)
+	if err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+	defer rows.Close()
+
+	letters := make([]entities.WebhookDelivery, 0)
+	for rows.Next() {
+		var letter entities.WebhookDelivery
+		err = rows.Scan(&letter.ID, &letter.WebhookID, &letter.EventID, &letter.Payload, &letter.Attempts,
+			&letter.LastError, &letter.CreatedAt, &letter.FailedAt)
+		if err != nil {
+			return nil, errors.Wrap(err, op)
+		}
+		letters = append(letters, letter)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+
+	return letters, nil
+}
+
+// RedeliverWebhookDeadLetter moves a dead letter back to the delivery queue
+// with a fresh attempt budget.
+func (s *Storage) RedeliverWebhookDeadLetter(ctx context.Context, webhookID, letterID int64) (err error) {
+	const op = "storage.postgres.RedeliverWebhookDeadLetter"
+
+	defer metrics.ObserveDBQuery("RedeliverWebhookDeadLetter")()
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return errors.Wrap(err, op)
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback(ctx)
+		}
+	}()
+
+	var (
+		eventID string
+		payload []byte
+	)
+	err = tx.QueryRow(ctx, `
+        DELETE FROM webhook_dead_letters
+        WHERE id = $1 AND webhook_id = $2
+        RETURNING event_id, payload
+    `, letterID, webhookID).Scan(&eventID, &payload)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return entities.ErrNotFound
+		}
+		return errors.Wrap(err, op)
+	}
+
+	_, err = tx.Exec(ctx, `
+        INSERT INTO webhook_deliveries (webhook_id, event_id, payload)
+        VALUES ($1, $2, $3)
+        ON CONFLICT (webhook_id, event_id)
+        DO UPDATE SET attempts = 0, last_error = NULL, next_attempt_at = NOW()
+    `, webhookID, eventID, payload)
+	if err != nil {
+		return errors.Wrap(err, op)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return errors.Wrap(err, op)
+	}
+
+	return nil
+}
@@ -0,0 +1,94 @@
+package redis
+
+import (
+	"context"
+	"github.com/langowen/exchange/internal/entities"
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+	"math"
+	"time"
+)
+
+// tokenBucket refills continuously at limit/period tokens per millisecond and
+// holds at most limit tokens. Redis TIME is used as the clock so that every
+// api_service replica sees the same bucket.
+var tokenBucket = redis.NewScript(`
+local key = KEYS[1]
+local limit = tonumber(ARGV[1])
+local period = tonumber(ARGV[2])
+
+local now = redis.call('TIME')
+now = tonumber(now[1]) * 1000 + math.floor(tonumber(now[2]) / 1000)
+
+local state = redis.call('HMGET', key, 'tokens', 'ts')
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2])
+if tokens == nil then
+    tokens = limit
+    ts = now
+end
+
+local rate = limit / period
+tokens = math.min(limit, tokens + math.max(0, now - ts) * rate)
+
+local allowed = 0
+if tokens >= 1 then
+    tokens = tokens - 1
+    allowed = 1
+end
+
+redis.call('HSET', key, 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', key, period)
+
+local retry = 0
+if allowed == 0 then
+    retry = math.ceil((1 - tokens) / rate)
+end
+local reset = math.ceil((limit - tokens) / rate)
+
+return {allowed, math.floor(tokens), retry, reset}
+`)
+
+func (s *Storage) TakeToken(ctx context.Context, bucket string, limit int, period time.Duration) (*entities.RateLimit, error) {
+	const op = "storage.redis.TakeToken"
+
+	res, err := tokenBucket.Run(ctx, s.rdb, []string{"ratelimit:" + bucket}, limit, period.Milliseconds()).Int64Slice()
+	if err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+
+	if len(res) != 4 {
+		return nil, errors.Errorf("%s: unexpected script result %v", op, res)
+	}
+
+	return &entities.RateLimit{
+		Allowed:    res[0] == 1,
+		Limit:      limit,
+		Remaining:  int(math.Max(0, float64(res[1]))),
+		RetryAfter: time.Duration(res[2]) * time.Millisecond,
+		Reset:      time.Duration(res[3]) * time.Millisecond,
+	}, nil
+}
+
+// fixedWindow starts the window with the first event. It stands in for
+// INCR plus EXPIRE NX, which needs Redis 7.
+var fixedWindow = redis.NewScript(`
+local count = redis.call('INCR', KEYS[1])
+if count == 1 then
+    redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return count
+`)
+
+// Increment counts an event in a fixed window that starts with the first
+// event, and returns the count so far.
+func (s *Storage) Increment(ctx context.Context, counter string, window time.Duration) (int64, error) {
+	const op = "storage.redis.Increment"
+
+	count, err := fixedWindow.Run(ctx, s.rdb, []string{"counter:" + counter}, window.Milliseconds()).Int64()
+	if err != nil {
+		return 0, errors.Wrap(err, op)
+	}
+
+	return count, nil
+}
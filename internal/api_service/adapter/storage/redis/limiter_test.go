@@ -0,0 +1,76 @@
+package redis
+
+import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"testing"
+	"time"
+)
+
+func newStorage(t *testing.T) (*Storage, *miniredis.Miniredis) {
+	t.Helper()
+
+	srv := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: srv.Addr()})
+	t.Cleanup(func() {
+		_ = client.Close()
+	})
+
+	return NewStorage(client), srv
+}
+
+func TestIncrement(t *testing.T) {
+	s, srv := newStorage(t)
+	ctx := context.Background()
+
+	for want := int64(1); want <= 3; want++ {
+		got, err := s.Increment(ctx, "registrations:ip:10.0.0.1", time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Fatalf("Increment = %d, want %d", got, want)
+		}
+
+		srv.FastForward(10 * time.Minute)
+	}
+
+	// Later events must not push the end of the window back.
+	if ttl := srv.TTL("counter:registrations:ip:10.0.0.1"); ttl != 30*time.Minute {
+		t.Errorf("TTL = %v, want 30m left of the window", ttl)
+	}
+
+	srv.FastForward(30 * time.Minute)
+
+	got, err := s.Increment(ctx, "registrations:ip:10.0.0.1", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != 1 {
+		t.Errorf("Increment after the window = %d, want 1", got)
+	}
+}
+
+func TestTakeToken(t *testing.T) {
+	s, _ := newStorage(t)
+	ctx := context.Background()
+
+	for i := range 2 {
+		res, err := s.TakeToken(ctx, "key:1", 2, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !res.Allowed || res.Remaining != 1-i {
+			t.Fatalf("take %d: got %+v, want allowed with %d remaining", i+1, res, 1-i)
+		}
+	}
+
+	res, err := s.TakeToken(ctx, "key:1", 2, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Allowed || res.RetryAfter <= 0 {
+		t.Errorf("got %+v, want a rejection with a retry delay", res)
+	}
+}
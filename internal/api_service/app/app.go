@@ -2,24 +2,36 @@ package fetcherApp
 
 import (
 	"context"
-	"fmt"
 	"github.com/langowen/exchange/deploy/config"
+	"github.com/langowen/exchange/internal/api_service/adapter/events"
+	"github.com/langowen/exchange/internal/api_service/adapter/storage/memory"
 	"github.com/langowen/exchange/internal/api_service/adapter/storage/postgres"
 	"github.com/langowen/exchange/internal/api_service/adapter/storage/redis"
 	"github.com/langowen/exchange/internal/api_service/ports/http/public"
 	"github.com/langowen/exchange/internal/api_service/service"
+	"github.com/langowen/exchange/internal/entities"
+	"github.com/langowen/exchange/internal/eventbus"
+	"github.com/langowen/exchange/internal/eventbus/natsbus"
+	"github.com/langowen/exchange/internal/eventbus/redisbus"
+	"github.com/langowen/exchange/internal/health"
+	"github.com/langowen/exchange/internal/redisclient"
+	"github.com/langowen/exchange/internal/tlsconfig"
+	"github.com/langowen/exchange/internal/tracing"
+	"github.com/nats-io/nats.go"
 	redisPack "github.com/redis/go-redis/v9"
-	"log"
 	"log/slog"
 	"os"
 )
 
 type FetcherApp struct {
-	cfg *config.Config
+	cfg        *config.ApiConfig
+	configPath string
+	logLevel   slog.LevelVar
 }
 
-func NewFetcherApp(cfg *config.Config) *FetcherApp {
-	return &FetcherApp{cfg: cfg}
+// NewFetcherApp creates the app. configPath is the file re-read on SIGHUP, if any.
+func NewFetcherApp(cfg *config.ApiConfig, configPath string) *FetcherApp {
+	return &FetcherApp{cfg: cfg, configPath: configPath}
 }
 
 func (f *FetcherApp) Start(ctx context.Context) <-chan struct{} {
@@ -28,75 +40,230 @@ func (f *FetcherApp) Start(ctx context.Context) <-chan struct{} {
 
 	slog.With("config", f.cfg).Info("starting server")
 
+	shutdownTracing := f.initTracing(ctx)
+	slog.Info("Tracing initialized", "exporter", f.cfg.Tracing.Exporter)
+
 	pgStorage := f.initDatabase(ctx)
 	slog.Info("Storage initialized")
 
-	rdStorage := f.initRedis(ctx)
-	slog.Info("Redis client initialized")
+	rdStorage, rdClient := f.initRedis(ctx)
 
-	apiService := f.initService(pgStorage, rdStorage)
+	bus := f.initEventBus(ctx, rdClient)
+	slog.Info("Event bus initialized", "backend", f.cfg.Events.Backend)
+
+	apiService := f.initService(ctx, pgStorage, bus, f.initLimiter(rdStorage))
 	slog.Info("Service initialized")
 
-	serverDone := f.StartServer(ctx, apiService)
+	f.initReload(ctx, apiService)
+
+	f.initAuth(ctx, apiService)
+
+	checker := f.initHealth(pgStorage, rdStorage)
+
+	serverDone := f.StartServer(ctx, apiService, checker)
 	slog.Info("server started")
 
-	return serverDone
+	done := make(chan struct{})
+	go func() {
+		<-serverDone
+		if err := bus.Close(); err != nil {
+			slog.Error("Failed to close event bus", "error", err)
+		}
+		if rdStorage != nil {
+			if err := rdStorage.Close(); err != nil {
+				slog.Error("Failed to close Redis client", "error", err)
+			}
+		}
+		shutdownTracing()
+		close(done)
+	}()
+
+	return done
+}
+
+func (f *FetcherApp) initTracing(ctx context.Context) func() {
+	shutdown, err := tracing.Init(ctx, f.cfg.Tracing, "api_service")
+	if err != nil {
+		fatal("Failed to initialize tracing", "error", err)
+	}
+
+	return func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), f.cfg.Shutdown.Timeout)
+		defer cancel()
+
+		if err := shutdown(shutdownCtx); err != nil {
+			slog.Error("Failed to flush traces", "error", err)
+		}
+	}
 }
 
 func (f *FetcherApp) initLogger() {
+	level, err := config.ParseLevel(f.cfg.Log.Level)
+	if err != nil {
+		fatal("Failed to parse log level", "error", err)
+	}
+	f.logLevel.Set(level)
+
 	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
-		Level:     slog.LevelDebug,
+		Level:     &f.logLevel,
 		AddSource: false,
 	}))
 	slog.SetDefault(logger)
 }
 
 func (f *FetcherApp) initDatabase(ctx context.Context) *postgres.Storage {
-
-	dsn := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s search_path=%s",
-		f.cfg.Storage.Host,
-		f.cfg.Storage.Port,
-		f.cfg.Storage.User,
-		f.cfg.Storage.Password,
-		f.cfg.Storage.DBName,
-		f.cfg.Storage.SSLMode,
-		f.cfg.Storage.Schema,
-	)
-
-	pgStorage, err := postgres.InitStorage(ctx, dsn)
+	pgStorage, err := postgres.InitStorage(ctx, f.cfg.Storage)
 	if err != nil {
-		log.Fatalln("Failed to initialize PostgresSQL storage", "error", err)
+		fatal("Failed to initialize PostgresSQL storage", "error", err)
 	}
 
 	return pgStorage
 }
 
-func (f *FetcherApp) initRedis(ctx context.Context) *redis.Storage {
-	options := &redisPack.Options{
-		Addr:     f.cfg.Redis.Host,
-		Password: f.cfg.Redis.Password,
-		DB:       f.cfg.Redis.DB,
+// initRedis connects to Redis, which the redis event bus requires and the rate
+// limits use when it is configured. It returns nils otherwise.
+func (f *FetcherApp) initRedis(ctx context.Context) (*redis.Storage, redisPack.UniversalClient) {
+	if f.cfg.Events.Backend != "redis" && !f.cfg.Redis.Configured() {
+		return nil, nil
+	}
+
+	client, err := redisclient.New(f.cfg.Redis)
+	if err != nil {
+		fatal("Failed to create Redis client", "error", err)
 	}
 
-	rdStorage, err := redis.InitStorage(ctx, options)
+	rdStorage, err := redis.InitStorage(ctx, client)
 	if err != nil {
-		log.Fatalln("Failed to initialize Redis storage", "error", err)
+		fatal("Failed to initialize Redis storage", "error", err)
 	}
+	slog.Info("Redis client initialized")
 
-	return rdStorage
+	return rdStorage, client
 }
 
-func (f *FetcherApp) initService(storage *postgres.Storage, redis *redis.Storage) *service.Service {
-	apiService, err := service.NewService(storage, redis)
+// initLimiter keeps API key rate limits and registration quotas in Redis, or
+// in memory of this replica when there is no Redis.
+func (f *FetcherApp) initLimiter(rdStorage *redis.Storage) service.RateLimiter {
+	if rdStorage != nil {
+		return rdStorage
+	}
+
+	slog.Warn("Redis is not configured, rate limits and registration quotas are kept per replica")
+
+	return memory.NewLimiter()
+}
+
+func (f *FetcherApp) initEventBus(ctx context.Context, client redisPack.UniversalClient) eventbus.EventBus {
+	cfg := f.cfg.Events
+
+	switch cfg.Backend {
+	case "redis":
+		return redisbus.New(client, cfg.ConsumerName(),
+			redisbus.WithMaxLen(cfg.MaxLen),
+			redisbus.WithClaimIdle(cfg.ClaimIdle),
+			redisbus.WithMaxDeliveries(cfg.MaxDeliveries),
+		)
+	case "nats":
+		opts := []nats.Option{nats.Name("api_service"), nats.MaxReconnects(-1)}
+		if cfg.NATS.Token != "" {
+			opts = append(opts, nats.Token(cfg.NATS.Token.Value()))
+		}
+
+		conn, err := nats.Connect(cfg.NATS.URL, opts...)
+		if err != nil {
+			fatal("Failed to connect to NATS", "error", err)
+		}
+
+		bus, err := natsbus.New(ctx, conn, cfg.MaxLen,
+			natsbus.WithStream(cfg.NATS.Stream, cfg.NATS.SubjectPrefix),
+			natsbus.WithAckWait(cfg.ClaimIdle),
+			natsbus.WithMaxDeliveries(cfg.MaxDeliveries),
+		)
+		if err != nil {
+			fatal("Failed to initialize NATS event bus", "error", err)
+		}
+
+		return bus
+	default:
+		fatal("Unknown event bus backend", "backend", cfg.Backend)
+		return nil
+	}
+}
+
+func (f *FetcherApp) initService(ctx context.Context, storage *postgres.Storage, bus eventbus.EventBus, limiter service.RateLimiter) *service.Service {
+	evts := events.New(bus)
+	go func() {
+		if err := evts.Run(ctx); err != nil {
+			slog.Error("Failed to consume rate updates", "error", err)
+		}
+	}()
+
+	apiService, err := service.NewService(storage, evts, limiter, f.cfg)
 	if err != nil {
-		log.Fatalln("Failed to initialize service rate", "error", err)
+		fatal("Failed to initialize service rate", "error", err)
 	}
 
 	return apiService
 }
 
-func (f *FetcherApp) StartServer(ctx context.Context, apiService *service.Service) <-chan struct{} {
-	serverDone := public.StartServer(ctx, apiService, f.cfg)
+func (f *FetcherApp) initAuth(ctx context.Context, apiService *service.Service) {
+	if !f.cfg.Auth.Enabled {
+		slog.Warn("API key authentication is disabled for the /rates routes, set AUTH_ENABLED=true once clients have keys")
+	}
+
+	if f.cfg.Auth.BootstrapAdminKey == "" {
+		return
+	}
+
+	if err := apiService.EnsureAPIKey(ctx, "bootstrap-admin", entities.ScopeAdmin, f.cfg.Auth.BootstrapAdminKey.Value()); err != nil {
+		fatal("Failed to register bootstrap admin key", "error", err)
+	}
+	slog.Info("Bootstrap admin key registered")
+}
+
+func (f *FetcherApp) initHealth(storage *postgres.Storage, redis *redis.Storage) *health.Checker {
+	checker := health.NewChecker()
+	checker.Add("postgres", storage.Ping)
+	if redis != nil {
+		checker.Add("redis", redis.Ping)
+	}
+
+	return checker
+}
+
+func (f *FetcherApp) StartServer(ctx context.Context, apiService *service.Service, checker *health.Checker) <-chan struct{} {
+	tlsConfig, err := tlsconfig.Server(f.cfg.HTTPServer.TLS)
+	if err != nil {
+		fatal("Failed to load HTTP TLS config", "error", err)
+	}
+
+	trustedProxies, err := f.cfg.HTTPServer.TrustedProxyPrefixes()
+	if err != nil {
+		fatal("Failed to parse trusted proxies", "error", err)
+	}
+
+	serverDone := public.StartServer(ctx, apiService, checker, f.cfg, tlsConfig, trustedProxies)
 
 	return serverDone
 }
+
+// initReload applies the safe subset of the config on SIGHUP.
+func (f *FetcherApp) initReload(ctx context.Context, apiService *service.Service) {
+	reloader := config.NewReloader(f.configPath, f.cfg)
+	reloader.Subscribe(func(cfg *config.ApiConfig) {
+		if level, err := config.ParseLevel(cfg.Log.Level); err == nil {
+			f.logLevel.Set(level)
+		}
+		if err := apiService.ApplyConfig(cfg); err != nil {
+			slog.Error("Failed to apply reloaded config", "error", err)
+			return
+		}
+	})
+	reloader.Watch(ctx)
+}
+
+// fatal logs the error the way the rest of the app does and exits.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
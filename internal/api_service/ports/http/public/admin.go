@@ -0,0 +1,208 @@
+package public
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/langowen/exchange/internal/entities"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type createAPIKeyRequest struct {
+	Name      string `json:"name"`
+	Scope     string `json:"scope"`
+	RateLimit int    `json:"rate_limit"`
+}
+
+type createAPIKeyResponse struct {
+	Key    string           `json:"key"`
+	APIKey *entities.APIKey `json:"api_key"`
+}
+
+func (s *Server) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := s.Service.ListAPIKeys(r.Context())
+	if err != nil {
+		s.respondAdminError(w, r, "Failed to list API keys", err)
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, keys)
+}
+
+func (s *Server) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	var req createAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		RespondWithError(w, http.StatusBadRequest, "invalid request body", err.Error())
+		return
+	}
+
+	if req.Scope == "" {
+		req.Scope = entities.ScopePublic
+	}
+
+	rawKey, key, err := s.Service.CreateAPIKey(r.Context(), req.Name, req.Scope, req.RateLimit)
+	if err != nil {
+		s.respondAdminError(w, r, "Failed to create API key", err)
+		return
+	}
+
+	RespondWithJSON(w, http.StatusCreated, createAPIKeyResponse{Key: rawKey, APIKey: key})
+}
+
+func (s *Server) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "invalid key id")
+		return
+	}
+
+	if err = s.Service.RevokeAPIKey(r.Context(), id); err != nil {
+		s.respondAdminError(w, r, "Failed to revoke API key", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type renameCurrencyRequest struct {
+	Code string `json:"code"`
+}
+
+func (s *Server) ListCurrencies(w http.ResponseWriter, r *http.Request) {
+	currencies, err := s.Service.ListCurrencies(r.Context())
+	if err != nil {
+		s.respondAdminError(w, r, "Failed to list currencies", err)
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, currencies)
+}
+
+func (s *Server) DisableCurrency(w http.ResponseWriter, r *http.Request) {
+	if err := s.Service.DisableCurrency(r.Context(), chi.URLParam(r, "code")); err != nil {
+		s.respondAdminError(w, r, "Failed to disable currency", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) EnableCurrency(w http.ResponseWriter, r *http.Request) {
+	if err := s.Service.EnableCurrency(r.Context(), chi.URLParam(r, "code")); err != nil {
+		s.respondAdminError(w, r, "Failed to enable currency", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) RenameCurrency(w http.ResponseWriter, r *http.Request) {
+	var req renameCurrencyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		RespondWithError(w, http.StatusBadRequest, "invalid request body", err.Error())
+		return
+	}
+
+	if err := s.Service.RenameCurrency(r.Context(), chi.URLParam(r, "code"), req.Code); err != nil {
+		s.respondAdminError(w, r, "Failed to rename currency", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) DeleteCurrency(w http.ResponseWriter, r *http.Request) {
+	if err := s.Service.DeleteCurrency(r.Context(), chi.URLParam(r, "code")); err != nil {
+		s.respondAdminError(w, r, "Failed to delete currency", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type auditResponse struct {
+	Entries []entities.AuditEntry `json:"entries"`
+	Total   int                   `json:"total"`
+	Limit   int                   `json:"limit"`
+	Offset  int                   `json:"offset"`
+}
+
+// ListAuditEntries supports filtering by actor, action, target and a
+// [from, to) time range in RFC 3339, with limit/offset pagination.
+func (s *Server) ListAuditEntries(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	filter := entities.AuditFilter{
+		Actor:  q.Get("actor"),
+		Action: q.Get("action"),
+		Target: q.Get("target"),
+	}
+
+	var err error
+	if filter.From, err = parseTimeParam(q.Get("from")); err != nil {
+		RespondWithError(w, http.StatusBadRequest, "invalid from parameter", err.Error())
+		return
+	}
+	if filter.To, err = parseTimeParam(q.Get("to")); err != nil {
+		RespondWithError(w, http.StatusBadRequest, "invalid to parameter", err.Error())
+		return
+	}
+	if filter.Limit, err = parseIntParam(q.Get("limit")); err != nil {
+		RespondWithError(w, http.StatusBadRequest, "invalid limit parameter", err.Error())
+		return
+	}
+	if filter.Offset, err = parseIntParam(q.Get("offset")); err != nil {
+		RespondWithError(w, http.StatusBadRequest, "invalid offset parameter", err.Error())
+		return
+	}
+
+	entries, total, err := s.Service.ListAuditEntries(r.Context(), filter)
+	if err != nil {
+		s.respondAdminError(w, r, "Failed to list audit entries", err)
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, auditResponse{
+		Entries: entries,
+		Total:   total,
+		Limit:   filter.Limit,
+		Offset:  filter.Offset,
+	})
+}
+
+func parseTimeParam(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	return time.Parse(time.RFC3339, value)
+}
+
+func parseIntParam(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	return strconv.Atoi(value)
+}
+
+func (s *Server) respondAdminError(w http.ResponseWriter, r *http.Request, msg string, err error) {
+	switch {
+	case errors.Is(err, entities.ErrNotFound):
+		RespondWithError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, entities.ErrInvalidArgument):
+		RespondWithError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, entities.ErrAlreadyExists):
+		RespondWithError(w, http.StatusConflict, err.Error())
+	default:
+		slog.Error(msg,
+			"requestID", middleware.GetReqID(r.Context()),
+			"error", err.Error(),
+		)
+		RespondWithError(w, http.StatusInternalServerError, msg)
+	}
+}
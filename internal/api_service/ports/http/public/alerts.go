@@ -0,0 +1,212 @@
+package public
+
+import (
+	"encoding/json"
+	"github.com/go-chi/chi/v5"
+	"github.com/langowen/exchange/internal/entities"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type alertRuleRequest struct {
+	Crypto    string  `json:"crypto"`
+	Fiat      string  `json:"fiat"`
+	Operator  string  `json:"operator"`
+	Threshold float64 `json:"threshold"`
+	Cooldown  string  `json:"cooldown"`
+	Channel   string  `json:"channel"`
+	WebhookID int64   `json:"webhook_id"`
+	Active    *bool   `json:"active"`
+}
+
+type alertFiringsResponse struct {
+	Firings []entities.AlertFiring `json:"firings"`
+	Total   int                    `json:"total"`
+	Limit   int                    `json:"limit"`
+	Offset  int                    `json:"offset"`
+}
+
+// decodeAlertRule reads a rule from the body. Rules are active unless the
+// body says otherwise.
+func decodeAlertRule(w http.ResponseWriter, r *http.Request) (*entities.AlertRule, bool) {
+	var req alertRuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		RespondWithError(w, http.StatusBadRequest, "invalid request body", err.Error())
+		return nil, false
+	}
+
+	rule := &entities.AlertRule{
+		Crypto:    req.Crypto,
+		Fiat:      req.Fiat,
+		Operator:  req.Operator,
+		Threshold: req.Threshold,
+		Channel:   req.Channel,
+		WebhookID: req.WebhookID,
+		Active:    req.Active == nil || *req.Active,
+	}
+
+	if req.Cooldown != "" {
+		cooldown, err := time.ParseDuration(req.Cooldown)
+		if err != nil {
+			RespondWithError(w, http.StatusBadRequest, "invalid cooldown", err.Error())
+			return nil, false
+		}
+		rule.Cooldown = cooldown
+	}
+
+	return rule, true
+}
+
+func (s *Server) CreateAlertRule(w http.ResponseWriter, r *http.Request) {
+	rule, ok := decodeAlertRule(w, r)
+	if !ok {
+		return
+	}
+	owner, _, ok := requireOwner(w, r)
+	if !ok {
+		return
+	}
+
+	if err := s.Service.CreateAlertRule(r.Context(), owner, rule); err != nil {
+		s.respondAdminError(w, r, "Failed to create alert rule", err)
+		return
+	}
+
+	RespondWithJSON(w, http.StatusCreated, rule)
+}
+
+func (s *Server) ListAlertRules(w http.ResponseWriter, r *http.Request) {
+	_, filter, ok := requireOwner(w, r)
+	if !ok {
+		return
+	}
+
+	rules, err := s.Service.ListAlertRules(r.Context(), filter)
+	if err != nil {
+		s.respondAdminError(w, r, "Failed to list alert rules", err)
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, rules)
+}
+
+func (s *Server) GetAlertRule(w http.ResponseWriter, r *http.Request) {
+	id, ok := alertRuleID(w, r)
+	if !ok {
+		return
+	}
+	_, filter, ok := requireOwner(w, r)
+	if !ok {
+		return
+	}
+
+	rule, err := s.Service.GetAlertRule(r.Context(), filter, id)
+	if err != nil {
+		s.respondAdminError(w, r, "Failed to get alert rule", err)
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, rule)
+}
+
+func (s *Server) UpdateAlertRule(w http.ResponseWriter, r *http.Request) {
+	id, ok := alertRuleID(w, r)
+	if !ok {
+		return
+	}
+
+	rule, ok := decodeAlertRule(w, r)
+	if !ok {
+		return
+	}
+	rule.ID = id
+	_, filter, ok := requireOwner(w, r)
+	if !ok {
+		return
+	}
+
+	if err := s.Service.UpdateAlertRule(r.Context(), filter, rule); err != nil {
+		s.respondAdminError(w, r, "Failed to update alert rule", err)
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, rule)
+}
+
+func (s *Server) DeleteAlertRule(w http.ResponseWriter, r *http.Request) {
+	id, ok := alertRuleID(w, r)
+	if !ok {
+		return
+	}
+	_, filter, ok := requireOwner(w, r)
+	if !ok {
+		return
+	}
+
+	if err := s.Service.DeleteAlertRule(r.Context(), filter, id); err != nil {
+		s.respondAdminError(w, r, "Failed to delete alert rule", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListAlertFirings supports filtering by rule_id and a [from, to) time range
+// in RFC 3339, with limit/offset pagination. Newest firings come first.
+func (s *Server) ListAlertFirings(w http.ResponseWriter, r *http.Request) {
+	_, filter, ok := requireOwner(w, r)
+	if !ok {
+		return
+	}
+	q := r.URL.Query()
+
+	firingFilter := entities.AlertFiringFilter{APIKeyID: filter}
+
+	var err error
+	if ruleID := q.Get("rule_id"); ruleID != "" {
+		if firingFilter.RuleID, err = strconv.ParseInt(ruleID, 10, 64); err != nil {
+			RespondWithError(w, http.StatusBadRequest, "invalid rule_id parameter", err.Error())
+			return
+		}
+	}
+	if firingFilter.From, err = parseTimeParam(q.Get("from")); err != nil {
+		RespondWithError(w, http.StatusBadRequest, "invalid from parameter", err.Error())
+		return
+	}
+	if firingFilter.To, err = parseTimeParam(q.Get("to")); err != nil {
+		RespondWithError(w, http.StatusBadRequest, "invalid to parameter", err.Error())
+		return
+	}
+	if firingFilter.Limit, err = parseIntParam(q.Get("limit")); err != nil {
+		RespondWithError(w, http.StatusBadRequest, "invalid limit parameter", err.Error())
+		return
+	}
+	if firingFilter.Offset, err = parseIntParam(q.Get("offset")); err != nil {
+		RespondWithError(w, http.StatusBadRequest, "invalid offset parameter", err.Error())
+		return
+	}
+
+	firings, total, err := s.Service.ListAlertFirings(r.Context(), firingFilter)
+	if err != nil {
+		s.respondAdminError(w, r, "Failed to list alert firings", err)
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, alertFiringsResponse{
+		Firings: firings,
+		Total:   total,
+		Limit:   firingFilter.Limit,
+		Offset:  firingFilter.Offset,
+	})
+}
+
+func alertRuleID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "invalid alert rule id")
+		return 0, false
+	}
+
+	return id, true
+}
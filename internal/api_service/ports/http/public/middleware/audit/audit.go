@@ -0,0 +1,46 @@
+package audit
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/langowen/exchange/internal/api_service/ports/http/public/middleware/auth"
+	"github.com/langowen/exchange/internal/entities"
+)
+
+// New stores the request identity for the audit trail. It must run after the
+// auth middleware, whose API key becomes the actor.
+func New() func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+
+			actor := entities.ActorAnonymous
+			if key, ok := auth.FromContext(ctx); ok {
+				actor = fmt.Sprintf("api_key:%d:%s", key.ID, key.Name)
+			}
+
+			ctx = entities.WithRequestMeta(ctx, entities.RequestMeta{
+				Actor:     actor,
+				RequestID: middleware.GetReqID(ctx),
+				RemoteIP:  remoteIP(r.RemoteAddr),
+			})
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+// remoteIP strips the port that RemoteAddr carries unless realip replaced it.
+func remoteIP(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+
+	return host
+}
@@ -0,0 +1,106 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/langowen/exchange/internal/entities"
+)
+
+type Authenticator interface {
+	Authenticate(ctx context.Context, rawKey string) (*entities.APIKey, error)
+	Allow(ctx context.Context, key *entities.APIKey) (*entities.RateLimit, error)
+}
+
+type ctxKey struct{}
+
+// New authenticates requests by the X-API-Key header (or a Bearer token),
+// rejects keys outside of scope and applies the per-key rate limit.
+func New(auth Authenticator, scope string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		log := slog.With(
+			slog.String("component", "middleware/auth"),
+			slog.String("scope", scope),
+		)
+
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+
+			key, err := auth.Authenticate(ctx, rawKey(r))
+			if err != nil {
+				if errors.Is(err, entities.ErrUnauthorized) {
+					w.Header().Set("WWW-Authenticate", `Bearer realm="exchange"`)
+					http.Error(w, err.Error(), http.StatusUnauthorized)
+					return
+				}
+				log.Error("Failed to authenticate request",
+					"request_id", middleware.GetReqID(ctx),
+					"error", err.Error(),
+				)
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+
+			if !key.Allows(scope) {
+				http.Error(w, entities.ErrForbidden.Error(), http.StatusForbidden)
+				return
+			}
+
+			limit, err := auth.Allow(ctx, key)
+			if err != nil {
+				// Redis outages must not take the API down with them.
+				log.Error("Rate limiter unavailable, letting request through",
+					"request_id", middleware.GetReqID(ctx),
+					"key_id", key.ID,
+					"error", err.Error(),
+				)
+			} else {
+				setHeaders(w, limit)
+				if !limit.Allowed {
+					w.Header().Set("Retry-After", strconv.Itoa(seconds(limit.RetryAfter)))
+					http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(ctx, ctxKey{}, key)))
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+// FromContext returns the API key the request was authenticated with.
+func FromContext(ctx context.Context) (*entities.APIKey, bool) {
+	key, ok := ctx.Value(ctxKey{}).(*entities.APIKey)
+	return key, ok
+}
+
+func rawKey(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+
+	return ""
+}
+
+func setHeaders(w http.ResponseWriter, limit *entities.RateLimit) {
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(limit.Limit))
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(limit.Remaining))
+	w.Header().Set("X-RateLimit-Reset", strconv.Itoa(seconds(limit.Reset)))
+}
+
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
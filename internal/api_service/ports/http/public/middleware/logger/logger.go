@@ -18,7 +18,7 @@ func New() func(next http.Handler) http.Handler {
 		slog.Info("logger middleware enabled")
 
 		fn := func(w http.ResponseWriter, r *http.Request) {
-			if r.URL.Path == "/metrics" {
+			if isProbe(r.URL.Path) {
 				next.ServeHTTP(w, r)
 				return
 			}
@@ -55,3 +55,12 @@ func decodeURI(uri string) string {
 	}
 	return decoded
 }
+
+func isProbe(path string) bool {
+	switch path {
+	case "/metrics", "/healthz", "/readyz":
+		return true
+	default:
+		return false
+	}
+}
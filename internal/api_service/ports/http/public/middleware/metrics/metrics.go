@@ -0,0 +1,47 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/langowen/exchange/internal/metrics"
+)
+
+func New() func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+			t1 := time.Now()
+			defer func() {
+				metrics.HTTPRequestDuration.WithLabelValues(
+					r.Method,
+					routePattern(r),
+					strconv.Itoa(ww.Status()),
+				).Observe(time.Since(t1).Seconds())
+			}()
+
+			next.ServeHTTP(ww, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+// routePattern keeps label cardinality bounded: paths that did not match any
+// route are reported under a single label.
+func routePattern(r *http.Request) string {
+	rctx := chi.RouteContext(r.Context())
+	if rctx == nil {
+		return "unmatched"
+	}
+
+	if pattern := rctx.RoutePattern(); pattern != "" {
+		return pattern
+	}
+
+	return "unmatched"
+}
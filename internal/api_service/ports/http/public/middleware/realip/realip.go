@@ -0,0 +1,68 @@
+package realip
+
+import (
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// New takes the client address from X-Forwarded-For, True-Client-IP or
+// X-Real-IP, but only on requests coming from one of the trusted proxies.
+// Anyone else could otherwise pick the address recorded in the audit trail
+// and charged for the registration quota.
+func New(trusted []netip.Prefix) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			if ip, ok := clientIP(r, trusted); ok {
+				r.RemoteAddr = ip
+			}
+
+			next.ServeHTTP(w, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+func clientIP(r *http.Request, trusted []netip.Prefix) (string, bool) {
+	peer, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil || !isTrusted(peer.Addr(), trusted) {
+		return "", false
+	}
+
+	// Every proxy appends the address it got the request from, so the first
+	// untrusted hop from the right is the client. Hops further left were
+	// written by the client itself.
+	if values := r.Header.Values("X-Forwarded-For"); len(values) > 0 {
+		hops := strings.Split(strings.Join(values, ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+			if err != nil {
+				return "", false
+			}
+
+			if i == 0 || !isTrusted(addr, trusted) {
+				return addr.Unmap().String(), true
+			}
+		}
+	}
+
+	for _, header := range []string{"True-Client-IP", "X-Real-IP"} {
+		if addr, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get(header))); err == nil {
+			return addr.Unmap().String(), true
+		}
+	}
+
+	return "", false
+}
+
+func isTrusted(addr netip.Addr, trusted []netip.Prefix) bool {
+	addr = addr.Unmap()
+	for _, prefix := range trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
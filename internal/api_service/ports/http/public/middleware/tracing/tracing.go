@@ -0,0 +1,40 @@
+package tracing
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func New() func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r)
+
+			// The route is only known once chi has matched it, so the span is
+			// renamed after the handler returns.
+			rctx := chi.RouteContext(r.Context())
+			if rctx == nil || rctx.RoutePattern() == "" {
+				return
+			}
+
+			span := trace.SpanFromContext(r.Context())
+			span.SetName(r.Method + " " + rctx.RoutePattern())
+			span.SetAttributes(semconv.HTTPRoute(rctx.RoutePattern()))
+		}
+
+		return otelhttp.NewHandler(http.HandlerFunc(fn), "http.server",
+			otelhttp.WithFilter(func(r *http.Request) bool {
+				switch r.URL.Path {
+				case "/metrics", "/healthz", "/readyz":
+					return false
+				default:
+					return true
+				}
+			}),
+		)
+	}
+}
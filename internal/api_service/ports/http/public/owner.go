@@ -0,0 +1,26 @@
+package public
+
+import (
+	mwAuth "github.com/langowen/exchange/internal/api_service/ports/http/public/middleware/auth"
+	"github.com/langowen/exchange/internal/entities"
+	"net/http"
+)
+
+// requireOwner returns the API key that owns the webhooks and alert rules
+// created by the request, and the key to filter them by. Admin keys see
+// everything but own what they create. Requests without a key get a 401, never
+// the unfiltered view.
+func requireOwner(w http.ResponseWriter, r *http.Request) (owner, filter int, ok bool) {
+	key, ok := mwAuth.FromContext(r.Context())
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="exchange"`)
+		RespondWithError(w, http.StatusUnauthorized, entities.ErrUnauthorized.Error())
+		return 0, 0, false
+	}
+
+	if key.Scope == entities.ScopeAdmin {
+		return key.ID, 0, true
+	}
+
+	return key.ID, key.ID, true
+}
@@ -2,27 +2,36 @@ package public
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/langowen/exchange/deploy/config"
+	mwAudit "github.com/langowen/exchange/internal/api_service/ports/http/public/middleware/audit"
+	mwAuth "github.com/langowen/exchange/internal/api_service/ports/http/public/middleware/auth"
 	mwLogger "github.com/langowen/exchange/internal/api_service/ports/http/public/middleware/logger"
+	mwMetrics "github.com/langowen/exchange/internal/api_service/ports/http/public/middleware/metrics"
+	mwRealIP "github.com/langowen/exchange/internal/api_service/ports/http/public/middleware/realip"
+	mwTracing "github.com/langowen/exchange/internal/api_service/ports/http/public/middleware/tracing"
 	"github.com/langowen/exchange/internal/api_service/service"
 	"github.com/langowen/exchange/internal/entities"
+	"github.com/langowen/exchange/internal/health"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"log/slog"
 	"net/http"
-	"time"
+	"net/netip"
+	"strconv"
 )
 
 type Server struct {
 	Server  *http.Server
-	cfg     *config.Config
+	cfg     *config.ApiConfig
 	Service Service
 }
 
-func NewServer(server *http.Server, cfg *config.Config, service *service.Service) *Server {
+func NewServer(server *http.Server, cfg *config.ApiConfig, service *service.Service) *Server {
 	return &Server{
 		Server:  server,
 		cfg:     cfg,
@@ -30,16 +39,22 @@ func NewServer(server *http.Server, cfg *config.Config, service *service.Service
 	}
 }
 
-func StartServer(ctx context.Context, service *service.Service, cfg *config.Config) <-chan struct{} {
+// StartServer serves the API over HTTPS when tlsConfig is not nil. Client
+// address headers are only honoured from trustedProxies.
+func StartServer(ctx context.Context, service *service.Service, checker *health.Checker, cfg *config.ApiConfig, tlsConfig *tls.Config, trustedProxies []netip.Prefix) <-chan struct{} {
 
 	r := chi.NewRouter()
 
+	r.Use(mwTracing.New())
 	r.Use(middleware.RequestID)
-	r.Use(middleware.RealIP)
+	r.Use(mwRealIP.New(trustedProxies))
 	r.Use(mwLogger.New())
+	r.Use(mwMetrics.New())
 	r.Use(middleware.Recoverer)
 
 	r.Handle("/metrics", promhttp.Handler())
+	r.Get("/healthz", checker.Liveness)
+	r.Get("/readyz", checker.Readiness)
 
 	serverConfig := &http.Server{
 		Addr:         ":" + cfg.HTTPServer.Port,
@@ -47,25 +62,30 @@ func StartServer(ctx context.Context, service *service.Service, cfg *config.Conf
 		ReadTimeout:  cfg.HTTPServer.Timeout,
 		WriteTimeout: cfg.HTTPServer.Timeout,
 		IdleTimeout:  cfg.HTTPServer.IdleTimeout,
+		TLSConfig:    tlsConfig,
 	}
 
 	server := NewServer(serverConfig, cfg, service)
+	server.routes(r)
 
 	doneChan := make(chan struct{})
 
 	go func() {
-		if err := server.Server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		var err error
+		if tlsConfig != nil {
+			err = server.Server.ListenAndServeTLS("", "")
+		} else {
+			err = server.Server.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
 			slog.Error("Http server error", "error", err.Error())
 		}
 	}()
 
-	r.Get("/rates", server.GetAllRates)
-	r.Get("/rates/{cryptocurrency}", server.GetRateByCurrency)
-
 	go func() {
 		<-ctx.Done()
 
-		shutdownCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Shutdown.Timeout)
 		defer cancel()
 
 		if err := server.Server.Shutdown(shutdownCtx); err != nil {
@@ -78,23 +98,85 @@ func StartServer(ctx context.Context, service *service.Service, cfg *config.Conf
 	return doneChan
 }
 
+// routes mounts the API. Auth.Enabled only concerns the read-only rate
+// routes: webhooks and alert rules belong to an API key, and admin routes
+// need an admin key, so those always require authentication.
+func (s *Server) routes(r chi.Router) {
+	r.Group(func(r chi.Router) {
+		if s.cfg.Auth.Enabled {
+			r.Use(mwAuth.New(s.Service, entities.ScopePublic))
+		}
+		r.Use(mwAudit.New())
+
+		r.Get("/rates", s.GetAllRates)
+		r.Get("/rates/{cryptocurrency}", s.GetRateByCurrency)
+		r.Get("/rates/{cryptocurrency}/stats", s.GetRateStats)
+	})
+
+	r.Group(func(r chi.Router) {
+		r.Use(mwAuth.New(s.Service, entities.ScopePublic))
+		r.Use(mwAudit.New())
+
+		r.Get("/webhooks", s.ListWebhooks)
+		r.Post("/webhooks", s.CreateWebhook)
+		r.Get("/webhooks/{id}", s.GetWebhook)
+		r.Delete("/webhooks/{id}", s.DeleteWebhook)
+		r.Get("/webhooks/{id}/dead-letters", s.ListWebhookDeadLetters)
+		r.Post("/webhooks/{id}/dead-letters/{letterID}/redeliver", s.RedeliverWebhookDeadLetter)
+
+		r.Get("/alerts", s.ListAlertRules)
+		r.Post("/alerts", s.CreateAlertRule)
+		r.Get("/alerts/firings", s.ListAlertFirings)
+		r.Get("/alerts/{id}", s.GetAlertRule)
+		r.Put("/alerts/{id}", s.UpdateAlertRule)
+		r.Delete("/alerts/{id}", s.DeleteAlertRule)
+	})
+
+	r.Route("/admin", func(r chi.Router) {
+		r.Use(mwAuth.New(s.Service, entities.ScopeAdmin))
+		r.Use(mwAudit.New())
+
+		r.Get("/keys", s.ListAPIKeys)
+		r.Post("/keys", s.CreateAPIKey)
+		r.Delete("/keys/{id}", s.RevokeAPIKey)
+
+		r.Get("/currencies", s.ListCurrencies)
+		r.Post("/currencies/{code}/disable", s.DisableCurrency)
+		r.Post("/currencies/{code}/enable", s.EnableCurrency)
+		r.Patch("/currencies/{code}", s.RenameCurrency)
+		r.Delete("/currencies/{code}", s.DeleteCurrency)
+
+		r.Get("/audit", s.ListAuditEntries)
+	})
+}
+
 func (s *Server) GetAllRates(w http.ResponseWriter, r *http.Request) {
 	requestID := middleware.GetReqID(r.Context())
 
 	ctx := r.Context()
 
-	options := r.URL.Query().Get("option")
-
-	date := r.URL.Query().Get("date")
+	query, err := rateQuery(r)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 
-	rates, err := s.Service.GetAllRates(ctx, date, options)
+	rates, err := s.Service.GetAllRates(ctx, query)
 	if err != nil {
 		slog.Error("Failed to get all rates",
 			"requestID", requestID,
-			"options", options,
-			"date", date,
+			"options", query.Option,
+			"date", query.Date,
 			"error", err.Error(),
 		)
+		if errors.Is(err, entities.ErrInvalidArgument) {
+			RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if errors.Is(err, entities.ErrStaleRate) {
+			RespondWithError(w, http.StatusServiceUnavailable, "Курсы устарели, попробуйте позже", err.Error())
+			return
+		}
 		RespondWithError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
@@ -110,23 +192,45 @@ func (s *Server) GetRateByCurrency(w http.ResponseWriter, r *http.Request) {
 
 	currency := chi.URLParam(r, "cryptocurrency")
 
-	options := r.URL.Query().Get("option")
-
-	date := r.URL.Query().Get("date")
+	query, err := rateQuery(r)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 
-	rate, err := s.Service.GetRate(ctx, currency, date, options)
+	rate, err := s.Service.GetRate(ctx, currency, query)
 	if err != nil {
 		slog.Error("Failed to get rate",
 			"requestID", requestID,
 			"currency", currency,
-			"options", options,
-			"date", date,
+			"options", query.Option,
+			"date", query.Date,
 			"error", err.Error(),
 		)
+		if errors.Is(err, entities.ErrInvalidArgument) {
+			RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
 		if errors.Is(err, entities.ErrRedisTimeout) {
 			RespondWithError(w, http.StatusInternalServerError, "Не удалось получить курс по данной валюте, попробуйте позже")
 			return
 		}
+		if errors.Is(err, entities.ErrRateUnavailable) {
+			RespondWithError(w, http.StatusServiceUnavailable, "Курс по данной валюте пока недоступен, попробуйте позже", err.Error())
+			return
+		}
+		if errors.Is(err, entities.ErrStaleRate) {
+			RespondWithError(w, http.StatusServiceUnavailable, "Курс устарел, попробуйте позже", err.Error())
+			return
+		}
+		if errors.Is(err, entities.ErrRegistrationForbidden) {
+			RespondWithError(w, http.StatusForbidden, "Регистрация новой валюты запрещена", err.Error())
+			return
+		}
+		if errors.Is(err, entities.ErrNotFound) {
+			RespondWithError(w, http.StatusNotFound, "Валюта не найдена", err.Error())
+			return
+		}
 		RespondWithError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
@@ -134,6 +238,66 @@ func (s *Server) GetRateByCurrency(w http.ResponseWriter, r *http.Request) {
 	RespondWithJSON(w, http.StatusOK, rate)
 }
 
+// GetRateStats returns current, open, change, high, low, averages and
+// standard deviation per fiat over the range from rangeQuery, the last 24h by
+// default.
+func (s *Server) GetRateStats(w http.ResponseWriter, r *http.Request) {
+	currency := chi.URLParam(r, "cryptocurrency")
+
+	stats, err := s.Service.GetRateStats(r.Context(), currency, rangeQuery(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, entities.ErrInvalidArgument):
+			RespondWithError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, entities.ErrNotFound):
+			RespondWithError(w, http.StatusNotFound, "Валюта не найдена", err.Error())
+		default:
+			slog.Error("Failed to get rate stats",
+				"requestID", middleware.GetReqID(r.Context()),
+				"currency", currency,
+				"error", err.Error(),
+			)
+			RespondWithError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, stats)
+}
+
+// rateQuery reads the query parameters shared by the rate endpoints.
+// fresh=true asks for a 503 instead of stale latest rates; aggregates and
+// past ranges are never stale.
+func rateQuery(r *http.Request) (service.RateQuery, error) {
+	query := service.RateQuery{
+		RangeQuery: rangeQuery(r),
+		Option:     r.URL.Query().Get("option"),
+	}
+
+	if fresh := r.URL.Query().Get("fresh"); fresh != "" {
+		requireFresh, err := strconv.ParseBool(fresh)
+		if err != nil {
+			return query, fmt.Errorf("invalid fresh parameter: %q", fresh)
+		}
+		query.RequireFresh = requireFresh
+	}
+
+	return query, nil
+}
+
+// rangeQuery reads date, from, to, window and tz; see service.RangeQuery.
+func rangeQuery(r *http.Request) service.RangeQuery {
+	values := r.URL.Query()
+
+	return service.RangeQuery{
+		Date:   values.Get("date"),
+		From:   values.Get("from"),
+		To:     values.Get("to"),
+		Window: values.Get("window"),
+		TZ:     values.Get("tz"),
+	}
+}
+
 func RespondWithJSON(w http.ResponseWriter, code int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 
@@ -0,0 +1,107 @@
+package public
+
+import (
+	"context"
+	"github.com/go-chi/chi/v5"
+	"github.com/langowen/exchange/deploy/config"
+	"github.com/langowen/exchange/internal/entities"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const publicKey = "public-key"
+
+// fakeService authenticates publicKey as key 1 and records the filter the list
+// endpoints are called with. Other methods are not implemented.
+type fakeService struct {
+	Service
+	filter int
+}
+
+func (s *fakeService) Authenticate(_ context.Context, rawKey string) (*entities.APIKey, error) {
+	if rawKey != publicKey {
+		return nil, entities.ErrUnauthorized
+	}
+	return &entities.APIKey{ID: 1, Scope: entities.ScopePublic}, nil
+}
+
+func (s *fakeService) Allow(context.Context, *entities.APIKey) (*entities.RateLimit, error) {
+	return &entities.RateLimit{Allowed: true, Limit: 60, Remaining: 59}, nil
+}
+
+func (s *fakeService) ListWebhooks(_ context.Context, apiKeyID int) ([]entities.Webhook, error) {
+	s.filter = apiKeyID
+	return []entities.Webhook{}, nil
+}
+
+// newRouter mounts the API with authentication of the rate routes disabled,
+// the default.
+func newRouter(svc *fakeService) http.Handler {
+	server := &Server{cfg: &config.ApiConfig{}, Service: svc}
+
+	r := chi.NewRouter()
+	server.routes(r)
+
+	return r
+}
+
+func TestOwnedRoutesRequireAPIKey(t *testing.T) {
+	tests := []struct {
+		method string
+		path   string
+	}{
+		{method: http.MethodGet, path: "/webhooks"},
+		{method: http.MethodPost, path: "/webhooks"},
+		{method: http.MethodGet, path: "/webhooks/1"},
+		{method: http.MethodDelete, path: "/webhooks/1"},
+		{method: http.MethodGet, path: "/webhooks/1/dead-letters"},
+		{method: http.MethodPost, path: "/webhooks/1/dead-letters/1/redeliver"},
+		{method: http.MethodGet, path: "/alerts"},
+		{method: http.MethodPost, path: "/alerts"},
+		{method: http.MethodGet, path: "/alerts/firings"},
+		{method: http.MethodGet, path: "/alerts/1"},
+		{method: http.MethodPut, path: "/alerts/1"},
+		{method: http.MethodDelete, path: "/alerts/1"},
+	}
+
+	router := newRouter(&fakeService{})
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("%s %s without a key = %d, want 401", tt.method, tt.path, w.Code)
+		}
+	}
+}
+
+func TestOwnedRoutesFilterByAPIKey(t *testing.T) {
+	svc := &fakeService{filter: -1}
+
+	req := httptest.NewRequest(http.MethodGet, "/webhooks", nil)
+	req.Header.Set("X-API-Key", publicKey)
+
+	w := httptest.NewRecorder()
+	newRouter(svc).ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /webhooks = %d, want 200", w.Code)
+	}
+	if svc.filter != 1 {
+		t.Errorf("listed webhooks of key %d, want 1", svc.filter)
+	}
+}
+
+func TestRequireOwnerWithoutKey(t *testing.T) {
+	svc := &fakeService{filter: -1}
+	server := &Server{cfg: &config.ApiConfig{}, Service: svc}
+
+	w := httptest.NewRecorder()
+	server.ListWebhooks(w, httptest.NewRequest(http.MethodGet, "/webhooks", nil))
+
+	if w.Code != http.StatusUnauthorized || svc.filter != -1 {
+		t.Errorf("ListWebhooks without a key = %d with filter %d, want 401 before the service", w.Code, svc.filter)
+	}
+}
@@ -2,10 +2,40 @@ package public
 
 import (
 	"context"
+	"github.com/langowen/exchange/internal/api_service/service"
 	"github.com/langowen/exchange/internal/entities"
 )
 
 type Service interface {
-	GetRate(ctx context.Context, currency string, date string, options string) (rate *entities.ExchangeRate, err error)
-	GetAllRates(ctx context.Context, date string, options string) (rates []entities.ExchangeRate, err error)
+	GetRate(ctx context.Context, currency string, query service.RateQuery) (rate *entities.ExchangeRate, err error)
+	GetAllRates(ctx context.Context, query service.RateQuery) (rates []entities.ExchangeRate, err error)
+	GetRateStats(ctx context.Context, currency string, query service.RangeQuery) (*entities.RateStats, error)
+
+	Authenticate(ctx context.Context, rawKey string) (*entities.APIKey, error)
+	Allow(ctx context.Context, key *entities.APIKey) (*entities.RateLimit, error)
+	CreateAPIKey(ctx context.Context, name, scope string, rateLimit int) (string, *entities.APIKey, error)
+	ListAPIKeys(ctx context.Context) ([]entities.APIKey, error)
+	RevokeAPIKey(ctx context.Context, id int) error
+
+	ListCurrencies(ctx context.Context) ([]entities.Cryptocurrency, error)
+	DisableCurrency(ctx context.Context, code string) error
+	EnableCurrency(ctx context.Context, code string) error
+	RenameCurrency(ctx context.Context, code, newCode string) error
+	DeleteCurrency(ctx context.Context, code string) error
+
+	ListAuditEntries(ctx context.Context, filter entities.AuditFilter) ([]entities.AuditEntry, int, error)
+
+	CreateWebhook(ctx context.Context, apiKeyID int, hook *entities.Webhook) (string, error)
+	ListWebhooks(ctx context.Context, apiKeyID int) ([]entities.Webhook, error)
+	GetWebhook(ctx context.Context, apiKeyID int, id int64) (*entities.Webhook, error)
+	DeleteWebhook(ctx context.Context, apiKeyID int, id int64) error
+	ListWebhookDeadLetters(ctx context.Context, apiKeyID int, id int64) ([]entities.WebhookDelivery, error)
+	RedeliverWebhookDeadLetter(ctx context.Context, apiKeyID int, id, letterID int64) error
+
+	CreateAlertRule(ctx context.Context, apiKeyID int, rule *entities.AlertRule) error
+	ListAlertRules(ctx context.Context, apiKeyID int) ([]entities.AlertRule, error)
+	GetAlertRule(ctx context.Context, apiKeyID int, id int64) (*entities.AlertRule, error)
+	UpdateAlertRule(ctx context.Context, apiKeyID int, rule *entities.AlertRule) error
+	DeleteAlertRule(ctx context.Context, apiKeyID int, id int64) error
+	ListAlertFirings(ctx context.Context, filter entities.AlertFiringFilter) ([]entities.AlertFiring, int, error)
 }
@@ -0,0 +1,167 @@
+package public
+
+import (
+	"encoding/json"
+	"github.com/go-chi/chi/v5"
+	"github.com/langowen/exchange/internal/entities"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type createWebhookRequest struct {
+	URL       string  `json:"url"`
+	Crypto    string  `json:"crypto"`
+	Fiat      string  `json:"fiat"`
+	Condition string  `json:"condition"`
+	Threshold float64 `json:"threshold"`
+	Window    string  `json:"window"`
+}
+
+type createWebhookResponse struct {
+	Secret  string            `json:"secret"`
+	Webhook *entities.Webhook `json:"webhook"`
+}
+
+func (s *Server) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var req createWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		RespondWithError(w, http.StatusBadRequest, "invalid request body", err.Error())
+		return
+	}
+
+	hook := &entities.Webhook{
+		URL:       req.URL,
+		Crypto:    req.Crypto,
+		Fiat:      req.Fiat,
+		Condition: req.Condition,
+		Threshold: req.Threshold,
+	}
+
+	if req.Window != "" {
+		window, err := time.ParseDuration(req.Window)
+		if err != nil {
+			RespondWithError(w, http.StatusBadRequest, "invalid window", err.Error())
+			return
+		}
+		hook.Window = window
+	}
+
+	owner, _, ok := requireOwner(w, r)
+	if !ok {
+		return
+	}
+
+	secret, err := s.Service.CreateWebhook(r.Context(), owner, hook)
+	if err != nil {
+		s.respondAdminError(w, r, "Failed to create webhook", err)
+		return
+	}
+
+	RespondWithJSON(w, http.StatusCreated, createWebhookResponse{Secret: secret, Webhook: hook})
+}
+
+func (s *Server) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	_, filter, ok := requireOwner(w, r)
+	if !ok {
+		return
+	}
+
+	hooks, err := s.Service.ListWebhooks(r.Context(), filter)
+	if err != nil {
+		s.respondAdminError(w, r, "Failed to list webhooks", err)
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, hooks)
+}
+
+func (s *Server) GetWebhook(w http.ResponseWriter, r *http.Request) {
+	id, ok := webhookID(w, r)
+	if !ok {
+		return
+	}
+	_, filter, ok := requireOwner(w, r)
+	if !ok {
+		return
+	}
+
+	hook, err := s.Service.GetWebhook(r.Context(), filter, id)
+	if err != nil {
+		s.respondAdminError(w, r, "Failed to get webhook", err)
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, hook)
+}
+
+func (s *Server) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id, ok := webhookID(w, r)
+	if !ok {
+		return
+	}
+	_, filter, ok := requireOwner(w, r)
+	if !ok {
+		return
+	}
+
+	if err := s.Service.DeleteWebhook(r.Context(), filter, id); err != nil {
+		s.respondAdminError(w, r, "Failed to delete webhook", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) ListWebhookDeadLetters(w http.ResponseWriter, r *http.Request) {
+	id, ok := webhookID(w, r)
+	if !ok {
+		return
+	}
+	_, filter, ok := requireOwner(w, r)
+	if !ok {
+		return
+	}
+
+	letters, err := s.Service.ListWebhookDeadLetters(r.Context(), filter, id)
+	if err != nil {
+		s.respondAdminError(w, r, "Failed to list webhook dead letters", err)
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, letters)
+}
+
+func (s *Server) RedeliverWebhookDeadLetter(w http.ResponseWriter, r *http.Request) {
+	id, ok := webhookID(w, r)
+	if !ok {
+		return
+	}
+
+	letterID, err := strconv.ParseInt(chi.URLParam(r, "letterID"), 10, 64)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "invalid dead letter id")
+		return
+	}
+	_, filter, ok := requireOwner(w, r)
+	if !ok {
+		return
+	}
+
+	if err = s.Service.RedeliverWebhookDeadLetter(r.Context(), filter, id, letterID); err != nil {
+		s.respondAdminError(w, r, "Failed to redeliver webhook dead letter", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func webhookID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "invalid webhook id")
+		return 0, false
+	}
+
+	return id, true
+}
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"context"
+	"github.com/langowen/exchange/internal/entities"
+	"github.com/pkg/errors"
+)
+
+func (s *Service) ListCurrencies(ctx context.Context) ([]entities.Cryptocurrency, error) {
+	const op = "service.ListCurrencies"
+
+	currencies, err := s.storage.ListCurrencies(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+
+	return currencies, nil
+}
+
+// DisableCurrency stops the fetcher from refreshing the crypto. Its history
+// stays available through the rate endpoints.
+func (s *Service) DisableCurrency(ctx context.Context, code string) error {
+	const op = "service.DisableCurrency"
+
+	if err := s.storage.SetCurrencyActive(ctx, code, false); err != nil {
+		return errors.Wrap(err, op)
+	}
+
+	s.audit(ctx, entities.ActionCurrencyDisable, code, nil)
+
+	return nil
+}
+
+func (s *Service) EnableCurrency(ctx context.Context, code string) error {
+	const op = "service.EnableCurrency"
+
+	if err := s.storage.SetCurrencyActive(ctx, code, true); err != nil {
+		return errors.Wrap(err, op)
+	}
+
+	s.audit(ctx, entities.ActionCurrencyEnable, code, nil)
+
+	return nil
+}
+
+func (s *Service) RenameCurrency(ctx context.Context, code, newCode string) error {
+	const op = "service.RenameCurrency"
+
+	if !entities.ValidCurrencyCode(newCode) {
+		return errors.Wrapf(entities.ErrInvalidArgument, "%s: invalid currency code %q", op, newCode)
+	}
+
+	if err := s.storage.RenameCurrency(ctx, code, newCode); err != nil {
+		return errors.Wrap(err, op)
+	}
+
+	s.audit(ctx, entities.ActionCurrencyRename, code, map[string]any{"new_code": newCode})
+
+	return nil
+}
+
+// DeleteCurrency drops the crypto and, through ON DELETE CASCADE, all of its
+// stored rates. Use DisableCurrency to keep the history.
+func (s *Service) DeleteCurrency(ctx context.Context, code string) error {
+	const op = "service.DeleteCurrency"
+
+	if err := s.storage.DeleteCurrency(ctx, code); err != nil {
+		return errors.Wrap(err, op)
+	}
+
+	s.audit(ctx, entities.ActionCurrencyDelete, code, nil)
+
+	return nil
+}
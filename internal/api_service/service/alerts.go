@@ -0,0 +1,140 @@
+package service
+
+import (
+	"context"
+	"github.com/langowen/exchange/internal/entities"
+	"github.com/pkg/errors"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultAlertFiringLimit = 50
+	maxAlertFiringLimit     = 500
+)
+
+// Alert rules are scoped by apiKeyID like webhooks. A rule may only post to a
+// webhook of the key that owns the rule.
+
+func (s *Service) CreateAlertRule(ctx context.Context, apiKeyID int, rule *entities.AlertRule) error {
+	const op = "service.CreateAlertRule"
+
+	rule.APIKeyID = apiKeyID
+	if err := s.checkAlertRule(ctx, rule); err != nil {
+		return errors.Wrap(err, op)
+	}
+
+	if err := s.storage.CreateAlertRule(ctx, rule); err != nil {
+		return errors.Wrap(err, op)
+	}
+
+	s.audit(ctx, entities.ActionAlertCreate, strconv.FormatInt(rule.ID, 10), map[string]any{
+		"pair":      rule.Crypto + "/" + rule.Fiat,
+		"operator":  rule.Operator,
+		"threshold": rule.Threshold,
+		"channel":   rule.Channel,
+	})
+
+	return nil
+}
+
+func (s *Service) ListAlertRules(ctx context.Context, apiKeyID int) ([]entities.AlertRule, error) {
+	const op = "service.ListAlertRules"
+
+	rules, err := s.storage.ListAlertRules(ctx, apiKeyID)
+	if err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+
+	return rules, nil
+}
+
+func (s *Service) GetAlertRule(ctx context.Context, apiKeyID int, id int64) (*entities.AlertRule, error) {
+	const op = "service.GetAlertRule"
+
+	rule, err := s.storage.GetAlertRule(ctx, id, apiKeyID)
+	if err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+
+	return rule, nil
+}
+
+func (s *Service) UpdateAlertRule(ctx context.Context, apiKeyID int, rule *entities.AlertRule) error {
+	const op = "service.UpdateAlertRule"
+
+	current, err := s.storage.GetAlertRule(ctx, rule.ID, apiKeyID)
+	if err != nil {
+		return errors.Wrap(err, op)
+	}
+
+	rule.APIKeyID = current.APIKeyID
+	if err = s.checkAlertRule(ctx, rule); err != nil {
+		return errors.Wrap(err, op)
+	}
+
+	if err = s.storage.UpdateAlertRule(ctx, rule, apiKeyID); err != nil {
+		return errors.Wrap(err, op)
+	}
+
+	s.audit(ctx, entities.ActionAlertUpdate, strconv.FormatInt(rule.ID, 10), map[string]any{
+		"pair":      rule.Crypto + "/" + rule.Fiat,
+		"operator":  rule.Operator,
+		"threshold": rule.Threshold,
+		"active":    rule.Active,
+	})
+
+	return nil
+}
+
+func (s *Service) DeleteAlertRule(ctx context.Context, apiKeyID int, id int64) error {
+	const op = "service.DeleteAlertRule"
+
+	if err := s.storage.DeleteAlertRule(ctx, id, apiKeyID); err != nil {
+		return errors.Wrap(err, op)
+	}
+
+	s.audit(ctx, entities.ActionAlertDelete, strconv.FormatInt(id, 10), nil)
+
+	return nil
+}
+
+func (s *Service) ListAlertFirings(ctx context.Context, filter entities.AlertFiringFilter) ([]entities.AlertFiring, int, error) {
+	const op = "service.ListAlertFirings"
+
+	if filter.Limit <= 0 {
+		filter.Limit = defaultAlertFiringLimit
+	}
+	filter.Limit = min(filter.Limit, maxAlertFiringLimit)
+	filter.Offset = max(filter.Offset, 0)
+
+	firings, total, err := s.storage.ListAlertFirings(ctx, filter)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, op)
+	}
+
+	return firings, total, nil
+}
+
+func (s *Service) checkAlertRule(ctx context.Context, rule *entities.AlertRule) error {
+	rule.Crypto = strings.ToUpper(rule.Crypto)
+	rule.Fiat = strings.ToUpper(rule.Fiat)
+	if rule.Channel == "" {
+		rule.Channel = entities.ChannelNone
+	}
+
+	if err := rule.Validate(); err != nil {
+		return errors.Wrapf(entities.ErrInvalidArgument, "%v", err)
+	}
+
+	if rule.Channel == entities.ChannelWebhook {
+		if _, err := s.storage.GetWebhook(ctx, rule.WebhookID, rule.APIKeyID); err != nil {
+			if errors.Is(err, entities.ErrNotFound) {
+				return errors.Wrapf(entities.ErrInvalidArgument, "webhook %d not found", rule.WebhookID)
+			}
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,55 @@
+package service
+
+import (
+	"context"
+	"github.com/langowen/exchange/internal/entities"
+	"github.com/pkg/errors"
+	"log/slog"
+)
+
+const (
+	defaultAuditLimit = 50
+	maxAuditLimit     = 500
+)
+
+// audit records an action on behalf of the request stored in ctx. A failed
+// write is logged but does not fail the action itself.
+func (s *Service) audit(ctx context.Context, action, target string, details map[string]any) {
+	meta := entities.RequestMetaFromContext(ctx)
+
+	entry := &entities.AuditEntry{
+		Actor:     meta.Actor,
+		Action:    action,
+		Target:    target,
+		RequestID: meta.RequestID,
+		RemoteIP:  meta.RemoteIP,
+		Details:   details,
+	}
+
+	if err := s.storage.SaveAuditEntry(ctx, entry); err != nil {
+		slog.Error("Failed to write audit entry",
+			"action", action,
+			"target", target,
+			"actor", meta.Actor,
+			"request_id", meta.RequestID,
+			"error", err,
+		)
+	}
+}
+
+func (s *Service) ListAuditEntries(ctx context.Context, filter entities.AuditFilter) ([]entities.AuditEntry, int, error) {
+	const op = "service.ListAuditEntries"
+
+	if filter.Limit <= 0 {
+		filter.Limit = defaultAuditLimit
+	}
+	filter.Limit = min(filter.Limit, maxAuditLimit)
+	filter.Offset = max(filter.Offset, 0)
+
+	entries, total, err := s.storage.ListAuditEntries(ctx, filter)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, op)
+	}
+
+	return entries, total, nil
+}
@@ -0,0 +1,12 @@
+package service
+
+import "context"
+
+type Events interface {
+	// RequestCurrency asks the fetcher to track currency and returns once its
+	// first rates are saved. It fails with entities.ErrRegistrationForbidden
+	// when maxTracked currencies are tracked already, with
+	// entities.ErrRateUnavailable when the provider had no rate, or with an
+	// error when ctx is done first.
+	RequestCurrency(ctx context.Context, currency string, maxTracked int) error
+}
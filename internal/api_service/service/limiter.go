@@ -0,0 +1,12 @@
+package service
+
+import (
+	"context"
+	"github.com/langowen/exchange/internal/entities"
+	"time"
+)
+
+type RateLimiter interface {
+	TakeToken(ctx context.Context, bucket string, limit int, period time.Duration) (*entities.RateLimit, error)
+	Increment(ctx context.Context, counter string, window time.Duration) (int64, error)
+}
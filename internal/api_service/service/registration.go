@@ -0,0 +1,131 @@
+package service
+
+import (
+	"context"
+	"github.com/langowen/exchange/deploy/config"
+	"github.com/langowen/exchange/internal/entities"
+	"github.com/pkg/errors"
+	"regexp"
+	"strings"
+)
+
+const (
+	PolicyOpen      = "open"
+	PolicyAllowlist = "allowlist"
+	PolicyPattern   = "pattern"
+	PolicyDisabled  = "disabled"
+)
+
+type registrationPolicy struct {
+	policy    string
+	allowlist map[string]struct{}
+	denylist  map[string]struct{}
+	pattern   *regexp.Regexp
+}
+
+func newRegistrationPolicy(cfg config.Registration) (*registrationPolicy, error) {
+	const op = "service.newRegistrationPolicy"
+
+	p := &registrationPolicy{
+		policy:    cfg.Policy,
+		allowlist: toSet(cfg.Allowlist),
+		denylist:  toSet(cfg.Denylist),
+	}
+
+	switch cfg.Policy {
+	case PolicyOpen, PolicyAllowlist, PolicyDisabled:
+	case PolicyPattern:
+		pattern, err := regexp.Compile(cfg.Pattern)
+		if err != nil {
+			return nil, errors.Wrap(err, op)
+		}
+		p.pattern = pattern
+	default:
+		return nil, errors.Errorf("%s: unknown registration policy %q", op, cfg.Policy)
+	}
+
+	return p, nil
+}
+
+// checkRegistration decides whether an unknown currency may be added on
+// behalf of the current request. Apart from codes too long to store, the
+// policy alone decides: open accepts any symbol. A disabled policy answers
+// ErrNotFound so the symbol looks like any other unknown one; every other
+// rejection is ErrRegistrationForbidden. The cap on tracked currencies is
+// checked here only to fail fast, the fetcher enforces it when inserting.
+func (s *Service) checkRegistration(ctx context.Context, currency string) error {
+	const op = "service.checkRegistration"
+
+	p := s.registration.Load()
+
+	if p.policy == PolicyDisabled {
+		return errors.Wrapf(entities.ErrNotFound, "%s: currency %s is not tracked", op, currency)
+	}
+
+	if len(currency) > entities.MaxCurrencyCodeLength {
+		return errors.Wrapf(entities.ErrRegistrationForbidden, "%s: currency code %q is longer than %d characters", op, currency, entities.MaxCurrencyCodeLength)
+	}
+
+	if _, denied := p.denylist[currency]; denied {
+		return errors.Wrapf(entities.ErrRegistrationForbidden, "%s: currency %s is denylisted", op, currency)
+	}
+
+	switch p.policy {
+	case PolicyAllowlist:
+		if _, allowed := p.allowlist[currency]; !allowed {
+			return errors.Wrapf(entities.ErrRegistrationForbidden, "%s: currency %s is not allowlisted", op, currency)
+		}
+	case PolicyPattern:
+		if !p.pattern.MatchString(currency) {
+			return errors.Wrapf(entities.ErrRegistrationForbidden, "%s: currency %s does not match %s", op, currency, p.pattern)
+		}
+	}
+
+	if maxTracked := s.config.Load().Registration.MaxTracked; maxTracked > 0 {
+		count, err := s.storage.CountCurrencies(ctx)
+		if err != nil {
+			return errors.Wrap(err, op)
+		}
+		if count >= maxTracked {
+			return errors.Wrapf(entities.ErrRegistrationForbidden, "%s: limit of %d tracked currencies reached", op, maxTracked)
+		}
+	}
+
+	if quota := s.config.Load().Registration.ClientQuota; quota > 0 {
+		client := registrationClient(ctx)
+
+		used, err := s.limiter.Increment(ctx, "registrations:"+client, s.config.Load().Registration.QuotaWindow)
+		if err != nil {
+			return errors.Wrap(err, op)
+		}
+		if used > int64(quota) {
+			return errors.Wrapf(entities.ErrRegistrationForbidden, "%s: registration quota of %d per %s exceeded", op, quota, s.config.Load().Registration.QuotaWindow)
+		}
+	}
+
+	return nil
+}
+
+// registrationClient identifies the quota owner: the API key when there is
+// one, the remote address for anonymous requests. The address comes from
+// forwarding headers only when set by a trusted proxy, so it cannot be
+// spoofed to dodge the quota.
+func registrationClient(ctx context.Context) string {
+	meta := entities.RequestMetaFromContext(ctx)
+	if meta.Actor != entities.ActorAnonymous {
+		return meta.Actor
+	}
+
+	return "ip:" + meta.RemoteIP
+}
+
+func toSet(values []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(values))
+	for _, v := range values {
+		if v = strings.ToUpper(strings.TrimSpace(v)); v != "" {
+			set[v] = struct{}{}
+		}
+	}
+
+	return set
+}
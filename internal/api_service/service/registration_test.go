@@ -0,0 +1,119 @@
+package service
+
+import (
+	"context"
+	"github.com/langowen/exchange/deploy/config"
+	"github.com/langowen/exchange/internal/entities"
+	"github.com/pkg/errors"
+	"testing"
+	"time"
+)
+
+// storage tracks no currency and records audit entries. Other methods are
+// not implemented.
+type storage struct {
+	Storage
+	audit []entities.AuditEntry
+}
+
+func (s *storage) ExistsRate(context.Context, string) (bool, error) {
+	return false, nil
+}
+
+func (s *storage) CountCurrencies(context.Context) (int, error) {
+	return 0, nil
+}
+
+func (s *storage) SaveAuditEntry(_ context.Context, entry *entities.AuditEntry) error {
+	s.audit = append(s.audit, *entry)
+	return nil
+}
+
+type events struct {
+	err error
+}
+
+func (e events) RequestCurrency(context.Context, string, int) error {
+	return e.err
+}
+
+type limiter struct {
+	counts map[string]int64
+}
+
+func (l *limiter) TakeToken(context.Context, string, int, time.Duration) (*entities.RateLimit, error) {
+	return &entities.RateLimit{Allowed: true}, nil
+}
+
+func (l *limiter) Increment(_ context.Context, counter string, _ time.Duration) (int64, error) {
+	l.counts[counter]++
+	return l.counts[counter], nil
+}
+
+func TestRegistrationAudit(t *testing.T) {
+	tests := []struct {
+		name      string
+		policy    config.Registration
+		requests  int
+		fetchErr  error
+		wantErr   error
+		wantAudit int
+	}{
+		{
+			name:    "disabled policy",
+			policy:  config.Registration{Policy: PolicyDisabled},
+			wantErr: entities.ErrNotFound,
+		},
+		{
+			name:     "rejected by the policy",
+			policy:   config.Registration{Policy: PolicyAllowlist, Allowlist: []string{"BTC"}},
+			requests: 3,
+			wantErr:  entities.ErrRegistrationForbidden,
+		},
+		{
+			name:      "over the quota",
+			policy:    config.Registration{Policy: PolicyOpen, ClientQuota: 2, QuotaWindow: time.Hour},
+			requests:  5,
+			fetchErr:  entities.ErrRateUnavailable,
+			wantErr:   entities.ErrRegistrationForbidden,
+			wantAudit: 2,
+		},
+		{
+			name:      "no rate from the provider",
+			policy:    config.Registration{Policy: PolicyOpen},
+			fetchErr:  entities.ErrRateUnavailable,
+			wantErr:   entities.ErrRateUnavailable,
+			wantAudit: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.policy.Wait = time.Second
+
+			st := &storage{}
+			s, err := NewService(st, events{err: tt.fetchErr}, &limiter{counts: make(map[string]int64)}, &config.ApiConfig{Registration: tt.policy})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx := entities.WithRequestMeta(context.Background(), entities.RequestMeta{Actor: entities.ActorAnonymous, RemoteIP: "10.0.0.1"})
+
+			for range max(tt.requests, 1) {
+				_, err = s.GetRate(ctx, "XYZ", RateQuery{})
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("GetRate returned %v, want %v", err, tt.wantErr)
+			}
+
+			if len(st.audit) != tt.wantAudit {
+				t.Fatalf("%d audit entries, want %d", len(st.audit), tt.wantAudit)
+			}
+			for _, entry := range st.audit {
+				if entry.Action != entities.ActionCurrencyReject {
+					t.Errorf("audited %s, want %s", entry.Action, entities.ActionCurrencyReject)
+				}
+			}
+		})
+	}
+}
@@ -2,34 +2,84 @@ package service
 
 import (
 	"context"
-	"fmt"
+	"github.com/langowen/exchange/deploy/config"
 	"github.com/langowen/exchange/internal/entities"
+	"github.com/langowen/exchange/internal/metrics"
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"strings"
+	"sync/atomic"
 	"time"
 )
 
+var tracer = otel.Tracer("github.com/langowen/exchange/internal/api_service/service")
+
 type Service struct {
 	storage Storage
-	redis   RedisStorage
+	events  Events
+	limiter RateLimiter
+	config  atomic.Pointer[config.ApiConfig]
+
+	registration atomic.Pointer[registrationPolicy]
 }
 
-func NewService(storage Storage, redis RedisStorage) (*Service, error) {
-	return &Service{
+// RateQuery holds the client parameters shared by the rate endpoints. The
+// range defaults to the current day in UTC; Option aggregates the rates in it,
+// otherwise the latest one is returned. RequireFresh makes the service fail
+// with entities.ErrStaleRate instead of returning latest rates older than
+// their max age.
+type RateQuery struct {
+	RangeQuery
+	Option       string
+	RequireFresh bool
+}
+
+func NewService(storage Storage, events Events, limiter RateLimiter, cfg *config.ApiConfig) (*Service, error) {
+	const op = "service.NewService"
+
+	registration, err := newRegistrationPolicy(cfg.Registration)
+	if err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+
+	s := &Service{
 		storage: storage,
-		redis:   redis,
-	}, nil
+		events:  events,
+		limiter: limiter,
+	}
+	s.config.Store(cfg)
+	s.registration.Store(registration)
+
+	return s, nil
+}
+
+// ApplyConfig swaps in a reloaded config. A config with an invalid
+// registration policy is rejected as a whole.
+func (s *Service) ApplyConfig(cfg *config.ApiConfig) error {
+	const op = "service.ApplyConfig"
+
+	registration, err := newRegistrationPolicy(cfg.Registration)
+	if err != nil {
+		return errors.Wrap(err, op)
+	}
+
+	s.registration.Store(registration)
+	s.config.Store(cfg)
+
+	return nil
 }
 
-func (s *Service) GetRate(ctx context.Context, currency string, date string, option string) (*entities.ExchangeRate, error) {
+func (s *Service) GetRate(ctx context.Context, currency string, query RateQuery) (*entities.ExchangeRate, error) {
 	const op = "service.GetRate"
 
-	dateTime := time.Now()
-	if date != "" {
-		parsedTime, err := time.Parse("2006-01-02", date)
-		if err != nil {
-			return nil, errors.Wrap(err, op)
-		}
-		dateTime = parsedTime
+	currency = strings.ToUpper(currency)
+
+	now := time.Now()
+	from, to, err := query.resolve(now, 0)
+	if err != nil {
+		return nil, errors.Wrap(err, op)
 	}
 
 	exists, err := s.storage.ExistsRate(ctx, currency)
@@ -37,72 +87,164 @@ func (s *Service) GetRate(ctx context.Context, currency string, date string, opt
 		return nil, errors.Wrap(err, op)
 	}
 	if !exists {
+		// Only attempts that got past the policy and the quota are audited,
+		// so unknown symbols cannot flood the audit log.
+		if err = s.checkRegistration(ctx, currency); err != nil {
+			return nil, errors.Wrap(err, op)
+		}
+
 		if err = s.getNewRate(ctx, currency); err != nil {
+			s.audit(ctx, entities.ActionCurrencyReject, currency, map[string]any{"reason": err.Error()})
 			return nil, errors.Wrap(err, op)
 		}
+
+		s.audit(ctx, entities.ActionCurrencyRegister, currency, nil)
 	}
 
-	switch option {
+	var rate *entities.ExchangeRate
+	switch query.Option {
 	case "avg":
-		return s.GetRateWithAvg(ctx, currency, dateTime)
+		rate, err = s.GetRateWithAvg(ctx, currency, from, to)
 	case "min":
-		return s.GetRateWithMin(ctx, currency, dateTime)
+		rate, err = s.GetRateWithMin(ctx, currency, from, to)
 	case "max":
-		return s.GetRateWithMax(ctx, currency, dateTime)
+		rate, err = s.GetRateWithMax(ctx, currency, from, to)
 	default:
-		return s.storage.GetRate(ctx, currency, dateTime)
+		rate, err = s.storage.GetRate(ctx, currency, from, to)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, op)
 	}
 
+	if query.latest(from, to, now) {
+		rates := []entities.ExchangeRate{*rate}
+		if err = s.checkFreshness(ctx, rates, now, query.RequireFresh); err != nil {
+			return nil, errors.Wrap(err, op)
+		}
+		rate = &rates[0]
+	}
+
+	return rate, nil
 }
 
 func (s *Service) getNewRate(ctx context.Context, currency string) error {
 	const op = "service.GetNewRate"
 
-	err := s.redis.PublishNew(ctx, currency)
-	if err != nil {
-		return errors.Wrap(err, op)
-	}
+	ctx, span := tracer.Start(ctx, op, trace.WithAttributes(attribute.String("currency", currency)))
+	defer span.End()
+
+	start := time.Now()
+	result := "error"
+	defer func() {
+		metrics.RegistrationDuration.WithLabelValues(result).Observe(time.Since(start).Seconds())
+	}()
 
-	ctxListen, cancel := context.WithTimeout(ctx, 3*time.Second)
+	ctxListen, cancel := context.WithTimeout(ctx, s.config.Load().Registration.Wait)
 	defer cancel()
 
-	res, err := s.redis.ListenUdp(ctxListen)
-	if err != nil {
-		if errors.Is(err, entities.ErrRedisTimeout) {
-			return err
+	if err := s.events.RequestCurrency(ctxListen, currency, s.config.Load().Registration.MaxTracked); err != nil {
+		if errors.Is(err, entities.ErrRegistrationForbidden) {
+			result = "rejected"
+			return errors.Wrap(err, op)
+		}
+		if errors.Is(err, entities.ErrRateUnavailable) {
+			result = "unavailable"
+			return errors.Wrap(err, op)
+		}
+		if errors.Is(ctxListen.Err(), context.DeadlineExceeded) {
+			result = "timeout"
+			return entities.ErrRedisTimeout
 		}
 		return errors.Wrap(err, op)
 	}
-	if res != currency {
-		return fmt.Errorf("invalid currency is redis format: %s != %s", res, currency)
-	}
+
+	result = "ok"
 
 	return nil
 }
 
-func (s *Service) GetAllRates(ctx context.Context, date string, option string) ([]entities.ExchangeRate, error) {
+func (s *Service) GetAllRates(ctx context.Context, query RateQuery) ([]entities.ExchangeRate, error) {
 	const op = "service.GetAllRates"
 
-	dateTime := time.Now()
-	if date != "" {
-		parsedTime, err := time.Parse("2006-01-02", date)
-		if err != nil {
-			return nil, errors.Wrap(err, op)
-		}
-		dateTime = parsedTime
+	now := time.Now()
+	from, to, err := query.resolve(now, 0)
+	if err != nil {
+		return nil, errors.Wrap(err, op)
 	}
 
-	switch option {
+	var rates []entities.ExchangeRate
+	switch query.Option {
 	case "avg":
-		return s.GetAllRatesWithAvg(ctx, dateTime)
+		rates, err = s.GetAllRatesWithAvg(ctx, from, to)
 	case "min":
-		return s.GetAllRatesWithMin(ctx, dateTime)
+		rates, err = s.GetAllRatesWithMin(ctx, from, to)
 	case "max":
-		return s.GetAllRatesWithMax(ctx, dateTime)
+		rates, err = s.GetAllRatesWithMax(ctx, from, to)
 	default:
-		return s.storage.GetAllRates(ctx, dateTime)
+		rates, err = s.storage.GetAllRates(ctx, from, to)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+
+	if query.latest(from, to, now) {
+		if err = s.checkFreshness(ctx, rates, now, query.RequireFresh); err != nil {
+			return nil, errors.Wrap(err, op)
+		}
+	}
+
+	return rates, nil
+}
+
+// latest tells whether the query asks for the current rates: no aggregate
+// and a range that reaches now. Staleness means nothing for anything else.
+func (q RateQuery) latest(from, to, now time.Time) bool {
+	return q.Option == "" && !from.After(now) && !to.Before(now)
+}
+
+// checkFreshness fills in the age of every pair and flags the ones older than
+// their max age, falling back to Freshness.MaxAge. A crypto takes the age of
+// its oldest pair.
+func (s *Service) checkFreshness(ctx context.Context, rates []entities.ExchangeRate, now time.Time, requireFresh bool) error {
+	const op = "service.checkFreshness"
+
+	maxAges, err := s.storage.GetMaxAges(ctx)
+	if err != nil {
+		return errors.Wrap(err, op)
 	}
 
+	defaultMaxAge := s.config.Load().Freshness.MaxAge
+
+	var stale []string
+	for i := range rates {
+		rate := &rates[i]
+		rate.AgeSeconds, rate.IsStale = 0, false
+
+		for j := range rate.FiatValues {
+			fiat := &rate.FiatValues[j]
+
+			maxAge, ok := maxAges[entities.Pair{Crypto: rate.Title, Fiat: fiat.Currency}]
+			if !ok {
+				maxAge = defaultMaxAge
+			}
+
+			age := now.Sub(fiat.DateUpdate)
+			fiat.AgeSeconds = int64(age / time.Second)
+			fiat.IsStale = age > maxAge
+
+			rate.AgeSeconds = max(rate.AgeSeconds, fiat.AgeSeconds)
+			if fiat.IsStale {
+				rate.IsStale = true
+				stale = append(stale, rate.Title+"/"+fiat.Currency)
+			}
+		}
+	}
+
+	if requireFresh && len(stale) > 0 {
+		return errors.Wrapf(entities.ErrStaleRate, "%s: %v", op, stale)
+	}
+
+	return nil
 }
 
 type AggFunc int
@@ -130,26 +272,26 @@ func WithAggFunc(f AggFunc) Option {
 	}
 }
 
-func (s *Service) GetRateWithAvg(ctx context.Context, currency string, date time.Time) (*entities.ExchangeRate, error) {
-	return s.storage.GetRate(ctx, currency, date, WithAggFunc(Avg))
+func (s *Service) GetRateWithAvg(ctx context.Context, currency string, from, to time.Time) (*entities.ExchangeRate, error) {
+	return s.storage.GetRate(ctx, currency, from, to, WithAggFunc(Avg))
 }
 
-func (s *Service) GetRateWithMin(ctx context.Context, currency string, date time.Time) (*entities.ExchangeRate, error) {
-	return s.storage.GetRate(ctx, currency, date, WithAggFunc(Min))
+func (s *Service) GetRateWithMin(ctx context.Context, currency string, from, to time.Time) (*entities.ExchangeRate, error) {
+	return s.storage.GetRate(ctx, currency, from, to, WithAggFunc(Min))
 }
 
-func (s *Service) GetRateWithMax(ctx context.Context, currency string, date time.Time) (*entities.ExchangeRate, error) {
-	return s.storage.GetRate(ctx, currency, date, WithAggFunc(Max))
+func (s *Service) GetRateWithMax(ctx context.Context, currency string, from, to time.Time) (*entities.ExchangeRate, error) {
+	return s.storage.GetRate(ctx, currency, from, to, WithAggFunc(Max))
 }
 
-func (s *Service) GetAllRatesWithAvg(ctx context.Context, date time.Time) ([]entities.ExchangeRate, error) {
-	return s.storage.GetAllRates(ctx, date, WithAggFunc(Avg))
+func (s *Service) GetAllRatesWithAvg(ctx context.Context, from, to time.Time) ([]entities.ExchangeRate, error) {
+	return s.storage.GetAllRates(ctx, from, to, WithAggFunc(Avg))
 }
 
-func (s *Service) GetAllRatesWithMin(ctx context.Context, date time.Time) ([]entities.ExchangeRate, error) {
-	return s.storage.GetAllRates(ctx, date, WithAggFunc(Min))
+func (s *Service) GetAllRatesWithMin(ctx context.Context, from, to time.Time) ([]entities.ExchangeRate, error) {
+	return s.storage.GetAllRates(ctx, from, to, WithAggFunc(Min))
 }
 
-func (s *Service) GetAllRatesWithMax(ctx context.Context, date time.Time) ([]entities.ExchangeRate, error) {
-	return s.storage.GetAllRates(ctx, date, WithAggFunc(Max))
+func (s *Service) GetAllRatesWithMax(ctx context.Context, from, to time.Time) ([]entities.ExchangeRate, error) {
+	return s.storage.GetAllRates(ctx, from, to, WithAggFunc(Max))
 }
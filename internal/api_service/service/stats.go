@@ -0,0 +1,52 @@
+package service
+
+import (
+	"context"
+	"github.com/langowen/exchange/internal/entities"
+	"github.com/pkg/errors"
+	"strings"
+	"time"
+)
+
+const defaultStatsWindow = 24 * time.Hour
+
+// GetRateStats summarizes the rates of currency over the range selected by
+// query, by default the rolling 24h that end now.
+func (s *Service) GetRateStats(ctx context.Context, currency string, query RangeQuery) (*entities.RateStats, error) {
+	const op = "service.GetRateStats"
+
+	currency = strings.ToUpper(currency)
+
+	from, to, err := query.resolve(time.Now(), defaultStatsWindow)
+	if err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+
+	exists, err := s.storage.ExistsRate(ctx, currency)
+	if err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+	if !exists {
+		return nil, errors.Wrapf(entities.ErrNotFound, "%s: currency %s is not tracked", op, currency)
+	}
+
+	fiats, err := s.storage.GetRateStats(ctx, currency, from, to)
+	if err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+
+	for i := range fiats {
+		fiats[i].Change = fiats[i].Current - fiats[i].Open
+		if fiats[i].Open != 0 {
+			fiats[i].ChangePct = fiats[i].Change / fiats[i].Open * 100
+		}
+	}
+
+	return &entities.RateStats{
+		Crypto: currency,
+		Window: to.Sub(from).String(),
+		From:   from,
+		To:     to,
+		Fiats:  fiats,
+	}, nil
+}
@@ -7,7 +7,37 @@ import (
 )
 
 type Storage interface {
-	GetRate(ctx context.Context, currency string, date time.Time, opts ...Option) (*entities.ExchangeRate, error)
-	GetAllRates(ctx context.Context, date time.Time, opts ...Option) ([]entities.ExchangeRate, error)
+	GetRate(ctx context.Context, currency string, from, to time.Time, opts ...Option) (*entities.ExchangeRate, error)
+	GetAllRates(ctx context.Context, from, to time.Time, opts ...Option) ([]entities.ExchangeRate, error)
 	ExistsRate(ctx context.Context, currency string) (bool, error)
+	GetRateStats(ctx context.Context, currency string, from, to time.Time) ([]entities.FiatStats, error)
+	GetMaxAges(ctx context.Context) (map[entities.Pair]time.Duration, error)
+
+	GetAPIKeyByHash(ctx context.Context, hash string) (*entities.APIKey, error)
+	CreateAPIKey(ctx context.Context, key *entities.APIKey, hash string) error
+	ListAPIKeys(ctx context.Context) ([]entities.APIKey, error)
+	RevokeAPIKey(ctx context.Context, id int) error
+
+	ListCurrencies(ctx context.Context) ([]entities.Cryptocurrency, error)
+	CountCurrencies(ctx context.Context) (int, error)
+	SetCurrencyActive(ctx context.Context, code string, active bool) error
+	RenameCurrency(ctx context.Context, code, newCode string) error
+	DeleteCurrency(ctx context.Context, code string) error
+
+	SaveAuditEntry(ctx context.Context, entry *entities.AuditEntry) error
+	ListAuditEntries(ctx context.Context, filter entities.AuditFilter) ([]entities.AuditEntry, int, error)
+
+	CreateWebhook(ctx context.Context, hook *entities.Webhook) error
+	ListWebhooks(ctx context.Context, apiKeyID int) ([]entities.Webhook, error)
+	GetWebhook(ctx context.Context, id int64, apiKeyID int) (*entities.Webhook, error)
+	DeleteWebhook(ctx context.Context, id int64, apiKeyID int) error
+	ListWebhookDeadLetters(ctx context.Context, webhookID int64, limit int) ([]entities.WebhookDelivery, error)
+	RedeliverWebhookDeadLetter(ctx context.Context, webhookID, letterID int64) error
+
+	CreateAlertRule(ctx context.Context, rule *entities.AlertRule) error
+	ListAlertRules(ctx context.Context, apiKeyID int) ([]entities.AlertRule, error)
+	GetAlertRule(ctx context.Context, id int64, apiKeyID int) (*entities.AlertRule, error)
+	UpdateAlertRule(ctx context.Context, rule *entities.AlertRule, apiKeyID int) error
+	DeleteAlertRule(ctx context.Context, id int64, apiKeyID int) error
+	ListAlertFirings(ctx context.Context, filter entities.AlertFiringFilter) ([]entities.AlertFiring, int, error)
 }
@@ -0,0 +1,157 @@
+package service
+
+import (
+	"github.com/langowen/exchange/internal/entities"
+	"github.com/pkg/errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	dateLayout     = "2006-01-02"
+	maxRangeWindow = 366 * 24 * time.Hour
+)
+
+// RangeQuery selects the rates an endpoint looks at. All ranges are half-open,
+// [from, to), and resolved as follows:
+//
+//   - date=YYYY-MM-DD is the calendar day from midnight to the next midnight
+//     in TZ. Days around DST switches are 23 or 25 hours long.
+//   - from and to are RFC 3339 timestamps, or dates meaning midnight in TZ.
+//     A missing to means now.
+//   - window is a duration such as "90m", "24h" or "7d". Alone it ends now;
+//     with from or to it extends from that bound.
+//   - With none of them the endpoint default applies: the current calendar
+//     day in TZ for rates, a rolling window for stats.
+//
+// TZ is an IANA zone name such as "Europe/Moscow" and defaults to UTC, so
+// boundaries do not depend on the server's zone. date cannot be combined with
+// from, to or window.
+type RangeQuery struct {
+	Date   string
+	From   string
+	To     string
+	Window string
+	TZ     string
+}
+
+// resolve turns q into a time range at now. A zero defaultWindow makes the
+// current day the default.
+func (q RangeQuery) resolve(now time.Time, defaultWindow time.Duration) (from, to time.Time, err error) {
+	loc := time.UTC
+	if q.TZ != "" {
+		if loc, err = time.LoadLocation(q.TZ); err != nil {
+			return from, to, invalidRange("unknown tz %q", q.TZ)
+		}
+	}
+	now = now.In(loc)
+
+	if q.Date != "" {
+		if q.From != "" || q.To != "" || q.Window != "" {
+			return from, to, invalidRange("date cannot be combined with from, to or window")
+		}
+
+		day, err := time.ParseInLocation(dateLayout, q.Date, loc)
+		if err != nil {
+			return from, to, invalidRange("invalid date %q, want YYYY-MM-DD", q.Date)
+		}
+
+		return day, day.AddDate(0, 0, 1), nil
+	}
+
+	if q.From == "" && q.To == "" && q.Window == "" {
+		if defaultWindow > 0 {
+			return now.Add(-defaultWindow), now, nil
+		}
+
+		day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+		return day, day.AddDate(0, 0, 1), nil
+	}
+
+	var window time.Duration
+	if q.Window != "" {
+		if window, err = ParseWindow(q.Window, 0); err != nil {
+			return from, to, errors.Wrap(entities.ErrInvalidArgument, err.Error())
+		}
+	}
+
+	if q.From != "" {
+		if from, err = parseBound(q.From, loc); err != nil {
+			return from, to, invalidRange("invalid from %q, want RFC 3339 or YYYY-MM-DD", q.From)
+		}
+	}
+	if q.To != "" {
+		if to, err = parseBound(q.To, loc); err != nil {
+			return from, to, invalidRange("invalid to %q, want RFC 3339 or YYYY-MM-DD", q.To)
+		}
+	}
+
+	switch {
+	case q.From != "" && q.To != "" && q.Window != "":
+		return from, to, invalidRange("window cannot be combined with both from and to")
+	case q.From != "" && q.Window != "":
+		to = from.Add(window)
+	case q.To != "" && q.Window != "":
+		from = to.Add(-window)
+	case q.Window != "":
+		from, to = now.Add(-window), now
+	case q.To == "":
+		to = now
+	case q.From == "":
+		return from, to, invalidRange("to requires from or window")
+	}
+
+	if !from.Before(to) {
+		return from, to, invalidRange("from must be before to")
+	}
+	if to.Sub(from) > maxRangeWindow {
+		return from, to, invalidRange("range must not exceed 366d")
+	}
+
+	return from, to, nil
+}
+
+func parseBound(value string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	return time.ParseInLocation(dateLayout, value, loc)
+}
+
+func invalidRange(format string, args ...any) error {
+	return errors.Wrapf(entities.ErrInvalidArgument, format, args...)
+}
+
+// ParseWindow parses a positive duration of at most a year, accepting a "d"
+// suffix for days on top of time.ParseDuration. An empty value gives def.
+func ParseWindow(value string, def time.Duration) (time.Duration, error) {
+	if value == "" {
+		return def, nil
+	}
+
+	var (
+		window time.Duration
+		err    error
+	)
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		var n int
+		n, err = strconv.Atoi(days)
+		if err == nil && (n <= 0 || n > int(maxRangeWindow/(24*time.Hour))) {
+			return 0, errors.Errorf("window must be within (0, 366d], got %q", value)
+		}
+		window = time.Duration(n) * 24 * time.Hour
+	} else {
+		window, err = time.ParseDuration(value)
+	}
+	if err != nil {
+		return 0, errors.Errorf("invalid window %q", value)
+	}
+
+	if window <= 0 || window > maxRangeWindow {
+		return 0, errors.Errorf("window must be within (0, 366d], got %q", value)
+	}
+
+	return window, nil
+}
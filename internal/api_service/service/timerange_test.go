@@ -0,0 +1,188 @@
+package service
+
+import (
+	"github.com/langowen/exchange/internal/entities"
+	"github.com/pkg/errors"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestRangeQueryResolve(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	moscow, err := time.LoadLocation("Europe/Moscow")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	utc := func(value string) time.Time {
+		ts, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ts
+	}
+
+	// 22:30 UTC is already the next day in Moscow.
+	now := utc("2026-03-29T22:30:00Z")
+
+	tests := []struct {
+		name          string
+		query         RangeQuery
+		defaultWindow time.Duration
+		from, to      time.Time
+		wantErr       bool
+	}{
+		{
+			name:  "current day in UTC by default",
+			query: RangeQuery{},
+			from:  utc("2026-03-29T00:00:00Z"),
+			to:    utc("2026-03-30T00:00:00Z"),
+		},
+		{
+			name:  "current day in tz",
+			query: RangeQuery{TZ: "Europe/Moscow"},
+			from:  time.Date(2026, 3, 30, 0, 0, 0, 0, moscow),
+			to:    time.Date(2026, 3, 31, 0, 0, 0, 0, moscow),
+		},
+		{
+			name:          "default window",
+			query:         RangeQuery{TZ: "Europe/Moscow"},
+			defaultWindow: 24 * time.Hour,
+			from:          now.Add(-24 * time.Hour),
+			to:            now,
+		},
+		{
+			name:  "date in UTC",
+			query: RangeQuery{Date: "2026-01-15"},
+			from:  utc("2026-01-15T00:00:00Z"),
+			to:    utc("2026-01-16T00:00:00Z"),
+		},
+		{
+			name:  "date on the spring DST switch is 23 hours",
+			query: RangeQuery{Date: "2026-03-29", TZ: "Europe/Berlin"},
+			from:  utc("2026-03-28T23:00:00Z"),
+			to:    utc("2026-03-29T22:00:00Z"),
+		},
+		{
+			name:  "date on the autumn DST switch is 25 hours",
+			query: RangeQuery{Date: "2026-10-25", TZ: "Europe/Berlin"},
+			from:  utc("2026-10-24T22:00:00Z"),
+			to:    utc("2026-10-25T23:00:00Z"),
+		},
+		{
+			name:  "from and to as dates in tz",
+			query: RangeQuery{From: "2026-03-28", To: "2026-03-30", TZ: "Europe/Berlin"},
+			from:  time.Date(2026, 3, 28, 0, 0, 0, 0, berlin),
+			to:    time.Date(2026, 3, 30, 0, 0, 0, 0, berlin),
+		},
+		{
+			name:  "RFC 3339 bounds keep their offset",
+			query: RangeQuery{From: "2026-03-01T10:00:00+03:00", To: "2026-03-01T12:00:00Z", TZ: "Europe/Berlin"},
+			from:  utc("2026-03-01T07:00:00Z"),
+			to:    utc("2026-03-01T12:00:00Z"),
+		},
+		{
+			name:  "from alone ends now",
+			query: RangeQuery{From: "2026-03-29T12:00:00Z"},
+			from:  utc("2026-03-29T12:00:00Z"),
+			to:    now,
+		},
+		{
+			name:  "window alone ends now",
+			query: RangeQuery{Window: "90m"},
+			from:  now.Add(-90 * time.Minute),
+			to:    now,
+		},
+		{
+			name:  "window extends from",
+			query: RangeQuery{From: "2026-03-01", Window: "7d"},
+			from:  utc("2026-03-01T00:00:00Z"),
+			to:    utc("2026-03-08T00:00:00Z"),
+		},
+		{
+			name:  "window is absolute time across DST",
+			query: RangeQuery{From: "2026-03-29", Window: "24h", TZ: "Europe/Berlin"},
+			from:  utc("2026-03-28T23:00:00Z"),
+			to:    utc("2026-03-29T23:00:00Z"),
+		},
+		{
+			name:  "window ends at to",
+			query: RangeQuery{To: "2026-03-29T12:00:00Z", Window: "2h"},
+			from:  utc("2026-03-29T10:00:00Z"),
+			to:    utc("2026-03-29T12:00:00Z"),
+		},
+		{
+			name:  "range of exactly 366 days",
+			query: RangeQuery{From: "2025-01-01", To: "2026-01-02"},
+			from:  utc("2025-01-01T00:00:00Z"),
+			to:    utc("2026-01-02T00:00:00Z"),
+		},
+		{name: "unknown tz", query: RangeQuery{TZ: "Mars/Olympus"}, wantErr: true},
+		{name: "invalid date", query: RangeQuery{Date: "29.03.2026"}, wantErr: true},
+		{name: "date with from", query: RangeQuery{Date: "2026-03-29", From: "2026-03-28"}, wantErr: true},
+		{name: "date with window", query: RangeQuery{Date: "2026-03-29", Window: "1h"}, wantErr: true},
+		{name: "invalid from", query: RangeQuery{From: "yesterday"}, wantErr: true},
+		{name: "invalid to", query: RangeQuery{From: "2026-03-28", To: "2026-03-29T25:00:00Z"}, wantErr: true},
+		{name: "invalid window", query: RangeQuery{Window: "1w"}, wantErr: true},
+		{name: "window with from and to", query: RangeQuery{From: "2026-03-28", To: "2026-03-29", Window: "1h"}, wantErr: true},
+		{name: "to without from or window", query: RangeQuery{To: "2026-03-29"}, wantErr: true},
+		{name: "from after to", query: RangeQuery{From: "2026-03-29", To: "2026-03-28"}, wantErr: true},
+		{name: "empty range", query: RangeQuery{From: "2026-03-29", To: "2026-03-29"}, wantErr: true},
+		{name: "from in the future", query: RangeQuery{From: "2026-04-01"}, wantErr: true},
+		{name: "range over 366 days", query: RangeQuery{From: "2025-01-01", To: "2026-01-03"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from, to, err := tt.query.resolve(now, tt.defaultWindow)
+			if tt.wantErr {
+				if !errors.Is(err, entities.ErrInvalidArgument) {
+					t.Fatalf("resolve returned %v, want an invalid argument", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !from.Equal(tt.from) || !to.Equal(tt.to) {
+				t.Errorf("resolve = [%v, %v), want [%v, %v)", from, to, tt.from, tt.to)
+			}
+		})
+	}
+}
+
+func TestParseWindow(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{value: "", want: time.Hour},
+		{value: "90m", want: 90 * time.Minute},
+		{value: "24h", want: 24 * time.Hour},
+		{value: "7d", want: 7 * 24 * time.Hour},
+		{value: "366d", want: 366 * 24 * time.Hour},
+		{value: "367d", wantErr: true},
+		{value: "0d", wantErr: true},
+		{value: "-1d", wantErr: true},
+		{value: "200000d", wantErr: true},
+		{value: "9223372036854775807d", wantErr: true},
+		{value: "0s", wantErr: true},
+		{value: "-1h", wantErr: true},
+		{value: "1.5d", wantErr: true},
+		{value: "d", wantErr: true},
+		{value: "week", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseWindow(tt.value, time.Hour)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseWindow(%q) = %v, %v; want %v, error %v", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/langowen/exchange/internal/entities"
+	"github.com/pkg/errors"
+	"strconv"
+	"strings"
+)
+
+const (
+	webhookSecretPrefix   = "whsec_"
+	webhookDeadLetterList = 100
+)
+
+// The apiKeyID of the webhook methods scopes them to the webhooks of one key;
+// zero gives access to all of them.
+
+// CreateWebhook stores hook for apiKeyID and returns its signing secret. The
+// secret is only shown once, like API keys.
+func (s *Service) CreateWebhook(ctx context.Context, apiKeyID int, hook *entities.Webhook) (string, error) {
+	const op = "service.CreateWebhook"
+
+	hook.Crypto = strings.ToUpper(hook.Crypto)
+	hook.Fiat = strings.ToUpper(hook.Fiat)
+	if err := hook.Validate(); err != nil {
+		return "", errors.Wrapf(entities.ErrInvalidArgument, "%s: %v", op, err)
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", errors.Wrap(err, op)
+	}
+	hook.Secret = webhookSecretPrefix + hex.EncodeToString(secret)
+	hook.APIKeyID = apiKeyID
+
+	if err := s.storage.CreateWebhook(ctx, hook); err != nil {
+		return "", errors.Wrap(err, op)
+	}
+
+	s.audit(ctx, entities.ActionWebhookCreate, strconv.FormatInt(hook.ID, 10), map[string]any{
+		"url":       hook.URL,
+		"pair":      hook.Crypto + "/" + hook.Fiat,
+		"condition": hook.Condition,
+	})
+
+	return hook.Secret, nil
+}
+
+func (s *Service) ListWebhooks(ctx context.Context, apiKeyID int) ([]entities.Webhook, error) {
+	const op = "service.ListWebhooks"
+
+	hooks, err := s.storage.ListWebhooks(ctx, apiKeyID)
+	if err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+
+	return hooks, nil
+}
+
+func (s *Service) GetWebhook(ctx context.Context, apiKeyID int, id int64) (*entities.Webhook, error) {
+	const op = "service.GetWebhook"
+
+	hook, err := s.storage.GetWebhook(ctx, id, apiKeyID)
+	if err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+
+	return hook, nil
+}
+
+func (s *Service) DeleteWebhook(ctx context.Context, apiKeyID int, id int64) error {
+	const op = "service.DeleteWebhook"
+
+	if err := s.storage.DeleteWebhook(ctx, id, apiKeyID); err != nil {
+		return errors.Wrap(err, op)
+	}
+
+	s.audit(ctx, entities.ActionWebhookDelete, strconv.FormatInt(id, 10), nil)
+
+	return nil
+}
+
+// ListWebhookDeadLetters returns the latest deliveries that ran out of
+// attempts, newest first.
+func (s *Service) ListWebhookDeadLetters(ctx context.Context, apiKeyID int, id int64) ([]entities.WebhookDelivery, error) {
+	const op = "service.ListWebhookDeadLetters"
+
+	if _, err := s.storage.GetWebhook(ctx, id, apiKeyID); err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+
+	letters, err := s.storage.ListWebhookDeadLetters(ctx, id, webhookDeadLetterList)
+	if err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+
+	return letters, nil
+}
+
+func (s *Service) RedeliverWebhookDeadLetter(ctx context.Context, apiKeyID int, id, letterID int64) error {
+	const op = "service.RedeliverWebhookDeadLetter"
+
+	if _, err := s.storage.GetWebhook(ctx, id, apiKeyID); err != nil {
+		return errors.Wrap(err, op)
+	}
+
+	if err := s.storage.RedeliverWebhookDeadLetter(ctx, id, letterID); err != nil {
+		return errors.Wrap(err, op)
+	}
+
+	s.audit(ctx, entities.ActionWebhookRedeliver, strconv.FormatInt(id, 10), map[string]any{"dead_letter_id": letterID})
+
+	return nil
+}
@@ -0,0 +1,126 @@
+package coin_desk
+
+import (
+	"errors"
+	"github.com/langowen/exchange/internal/metrics"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+type breakerState int
+
+const (
+	stateClosed breakerState = iota
+	stateOpen
+	stateHalfOpen
+)
+
+func (s breakerState) String() string {
+	return [...]string{"closed", "open", "half-open"}[s]
+}
+
+// breaker opens after threshold consecutive failed calls and lets a single
+// probe through once cooldown has passed.
+type breaker struct {
+	provider  string
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    breakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func newBreaker(provider string, threshold int, cooldown time.Duration) *breaker {
+	b := &breaker{
+		provider:  provider,
+		threshold: threshold,
+		cooldown:  cooldown,
+	}
+	b.report()
+
+	return b
+}
+
+func (b *breaker) Allow() error {
+	if b.threshold <= 0 {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case stateOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return ErrCircuitOpen
+		}
+		b.setState(stateHalfOpen)
+		b.probing = true
+		return nil
+	case stateHalfOpen:
+		if b.probing {
+			return ErrCircuitOpen
+		}
+		b.probing = true
+		return nil
+	default:
+		return nil
+	}
+}
+
+func (b *breaker) Record(failed bool) {
+	if b.threshold <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+
+	if !failed {
+		b.failures = 0
+		if b.state != stateClosed {
+			b.setState(stateClosed)
+		}
+		return
+	}
+
+	b.failures++
+	if b.state == stateHalfOpen || b.failures >= b.threshold {
+		b.openedAt = time.Now()
+		if b.state != stateOpen {
+			b.setState(stateOpen)
+		}
+	}
+}
+
+// Release ends a call that neither proved nor disproved the provider health,
+// so that a half-open breaker lets the next probe through.
+func (b *breaker) Release() {
+	if b.threshold <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+}
+
+func (b *breaker) setState(state breakerState) {
+	slog.Warn("Provider circuit breaker state changed", "provider", b.provider, "from", b.state, "to", state)
+
+	b.state = state
+	b.report()
+}
+
+func (b *breaker) report() {
+	metrics.ProviderBreakerState.WithLabelValues(b.provider).Set(float64(b.state))
+}
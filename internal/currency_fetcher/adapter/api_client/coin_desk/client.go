@@ -5,45 +5,107 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/langowen/exchange/internal/entities"
+	"github.com/langowen/exchange/internal/metrics"
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"io"
 	"log/slog"
+	"math/rand/v2"
 	"net/http"
+	"strconv"
 	"time"
 )
 
+// Limiter books a provider request slot, waiting until one is free.
+type Limiter interface {
+	Wait(ctx context.Context, provider string) error
+}
+
 type HTTPClient struct {
-	client *http.Client
+	client   *http.Client
+	provider string
+	limiter  Limiter
+	timeout  time.Duration
+
+	retries   int
+	baseDelay time.Duration
+	maxDelay  time.Duration
+
+	breakerThreshold int
+	breakerCooldown  time.Duration
+	breaker          *breaker
 }
 
-func NewHTTPClient() *HTTPClient {
-	return &HTTPClient{client: &http.Client{}}
+type Option func(c *HTTPClient)
+
+func WithProvider(provider string) Option {
+	return func(c *HTTPClient) {
+		c.provider = provider
+	}
 }
 
-func (c *HTTPClient) ApiClient(ctx context.Context, rates []entities.ExchangeRate, url string) ([]entities.ExchangeRate, error) {
-	const op = "coin_desk.ApiClient"
+// WithLimiter makes every attempt, retries included, wait for a slot of the
+// provider budget.
+func WithLimiter(limiter Limiter) Option {
+	return func(c *HTTPClient) {
+		c.limiter = limiter
+	}
+}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
-	if err != nil {
-		return nil, errors.Wrap(err, op)
+// WithTimeout bounds every attempt. Time spent waiting for the limiter does
+// not count.
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *HTTPClient) {
+		c.timeout = timeout
 	}
+}
 
-	resp, err := c.client.Do(req)
-	if err != nil {
-		return nil, errors.Wrap(err, op)
+func WithRetries(retries int, baseDelay, maxDelay time.Duration) Option {
+	return func(c *HTTPClient) {
+		c.retries = retries
+		c.baseDelay = baseDelay
+		c.maxDelay = maxDelay
 	}
-	defer func(Body io.ReadCloser) {
-		err := Body.Close()
-		if err != nil {
-			slog.Error(op, "error", err)
-		}
-	}(resp.Body)
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("%s: bad status: %s", op, resp.Status)
+func WithBreaker(threshold int, cooldown time.Duration) Option {
+	return func(c *HTTPClient) {
+		c.breakerThreshold = threshold
+		c.breakerCooldown = cooldown
 	}
+}
 
-	body, err := io.ReadAll(resp.Body)
+func NewHTTPClient(opts ...Option) *HTTPClient {
+	c := &HTTPClient{
+		client:   &http.Client{Transport: otelhttp.NewTransport(http.DefaultTransport)},
+		provider: "coin_desk",
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	c.breaker = newBreaker(c.provider, c.breakerThreshold, c.breakerCooldown)
+
+	return c
+}
+
+func (c *HTTPClient) ApiClient(ctx context.Context, rates []entities.ExchangeRate, url string) ([]entities.ExchangeRate, error) {
+	const op = "coin_desk.ApiClient"
+
+	if err := c.breaker.Allow(); err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+
+	body, err := c.getWithRetry(ctx, url)
+	switch {
+	case err == nil:
+		c.breaker.Record(false)
+	case isProviderFailure(err):
+		c.breaker.Record(true)
+	default:
+		c.breaker.Release()
+	}
 	if err != nil {
 		return nil, errors.Wrap(err, op)
 	}
@@ -70,3 +132,129 @@ func (c *HTTPClient) ApiClient(ctx context.Context, rates []entities.ExchangeRat
 
 	return rates, nil
 }
+
+func (c *HTTPClient) getWithRetry(ctx context.Context, url string) ([]byte, error) {
+	const op = "coin_desk.getWithRetry"
+
+	for attempt := 0; ; attempt++ {
+		if c.limiter != nil {
+			if err := c.limiter.Wait(ctx, c.provider); err != nil {
+				return nil, errors.Wrap(err, op)
+			}
+		}
+
+		body, retryable, err := c.attempt(ctx, url)
+		if err == nil || !retryable || attempt >= c.retries {
+			return body, err
+		}
+
+		delay := c.backoff(attempt)
+
+		metrics.ProviderRetries.WithLabelValues(c.provider).Inc()
+		slog.Warn("Provider request failed, retrying",
+			"provider", c.provider,
+			"attempt", attempt+1,
+			"delay", delay,
+			"error", err,
+		)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, errors.Wrap(ctx.Err(), op)
+		case <-timer.C:
+		}
+	}
+}
+
+func (c *HTTPClient) attempt(ctx context.Context, url string) ([]byte, bool, error) {
+	attemptCtx := ctx
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		attemptCtx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	body, retryable, err := c.get(attemptCtx, url)
+	if err != nil && attemptCtx.Err() != nil && ctx.Err() == nil {
+		// Only this attempt timed out, the caller is still waiting.
+		retryable = true
+	}
+
+	return body, retryable, err
+}
+
+func (c *HTTPClient) get(ctx context.Context, url string) ([]byte, bool, error) {
+	const op = "coin_desk.get"
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, false, errors.Wrap(err, op)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, ctx.Err() == nil, errors.Wrap(err, op)
+	}
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+			slog.Error(op, "error", err)
+		}
+	}(resp.Body)
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return nil, false, errors.Wrap(&entities.RateLimitError{RetryAfter: retryAfter(resp.Header.Get("Retry-After"))}, op)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, resp.StatusCode >= http.StatusInternalServerError, fmt.Errorf("%s: bad status: %s", op, resp.Status)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, ctx.Err() == nil, errors.Wrap(err, op)
+	}
+
+	return body, false, nil
+}
+
+// backoff returns an exponential delay with equal jitter, so that replicas
+// failing together do not retry in lockstep.
+func (c *HTTPClient) backoff(attempt int) time.Duration {
+	delay := c.baseDelay << min(attempt, 16)
+	if c.maxDelay > 0 && (delay > c.maxDelay || delay <= 0) {
+		delay = c.maxDelay
+	}
+
+	if delay <= 1 {
+		return delay
+	}
+
+	return delay/2 + rand.N(delay/2)
+}
+
+// isProviderFailure tells whether err says anything about the health of the
+// provider. Cancellations, 429s and a spent quota do not.
+func isProviderFailure(err error) bool {
+	return !errors.Is(err, context.Canceled) &&
+		!errors.Is(err, entities.ErrRateLimited) &&
+		!errors.Is(err, entities.ErrQuotaExhausted)
+}
+
+func retryAfter(header string) time.Duration {
+	if header == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(header); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(header); err == nil {
+		return time.Until(date)
+	}
+
+	return 0
+}
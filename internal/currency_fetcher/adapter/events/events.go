@@ -0,0 +1,70 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/langowen/exchange/internal/entities"
+	"github.com/langowen/exchange/internal/eventbus"
+	"github.com/langowen/exchange/internal/tracing"
+	"github.com/pkg/errors"
+	"log/slog"
+)
+
+// group is shared by all fetcher replicas, so every event is handled once:
+// registration requests by whichever replica holds the leadership, rate
+// updates by any of them, once per consumer.
+const group = "currency_fetcher"
+
+type Events struct {
+	bus eventbus.EventBus
+}
+
+func New(bus eventbus.EventBus) *Events {
+	return &Events{bus: bus}
+}
+
+// ListenRequested hands registration requests to handle until ctx is done.
+// Requests whose handler fails are delivered again.
+func (e *Events) ListenRequested(ctx context.Context, handle func(ctx context.Context, request entities.CurrencyMessage) error) error {
+	const op = "events.ListenRequested"
+
+	err := e.bus.Subscribe(ctx, eventbus.TopicCurrencyRequested, group, func(ctx context.Context, event eventbus.Event) error {
+		message := entities.ParseCurrencyMessage(string(event.Payload))
+
+		slog.Debug("Received message", "currency", message.Currency, "id", event.ID)
+
+		return handle(tracing.Extract(ctx, event.Headers), message)
+	})
+	if err != nil {
+		return errors.Wrap(err, op)
+	}
+
+	return nil
+}
+
+// ListenUpdated hands rate updates to handle until ctx is done, along with an
+// ID that stays the same when an update is delivered again. Each consumer
+// receives every update.
+func (e *Events) ListenUpdated(ctx context.Context, consumer string, handle func(ctx context.Context, eventID string, update entities.RatesUpdate) error) error {
+	const op = "events.ListenUpdated"
+
+	err := e.bus.Subscribe(ctx, eventbus.TopicRatesUpdated, group+"."+consumer, func(ctx context.Context, event eventbus.Event) error {
+		var update entities.RatesUpdate
+		if err := json.Unmarshal(event.Payload, &update); err != nil {
+			slog.Error("Dropping malformed rate update", "op", op, "id", event.ID, "error", err)
+			return nil
+		}
+
+		eventID := event.Headers[eventbus.HeaderEventID]
+		if eventID == "" {
+			eventID = event.ID
+		}
+
+		return handle(tracing.Extract(ctx, event.Headers), eventID, update)
+	})
+	if err != nil {
+		return errors.Wrap(err, op)
+	}
+
+	return nil
+}
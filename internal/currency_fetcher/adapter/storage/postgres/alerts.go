@@ -0,0 +1,116 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/jackc/pgx/v5"
+	"github.com/langowen/exchange/internal/entities"
+	"github.com/langowen/exchange/internal/metrics"
+	"github.com/pkg/errors"
+	"strconv"
+	"time"
+)
+
+func (s *Storage) ActiveAlertRules(ctx context.Context) ([]entities.AlertRule, error) {
+	const op = "storage.postgres.ActiveAlertRules"
+
+	defer metrics.ObserveDBQuery("ActiveAlertRules")()
+
+	rows, err := s.db.Query(ctx, `
+        SELECT id, crypto, fiat, operator, threshold, cooldown_sec, channel, COALESCE(webhook_id, 0), last_fired_at
+        FROM alert_rules
+        WHERE active
+    `)
+	if err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+	defer rows.Close()
+
+	var rules []entities.AlertRule
+	for rows.Next() {
+		rule := entities.AlertRule{Active: true}
+		var cooldownSec int
+
+		err = rows.Scan(&rule.ID, &rule.Crypto, &rule.Fiat, &rule.Operator, &rule.Threshold, &cooldownSec,
+			&rule.Channel, &rule.WebhookID, &rule.LastFiredAt)
+		if err != nil {
+			return nil, errors.Wrap(err, op)
+		}
+		rule.Cooldown = time.Duration(cooldownSec) * time.Second
+
+		rules = append(rules, rule)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+
+	return rules, nil
+}
+
+// SaveAlertFiring starts the cooldown of the rule, records the firing and,
+// for the webhook channel, queues its delivery, all in one transaction.
+func (s *Storage) SaveAlertFiring(ctx context.Context, rule entities.AlertRule, firing *entities.AlertFiring) (fired bool, err error) {
+	const op = "storage.postgres.SaveAlertFiring"
+
+	defer metrics.ObserveDBQuery("SaveAlertFiring")()
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return false, errors.Wrap(err, op)
+	}
+	defer func() {
+		if err != nil || !fired {
+			_ = tx.Rollback(ctx)
+		}
+	}()
+
+	tag, err := tx.Exec(ctx, `
+        UPDATE alert_rules
+        SET last_fired_at = $2
+        WHERE id = $1 AND active
+          AND (last_fired_at IS NULL OR last_fired_at + make_interval(secs => cooldown_sec) <= $2)
+    `, rule.ID, firing.FiredAt)
+	if err != nil {
+		return false, errors.Wrap(err, op)
+	}
+	if tag.RowsAffected() == 0 {
+		return false, nil
+	}
+
+	err = tx.QueryRow(ctx, `
+        INSERT INTO alert_firings (rule_id, event_id, crypto, fiat, operator, threshold, rate, previous, fired_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+        ON CONFLICT (rule_id, event_id) DO NOTHING
+        RETURNING id
+    `, firing.RuleID, firing.EventID, firing.Crypto, firing.Fiat, firing.Operator, firing.Threshold,
+		firing.Rate, firing.Previous, firing.FiredAt).Scan(&firing.ID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Wrap(err, op)
+	}
+
+	if rule.Channel == entities.ChannelWebhook {
+		var payload []byte
+		if payload, err = json.Marshal(firing); err != nil {
+			return false, errors.Wrap(err, op)
+		}
+
+		_, err = tx.Exec(ctx, `
+            INSERT INTO webhook_deliveries (webhook_id, event_id, payload)
+            VALUES ($1, $2, $3)
+            ON CONFLICT (webhook_id, event_id) DO NOTHING
+        `, rule.WebhookID, "alert:"+strconv.FormatInt(firing.ID, 10), payload)
+		if err != nil {
+			return false, errors.Wrap(err, op)
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return false, errors.Wrap(err, op)
+	}
+
+	return true, nil
+}
@@ -0,0 +1,104 @@
+package postgres
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/pkg/errors"
+	"sync"
+)
+
+// Leader holds a session-level advisory lock on a dedicated connection.
+// The lock is released by Postgres as soon as the session dies, so a
+// crashed leader is replaced by a standby on its next attempt.
+type Leader struct {
+	pool   *pgxpool.Pool
+	lockID int64
+
+	mu   sync.Mutex
+	conn *pgxpool.Conn
+}
+
+func (s *Storage) NewLeader(lockID int64) *Leader {
+	return &Leader{
+		pool:   s.db,
+		lockID: lockID,
+	}
+}
+
+func (l *Leader) TryAcquire(ctx context.Context) (bool, error) {
+	const op = "storage.postgres.Leader.TryAcquire"
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.conn != nil {
+		return true, nil
+	}
+
+	conn, err := l.pool.Acquire(ctx)
+	if err != nil {
+		return false, errors.Wrap(err, op)
+	}
+
+	var acquired bool
+	if err = conn.QueryRow(ctx, `SELECT pg_try_advisory_lock($1)`, l.lockID).Scan(&acquired); err != nil {
+		conn.Release()
+		return false, errors.Wrap(err, op)
+	}
+
+	if !acquired {
+		conn.Release()
+		return false, nil
+	}
+
+	l.conn = conn
+
+	return true, nil
+}
+
+func (l *Leader) Check(ctx context.Context) error {
+	const op = "storage.postgres.Leader.Check"
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.conn == nil {
+		return errors.Errorf("%s: lock is not held", op)
+	}
+
+	if err := l.conn.Ping(ctx); err != nil {
+		l.drop(ctx)
+		return errors.Wrap(err, op)
+	}
+
+	return nil
+}
+
+func (l *Leader) Release(ctx context.Context) error {
+	const op = "storage.postgres.Leader.Release"
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.conn == nil {
+		return nil
+	}
+
+	if _, err := l.conn.Exec(ctx, `SELECT pg_advisory_unlock($1)`, l.lockID); err != nil {
+		l.drop(ctx)
+		return errors.Wrap(err, op)
+	}
+
+	l.conn.Release()
+	l.conn = nil
+
+	return nil
+}
+
+// drop closes the session instead of returning it to the pool, so the lock
+// can never leak to another user of the pool.
+func (l *Leader) drop(ctx context.Context) {
+	_ = l.conn.Conn().Close(ctx)
+	l.conn.Release()
+	l.conn = nil
+}
@@ -0,0 +1,132 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/jackc/pgx/v5"
+	"github.com/langowen/exchange/internal/entities"
+	"github.com/langowen/exchange/internal/metrics"
+	"github.com/langowen/exchange/internal/tracing"
+	"github.com/pkg/errors"
+	"time"
+)
+
+// insertOutbox queues an event in tx. It is relayed to the event bus only if
+// tx commits, together with the change it announces.
+func insertOutbox(ctx context.Context, tx pgx.Tx, topic string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	headers := tracing.Inject(ctx)
+	if headers == nil {
+		headers = map[string]string{}
+	}
+
+	_, err = tx.Exec(ctx, `INSERT INTO outbox (topic, payload, headers) VALUES ($1, $2, $3)`, topic, data, headers)
+
+	return err
+}
+
+func (s *Storage) notifyOutbox() {
+	select {
+	case s.outboxWritten <- struct{}{}:
+	default:
+	}
+}
+
+// OutboxWritten is signalled after a transaction with outbox events commits,
+// so the relay in this process does not wait for its next poll.
+func (s *Storage) OutboxWritten() <-chan struct{} {
+	return s.outboxWritten
+}
+
+// RelayOutbox locks up to limit pending events, oldest first, and hands them to
+// publish. Published events are marked in the same transaction; relaying stops
+// at the first failure so that events keep their order. Rows locked by another
+// relay are skipped.
+func (s *Storage) RelayOutbox(ctx context.Context, limit int, publish func(ctx context.Context, event entities.OutboxEvent) error) (int, error) {
+	const op = "storage.postgres.RelayOutbox"
+
+	defer metrics.ObserveDBQuery("RelayOutbox")()
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return 0, errors.Wrap(err, op)
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	rows, err := tx.Query(ctx, `
+        SELECT id, topic, payload, headers FROM outbox
+        WHERE published_at IS NULL
+        ORDER BY id
+        LIMIT $1
+        FOR UPDATE SKIP LOCKED
+    `, limit)
+	if err != nil {
+		return 0, errors.Wrap(err, op)
+	}
+
+	var events []entities.OutboxEvent
+	for rows.Next() {
+		var event entities.OutboxEvent
+		if err = rows.Scan(&event.ID, &event.Topic, &event.Payload, &event.Headers); err != nil {
+			rows.Close()
+			return 0, errors.Wrap(err, op)
+		}
+		events = append(events, event)
+	}
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return 0, errors.Wrap(err, op)
+	}
+
+	published := make([]int64, 0, len(events))
+	var publishErr error
+	for _, event := range events {
+		if publishErr = publish(ctx, event); publishErr != nil {
+			_, err = tx.Exec(ctx, `UPDATE outbox SET attempts = attempts + 1, last_error = $2 WHERE id = $1`,
+				event.ID, publishErr.Error())
+			if err != nil {
+				return 0, errors.Wrap(err, op)
+			}
+			break
+		}
+		published = append(published, event.ID)
+	}
+
+	if len(published) > 0 {
+		_, err = tx.Exec(ctx, `UPDATE outbox SET published_at = NOW(), attempts = attempts + 1 WHERE id = ANY($1)`, published)
+		if err != nil {
+			return 0, errors.Wrap(err, op)
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return 0, errors.Wrap(err, op)
+	}
+
+	if publishErr != nil {
+		return len(published), errors.Wrap(publishErr, op)
+	}
+
+	return len(published), nil
+}
+
+// DeleteOutbox removes events published before the given time.
+func (s *Storage) DeleteOutbox(ctx context.Context, before time.Time) (int64, error) {
+	const op = "storage.postgres.DeleteOutbox"
+
+	defer metrics.ObserveDBQuery("DeleteOutbox")()
+
+	tag, err := s.db.Exec(ctx, `DELETE FROM outbox WHERE published_at < $1`, before)
+	if err != nil {
+		return 0, errors.Wrap(err, op)
+	}
+
+	return tag.RowsAffected(), nil
+}
@@ -3,34 +3,42 @@ package postgres
 import (
 	"context"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/langowen/exchange/deploy/config"
 	"github.com/langowen/exchange/internal/entities"
+	"github.com/langowen/exchange/internal/eventbus"
+	"github.com/langowen/exchange/internal/metrics"
+	"github.com/langowen/exchange/internal/tracing"
 	"github.com/pkg/errors"
 	"time"
 )
 
 type Storage struct {
 	db *pgxpool.Pool
+
+	outboxWritten chan struct{}
 }
 
 func NewStorage(pool *pgxpool.Pool) *Storage {
 	return &Storage{
-		db: pool,
+		db:            pool,
+		outboxWritten: make(chan struct{}, 1),
 	}
 }
 
-func InitStorage(ctx context.Context, dsn string) (*Storage, error) {
+func InitStorage(ctx context.Context, cfg config.Storage) (*Storage, error) {
 	const op = "storage.postgres.New"
 
-	poolConfig, err := pgxpool.ParseConfig(dsn)
+	poolConfig, err := pgxpool.ParseConfig(cfg.DSN())
 	if err != nil {
 		return nil, errors.Wrap(err, op)
 	}
-	poolConfig.MaxConns = 25
-	poolConfig.MinConns = 5
+	poolConfig.MaxConns = cfg.MaxConns
+	poolConfig.MinConns = cfg.MinConns
 	poolConfig.MaxConnLifetime = 10 * time.Minute
 	poolConfig.MaxConnIdleTime = 5 * time.Minute
+	poolConfig.ConnConfig.Tracer = tracing.NewPgxTracer()
 
-	ctx, cancel := context.WithTimeout(ctx, time.Second*10)
+	ctx, cancel := context.WithTimeout(ctx, cfg.Timeout)
 	defer cancel()
 
 	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
@@ -51,6 +59,8 @@ func InitStorage(ctx context.Context, dsn string) (*Storage, error) {
 func (s *Storage) SaveRates(ctx context.Context, rates []entities.ExchangeRate) error {
 	const op = "storage.postgres.SaveRates"
 
+	defer metrics.ObserveDBQuery("SaveRates")()
+
 	tx, err := s.db.Begin(ctx)
 	if err != nil {
 		return errors.Wrap(err, op)
@@ -87,11 +97,16 @@ func (s *Storage) SaveRates(ctx context.Context, rates []entities.ExchangeRate)
 				return errors.Wrap(err, op)
 			}
 		}
+
+		if err = insertOutbox(ctx, tx, eventbus.TopicRatesUpdated, entities.NewRatesUpdate(rate)); err != nil {
+			return errors.Wrap(err, op)
+		}
 	}
 
-	if err := tx.Commit(ctx); err != nil {
+	if err = tx.Commit(ctx); err != nil {
 		return errors.Wrap(err, op)
 	}
+	s.notifyOutbox()
 
 	return nil
 }
@@ -99,7 +114,9 @@ func (s *Storage) SaveRates(ctx context.Context, rates []entities.ExchangeRate)
 func (s *Storage) GetRates(ctx context.Context) ([]entities.ExchangeRate, error) {
 	const op = "storage.postgres.GetRates"
 
-	cryptoQuery := `SELECT code FROM cryptocurrencies ORDER BY id`
+	defer metrics.ObserveDBQuery("GetRates")()
+
+	cryptoQuery := `SELECT code FROM cryptocurrencies WHERE active ORDER BY id`
 	cryptoRows, err := s.db.Query(ctx, cryptoQuery)
 	if err != nil {
 		return nil, errors.Wrap(err, op)
@@ -154,13 +171,122 @@ func (s *Storage) GetRates(ctx context.Context) ([]entities.ExchangeRate, error)
 	return result, nil
 }
 
-func (s *Storage) SaveNewCurrency(ctx context.Context, currency string) error {
+// SaveNewCurrency adds currency unless maxTracked currencies are tracked
+// already, in which case it fails with entities.ErrRegistrationForbidden.
+// A currency that is tracked already is left alone.
+func (s *Storage) SaveNewCurrency(ctx context.Context, currency string, maxTracked int) error {
 	const op = "storage.postgres.SaveNewCurrency"
 
-	_, err := s.db.Exec(ctx, `INSERT INTO cryptocurrencies (code) VALUES ($1)`, currency)
+	defer metrics.ObserveDBQuery("SaveNewCurrency")()
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return errors.Wrap(err, op)
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback(ctx)
+		}
+	}()
+
+	if maxTracked > 0 {
+		// The lock serializes registrations, so that concurrent ones cannot
+		// both pass the cap, without blocking readers.
+		if _, err = tx.Exec(ctx, `LOCK TABLE cryptocurrencies IN SHARE ROW EXCLUSIVE MODE`); err != nil {
+			return errors.Wrap(err, op)
+		}
+
+		var (
+			count  int
+			exists bool
+		)
+		err = tx.QueryRow(ctx, `SELECT COUNT(*), COALESCE(bool_or(code = $1), false) FROM cryptocurrencies`, currency).Scan(&count, &exists)
+		if err != nil {
+			return errors.Wrap(err, op)
+		}
+		if !exists && count >= maxTracked {
+			err = errors.Wrapf(entities.ErrRegistrationForbidden, "%s: limit of %d tracked currencies reached", op, maxTracked)
+			return err
+		}
+	}
+
+	_, err = tx.Exec(ctx, `INSERT INTO cryptocurrencies (code) VALUES ($1) ON CONFLICT (code) DO NOTHING`, currency)
 	if err != nil {
 		return errors.Wrap(err, op)
 	}
 
+	if err = tx.Commit(ctx); err != nil {
+		return errors.Wrap(err, op)
+	}
+
+	return nil
+}
+
+// SaveRegistrationResult queues the currency.registered event that answers a
+// registration request.
+func (s *Storage) SaveRegistrationResult(ctx context.Context, result entities.RegistrationResult) error {
+	const op = "storage.postgres.SaveRegistrationResult"
+
+	defer metrics.ObserveDBQuery("SaveRegistrationResult")()
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return errors.Wrap(err, op)
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback(ctx)
+		}
+	}()
+
+	if err = insertOutbox(ctx, tx, eventbus.TopicCurrencyRegistered, result); err != nil {
+		return errors.Wrap(err, op)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return errors.Wrap(err, op)
+	}
+	s.notifyOutbox()
+
+	return nil
+}
+
+func (s *Storage) GetRefreshIntervals(ctx context.Context) (map[string]time.Duration, error) {
+	const op = "storage.postgres.GetRefreshIntervals"
+
+	defer metrics.ObserveDBQuery("GetRefreshIntervals")()
+
+	rows, err := s.db.Query(ctx, `SELECT code, refresh_interval_sec FROM cryptocurrencies WHERE refresh_interval_sec IS NOT NULL`)
+	if err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+	defer rows.Close()
+
+	intervals := make(map[string]time.Duration)
+	for rows.Next() {
+		var code string
+		var seconds int
+
+		if err = rows.Scan(&code, &seconds); err != nil {
+			return nil, errors.Wrap(err, op)
+		}
+
+		intervals[code] = time.Duration(seconds) * time.Second
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+
+	return intervals, nil
+}
+
+func (s *Storage) Ping(ctx context.Context) error {
+	const op = "storage.postgres.Ping"
+
+	if err := s.db.Ping(ctx); err != nil {
+		return errors.Wrap(err, op)
+	}
+
 	return nil
 }
@@ -0,0 +1,35 @@
+package postgres
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5"
+	"github.com/langowen/exchange/internal/metrics"
+	"github.com/pkg/errors"
+	"time"
+)
+
+// AddProviderUsage books one request of provider in month. With a positive
+// limit the counter only grows while it is below the limit, so leaders that
+// overlap during a failover cannot overspend the budget together.
+func (s *Storage) AddProviderUsage(ctx context.Context, provider string, month time.Time, limit int) (int, bool, error) {
+	const op = "storage.postgres.AddProviderUsage"
+
+	defer metrics.ObserveDBQuery("AddProviderUsage")()
+
+	var used int
+	err := s.db.QueryRow(ctx, `
+		INSERT INTO provider_usage (provider, month, requests)
+		VALUES ($1, $2, 1)
+		ON CONFLICT (provider, month) DO UPDATE
+			SET requests = provider_usage.requests + 1
+			WHERE $3 <= 0 OR provider_usage.requests < $3
+		RETURNING requests`, provider, month, limit).Scan(&used)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return limit, false, nil
+	}
+	if err != nil {
+		return 0, false, errors.Wrap(err, op)
+	}
+
+	return used, true, nil
+}
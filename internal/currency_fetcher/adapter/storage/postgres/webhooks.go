@@ -0,0 +1,208 @@
+package postgres
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5"
+	"github.com/langowen/exchange/internal/entities"
+	"github.com/langowen/exchange/internal/metrics"
+	"github.com/pkg/errors"
+	"time"
+)
+
+func (s *Storage) WebhooksForPair(ctx context.Context, crypto, fiat string) ([]entities.Webhook, error) {
+	const op = "storage.postgres.WebhooksForPair"
+
+	defer metrics.ObserveDBQuery("WebhooksForPair")()
+
+	rows, err := s.db.Query(ctx, `
+        SELECT id, condition, threshold, COALESCE(window_sec, 0), last_fired_at
+        FROM webhooks
+        WHERE crypto = $1 AND fiat = $2
+        ORDER BY id
+    `, crypto, fiat)
+	if err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+	defer rows.Close()
+
+	var hooks []entities.Webhook
+	for rows.Next() {
+		hook := entities.Webhook{Crypto: crypto, Fiat: fiat}
+		var windowSec int
+
+		if err = rows.Scan(&hook.ID, &hook.Condition, &hook.Threshold, &windowSec, &hook.LastFiredAt); err != nil {
+			return nil, errors.Wrap(err, op)
+		}
+		hook.Window = time.Duration(windowSec) * time.Second
+
+		hooks = append(hooks, hook)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+
+	return hooks, nil
+}
+
+// RateBefore returns the last rate of the pair saved strictly before the given
+// time, or entities.ErrNotFound.
+func (s *Storage) RateBefore(ctx context.Context, crypto, fiat string, before time.Time) (float64, error) {
+	const op = "storage.postgres.RateBefore"
+
+	defer metrics.ObserveDBQuery("RateBefore")()
+
+	query := `
+        SELECT er.amount::float8
+        FROM exchange_rates er
+        JOIN cryptocurrencies c ON c.id = er.crypto_id
+        JOIN fiat_currencies f ON f.id = er.fiat_id
+        WHERE c.code = $1 AND f.code = $2 AND er.timestamp < $3
+        ORDER BY er.timestamp DESC
+        LIMIT 1
+    `
+
+	var amount float64
+	if err := s.db.QueryRow(ctx, query, crypto, fiat, before).Scan(&amount); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, entities.ErrNotFound
+		}
+		return 0, errors.Wrap(err, op)
+	}
+
+	return amount, nil
+}
+
+// EnqueueWebhookDelivery queues a delivery and records when its webhook
+// fired. A delivery already queued for the same event is kept as is.
+func (s *Storage) EnqueueWebhookDelivery(ctx context.Context, delivery entities.WebhookDelivery, firedAt time.Time) (err error) {
+	const op = "storage.postgres.EnqueueWebhookDelivery"
+
+	defer metrics.ObserveDBQuery("EnqueueWebhookDelivery")()
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return errors.Wrap(err, op)
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback(ctx)
+		}
+	}()
+
+	_, err = tx.Exec(ctx, `
+        INSERT INTO webhook_deliveries (webhook_id, event_id, payload)
+        VALUES ($1, $2, $3)
+        ON CONFLICT (webhook_id, event_id) DO NOTHING
+    `, delivery.WebhookID, delivery.EventID, []byte(delivery.Payload))
+	if err != nil {
+		return errors.Wrap(err, op)
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE webhooks SET last_fired_at = $2 WHERE id = $1`, delivery.WebhookID, firedAt)
+	if err != nil {
+		return errors.Wrap(err, op)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return errors.Wrap(err, op)
+	}
+
+	return nil
+}
+
+// ClaimWebhookDeliveries picks up to limit due deliveries and hides them from
+// other workers for lease, so that a crashed worker's deliveries are retried
+// once the lease is over.
+func (s *Storage) ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]entities.WebhookDelivery, error) {
+	const op = "storage.postgres.ClaimWebhookDeliveries"
+
+	defer metrics.ObserveDBQuery("ClaimWebhookDeliveries")()
+
+	rows, err := s.db.Query(ctx, `
+        WITH due AS (
+            SELECT id FROM webhook_deliveries
+            WHERE next_attempt_at <= NOW()
+            ORDER BY next_attempt_at
+            LIMIT $1
+            FOR UPDATE SKIP LOCKED
+        )
+        UPDATE webhook_deliveries d
+        SET next_attempt_at = NOW() + make_interval(secs => $2)
+        FROM due, webhooks w
+        WHERE d.id = due.id AND w.id = d.webhook_id
+        RETURNING d.id, d.webhook_id, w.url, w.secret, d.event_id, d.payload, d.attempts, d.created_at
+    `, limit, lease.Seconds())
+	if err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+	defer rows.Close()
+
+	var deliveries []entities.WebhookDelivery
+	for rows.Next() {
+		var delivery entities.WebhookDelivery
+		err = rows.Scan(&delivery.ID, &delivery.WebhookID, &delivery.URL, &delivery.Secret, &delivery.EventID,
+			&delivery.Payload, &delivery.Attempts, &delivery.CreatedAt)
+		if err != nil {
+			return nil, errors.Wrap(err, op)
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+
+	return deliveries, nil
+}
+
+func (s *Storage) CompleteWebhookDelivery(ctx context.Context, id int64) error {
+	const op = "storage.postgres.CompleteWebhookDelivery"
+
+	defer metrics.ObserveDBQuery("CompleteWebhookDelivery")()
+
+	if _, err := s.db.Exec(ctx, `DELETE FROM webhook_deliveries WHERE id = $1`, id); err != nil {
+		return errors.Wrap(err, op)
+	}
+
+	return nil
+}
+
+func (s *Storage) RetryWebhookDelivery(ctx context.Context, id int64, next time.Time, lastError string) error {
+	const op = "storage.postgres.RetryWebhookDelivery"
+
+	defer metrics.ObserveDBQuery("RetryWebhookDelivery")()
+
+	_, err := s.db.Exec(ctx, `
+        UPDATE webhook_deliveries
+        SET attempts = attempts + 1, last_error = $3, next_attempt_at = $2
+        WHERE id = $1
+    `, id, next, lastError)
+	if err != nil {
+		return errors.Wrap(err, op)
+	}
+
+	return nil
+}
+
+// DeadLetterWebhookDelivery moves a delivery that ran out of attempts to
+// webhook_dead_letters.
+func (s *Storage) DeadLetterWebhookDelivery(ctx context.Context, id int64, lastError string) error {
+	const op = "storage.postgres.DeadLetterWebhookDelivery"
+
+	defer metrics.ObserveDBQuery("DeadLetterWebhookDelivery")()
+
+	_, err := s.db.Exec(ctx, `
+        WITH failed AS (
+            DELETE FROM webhook_deliveries WHERE id = $1
+            RETURNING webhook_id, event_id, payload, attempts, created_at
+        )
+        INSERT INTO webhook_dead_letters (webhook_id, event_id, payload, attempts, last_error, created_at)
+        SELECT webhook_id, event_id, payload, attempts + 1, $2, created_at FROM failed
+    `, id, lastError)
+	if err != nil {
+		return errors.Wrap(err, op)
+	}
+
+	return nil
+}
@@ -4,49 +4,39 @@ import (
 	"context"
 	"github.com/pkg/errors"
 	"github.com/redis/go-redis/v9"
-	"log/slog"
 )
 
 type Storage struct {
-	rdb *redis.Client
+	rdb redis.UniversalClient
 }
 
 func NewStorage(client redis.UniversalClient) *Storage {
 	return &Storage{
-		rdb: client.(*redis.Client),
+		rdb: client,
 	}
 }
 
-func InitStorage(ctx context.Context, options *redis.Options) (*Storage, error) {
-	redisClient := redis.NewClient(options)
-
-	if _, err := redisClient.Ping(ctx).Result(); err != nil {
+func InitStorage(ctx context.Context, client redis.UniversalClient) (*Storage, error) {
+	if err := client.Ping(ctx).Err(); err != nil {
+		_ = client.Close()
 		return nil, err
 	}
 
-	storage := NewStorage(redisClient)
+	storage := NewStorage(client)
 
 	return storage, nil
 }
 
-func (s *Storage) ListenNew(ctx context.Context) (string, error) {
-	const op = "redis.ListenNew"
-	pubsub := s.rdb.Subscribe(ctx, "new_currency")
+func (s *Storage) Ping(ctx context.Context) error {
+	const op = "storage.redis.Ping"
 
-	msg, err := pubsub.ReceiveMessage(ctx)
-	if err != nil {
-		return "", errors.Wrap(err, op)
+	if err := s.rdb.Ping(ctx).Err(); err != nil {
+		return errors.Wrap(err, op)
 	}
 
-	currency := msg.Payload
-
-	slog.Debug("Received message", "currency", currency)
-
-	return currency, nil
+	return nil
 }
 
-func (s *Storage) PublishUpd(ctx context.Context, currency string) error {
-	s.rdb.Publish(ctx, "currency_updated", currency)
-
-	return nil
+func (s *Storage) Close() error {
+	return s.rdb.Close()
 }
@@ -0,0 +1,98 @@
+package webhook_client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/langowen/exchange/internal/entities"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+// maxErrorBody bounds how much of a failed response ends up in last_error.
+const maxErrorBody = 512
+
+var errForbiddenAddress = errors.New("address is not public")
+
+type HTTPClient struct {
+	client *http.Client
+}
+
+// NewHTTPClient returns a client that only connects to public addresses. The
+// check runs on the address actually dialled, after name resolution, so a
+// host that resolves to an internal address at delivery time is refused too.
+func NewHTTPClient() *HTTPClient {
+	return newHTTPClient(checkAddress)
+}
+
+func newHTTPClient(control func(network, address string, _ syscall.RawConn) error) *HTTPClient {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   control,
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	// A proxy would be the address dialled, not the webhook host.
+	transport.Proxy = nil
+
+	return &HTTPClient{
+		client: &http.Client{
+			Transport: otelhttp.NewTransport(transport),
+			// Redirects are not followed: the signature is bound to the
+			// registered URL.
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// checkAddress is the dialer Control: it refuses to connect to loopback,
+// private, link-local and other non-public addresses.
+func checkAddress(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil || !entities.PublicAddress(addrPort.Addr()) {
+		return errors.Wrapf(errForbiddenAddress, "%s %s", network, address)
+	}
+
+	return nil
+}
+
+// Post sends body as JSON and fails on any status outside of 2xx.
+func (c *HTTPClient) Post(ctx context.Context, url string, body []byte, headers map[string]string) error {
+	const op = "webhook_client.Post"
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, op)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "exchange-webhooks/1")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, op)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		text, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		return fmt.Errorf("%s: unexpected status %d: %s", op, resp.StatusCode, bytes.TrimSpace(text))
+	}
+
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	return nil
+}
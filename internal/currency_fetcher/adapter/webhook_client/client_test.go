@@ -0,0 +1,96 @@
+package webhook_client
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+)
+
+func TestCheckAddress(t *testing.T) {
+	tests := []struct {
+		address string
+		allowed bool
+	}{
+		{address: "93.184.216.34:443", allowed: true},
+		{address: "[2606:2800:220:1:248:1893:25c8:1946]:443", allowed: true},
+		{address: "127.0.0.1:80"},
+		{address: "[::1]:80"},
+		{address: "10.1.2.3:80"},
+		{address: "172.16.0.1:80"},
+		{address: "192.168.1.1:80"},
+		{address: "169.254.169.254:80"},
+		{address: "[fe80::1]:80"},
+		{address: "[fd00::1]:80"},
+		{address: "0.0.0.0:80"},
+		{address: "[::]:80"},
+		{address: "100.64.0.1:80"},
+		{address: "224.0.0.1:80"},
+		{address: "255.255.255.255:80"},
+		{address: "[::ffff:127.0.0.1]:80"},
+		{address: "[::ffff:169.254.169.254]:80"},
+		{address: "[64:ff9b::a00:1]:80"},
+		{address: "not-an-address"},
+	}
+
+	for _, tt := range tests {
+		err := checkAddress("tcp", tt.address, nil)
+		if tt.allowed && err != nil {
+			t.Errorf("checkAddress(%s) = %v, want allowed", tt.address, err)
+		}
+		if !tt.allowed && !errors.Is(err, errForbiddenAddress) {
+			t.Errorf("checkAddress(%s) = %v, want forbidden", tt.address, err)
+		}
+	}
+}
+
+func TestPostRefusesInternalAddresses(t *testing.T) {
+	var called atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		called.Store(true)
+	}))
+	defer srv.Close()
+
+	// The test server listens on loopback, as does localhost after resolution.
+	for _, url := range []string{srv.URL, strings.Replace(srv.URL, "127.0.0.1", "localhost", 1)} {
+		err := NewHTTPClient().Post(context.Background(), url, []byte("{}"), nil)
+		if !errors.Is(err, errForbiddenAddress) {
+			t.Errorf("Post(%s) = %v, want a forbidden address", url, err)
+		}
+	}
+	if called.Load() {
+		t.Error("the internal server was reached")
+	}
+}
+
+func TestPost(t *testing.T) {
+	allowAll := func(string, string, syscall.RawConn) error {
+		return nil
+	}
+
+	var got http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header
+		if r.URL.Path == "/fail" {
+			http.Error(w, "broken", http.StatusBadGateway)
+		}
+	}))
+	defer srv.Close()
+
+	client := newHTTPClient(allowAll)
+
+	if err := client.Post(context.Background(), srv.URL, []byte("{}"), map[string]string{"X-Exchange-Event-Id": "1"}); err != nil {
+		t.Fatal(err)
+	}
+	if got.Get("Content-Type") != "application/json" || got.Get("X-Exchange-Event-Id") != "1" {
+		t.Errorf("headers = %v", got)
+	}
+
+	if err := client.Post(context.Background(), srv.URL+"/fail", []byte("{}"), nil); err == nil {
+		t.Error("Post succeeded on a 502")
+	}
+}
@@ -0,0 +1,251 @@
+package alert
+
+import (
+	"context"
+	"github.com/langowen/exchange/internal/entities"
+	"github.com/langowen/exchange/internal/metrics"
+	"github.com/pkg/errors"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+)
+
+type pair struct {
+	crypto string
+	fiat   string
+}
+
+// index holds the rules of one pair per operator, sorted by threshold, so a
+// tick only looks at the rules whose threshold lies in the range it covers.
+type index map[string][]*entities.AlertRule
+
+// Engine evaluates alert rules against every rate update. Rules are kept in
+// memory, indexed by pair, and reloaded every refresh interval.
+type Engine struct {
+	storage Storage
+	events  Events
+	clock   Clock
+	refresh time.Duration
+
+	mu       sync.Mutex
+	rules    map[pair]index
+	loadedAt time.Time
+}
+
+func NewEngine(storage Storage, events Events, clock Clock, refresh time.Duration) *Engine {
+	return &Engine{
+		storage: storage,
+		events:  events,
+		clock:   clock,
+		refresh: refresh,
+	}
+}
+
+// Run evaluates rate updates until ctx is done.
+func (e *Engine) Run(ctx context.Context) {
+	const op = "alert.Engine.Run"
+
+	if err := e.Load(ctx); err != nil {
+		slog.Error("Failed to load alert rules", "op", op, "error", err)
+	}
+
+	if err := e.events.ListenUpdated(ctx, "alerts", e.Evaluate); err != nil {
+		slog.Error("Failed to listen for rate updates", "op", op, "error", err)
+		return
+	}
+
+	slog.Info("Alert engine stopped", "op", op)
+}
+
+// Load replaces the in-memory rules with the active rules from storage.
+func (e *Engine) Load(ctx context.Context) error {
+	const op = "alert.Engine.Load"
+
+	rules, err := e.storage.ActiveAlertRules(ctx)
+	if err != nil {
+		return errors.Wrap(err, op)
+	}
+
+	byPair := make(map[pair]index)
+	for i := range rules {
+		rule := &rules[i]
+
+		p := pair{crypto: rule.Crypto, fiat: rule.Fiat}
+		if byPair[p] == nil {
+			byPair[p] = make(index)
+		}
+		byPair[p][rule.Operator] = append(byPair[p][rule.Operator], rule)
+	}
+
+	for _, idx := range byPair {
+		for _, list := range idx {
+			sort.Slice(list, func(i, j int) bool {
+				return list[i].Threshold < list[j].Threshold
+			})
+		}
+	}
+
+	e.mu.Lock()
+	e.rules = byPair
+	e.loadedAt = e.clock.Now()
+	e.mu.Unlock()
+
+	return nil
+}
+
+// Evaluate fires the rules matched by update. An error means the update
+// should be evaluated again; firings already saved are not repeated.
+func (e *Engine) Evaluate(ctx context.Context, eventID string, update entities.RatesUpdate) error {
+	const op = "alert.Engine.Evaluate"
+
+	e.mu.Lock()
+	stale := e.rules == nil || e.clock.Now().Sub(e.loadedAt) >= e.refresh
+	e.mu.Unlock()
+
+	if stale {
+		if err := e.Load(ctx); err != nil {
+			return errors.Wrap(err, op)
+		}
+	}
+
+	fiats := make([]string, 0, len(update.Rates))
+	for fiat := range update.Rates {
+		fiats = append(fiats, fiat)
+	}
+	sort.Strings(fiats)
+
+	for _, fiat := range fiats {
+		if err := e.evaluatePair(ctx, eventID, update, fiat); err != nil {
+			return errors.Wrap(err, op)
+		}
+	}
+
+	return nil
+}
+
+func (e *Engine) evaluatePair(ctx context.Context, eventID string, update entities.RatesUpdate, fiat string) error {
+	p := pair{crypto: update.Currency, fiat: fiat}
+	current := update.Rates[fiat]
+
+	e.mu.Lock()
+	idx := e.rules[p]
+	needPrevious := len(idx[entities.OperatorCrossesAbove])+len(idx[entities.OperatorCrossesBelow]) > 0
+	e.mu.Unlock()
+
+	if idx == nil {
+		return nil
+	}
+
+	var previous *float64
+	if needPrevious {
+		rate, err := e.storage.RateBefore(ctx, update.Currency, fiat, update.UpdatedAt)
+		if err != nil && !errors.Is(err, entities.ErrNotFound) {
+			return err
+		}
+		if err == nil {
+			previous = &rate
+		}
+	}
+
+	now := e.clock.Now()
+
+	e.mu.Lock()
+	matched := match(idx, previous, current, now)
+	e.mu.Unlock()
+
+	for _, rule := range matched {
+		firing := &entities.AlertFiring{
+			RuleID:    rule.ID,
+			EventID:   eventID,
+			Crypto:    rule.Crypto,
+			Fiat:      rule.Fiat,
+			Operator:  rule.Operator,
+			Threshold: rule.Threshold,
+			Rate:      current,
+			Previous:  previous,
+			FiredAt:   now,
+		}
+
+		fired, err := e.storage.SaveAlertFiring(ctx, rule, firing)
+		if err != nil {
+			return err
+		}
+		if !fired {
+			continue
+		}
+
+		e.markFired(p, rule.ID, now)
+		metrics.AlertFirings.WithLabelValues(rule.Operator, rule.Channel).Inc()
+		slog.Debug("Alert fired", "rule_id", rule.ID, "pair", rule.Crypto+"/"+rule.Fiat, "rate", current)
+	}
+
+	return nil
+}
+
+// markFired starts the cooldown of a rule in memory, until the next Load
+// brings it from storage.
+func (e *Engine) markFired(p pair, id int64, at time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, list := range e.rules[p] {
+		for _, rule := range list {
+			if rule.ID == id {
+				rule.LastFiredAt = &at
+				return
+			}
+		}
+	}
+}
+
+// match returns copies of the rules of idx that fire when the rate moves from
+// previous, nil when unknown, to current, leaving out the rules cooling down
+// at now. Crossings need a previous rate.
+func match(idx index, previous *float64, current float64, now time.Time) []entities.AlertRule {
+	var matched []*entities.AlertRule
+
+	// above fires for thresholds <= current, below for thresholds >= current.
+	above := idx[entities.OperatorAbove]
+	matched = append(matched, above[:searchAbove(above, current)]...)
+
+	below := idx[entities.OperatorBelow]
+	matched = append(matched, below[searchFrom(below, current):]...)
+
+	if previous != nil {
+		// crosses_above fires for thresholds in (previous, current].
+		if *previous < current {
+			list := idx[entities.OperatorCrossesAbove]
+			matched = append(matched, list[searchAbove(list, *previous):searchAbove(list, current)]...)
+		}
+
+		// crosses_below fires for thresholds in [current, previous).
+		if *previous > current {
+			list := idx[entities.OperatorCrossesBelow]
+			matched = append(matched, list[searchFrom(list, current):searchFrom(list, *previous)]...)
+		}
+	}
+
+	rules := make([]entities.AlertRule, 0, len(matched))
+	for _, rule := range matched {
+		if !rule.CoolingDown(now) {
+			rules = append(rules, *rule)
+		}
+	}
+
+	return rules
+}
+
+// searchAbove returns the index of the first rule with a threshold above value.
+func searchAbove(list []*entities.AlertRule, value float64) int {
+	return sort.Search(len(list), func(i int) bool {
+		return list[i].Threshold > value
+	})
+}
+
+// searchFrom returns the index of the first rule with a threshold of at least value.
+func searchFrom(list []*entities.AlertRule, value float64) int {
+	return sort.Search(len(list), func(i int) bool {
+		return list[i].Threshold >= value
+	})
+}
@@ -0,0 +1,316 @@
+package alert
+
+import (
+	"context"
+	"github.com/langowen/exchange/internal/entities"
+	"github.com/pkg/errors"
+	"sort"
+	"testing"
+	"time"
+)
+
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	return c.now
+}
+
+// storage keeps rules and previous rates in memory and records firings. Like
+// Postgres, it fires a rule at most once per event.
+type storage struct {
+	rules       []entities.AlertRule
+	previous    map[string]float64
+	previousErr error
+	loads       int
+	firings     []entities.AlertFiring
+}
+
+func (s *storage) ActiveAlertRules(context.Context) ([]entities.AlertRule, error) {
+	s.loads++
+
+	rules := make([]entities.AlertRule, len(s.rules))
+	copy(rules, s.rules)
+
+	return rules, nil
+}
+
+func (s *storage) RateBefore(_ context.Context, crypto, fiat string, _ time.Time) (float64, error) {
+	if s.previousErr != nil {
+		return 0, s.previousErr
+	}
+
+	rate, ok := s.previous[crypto+"/"+fiat]
+	if !ok {
+		return 0, entities.ErrNotFound
+	}
+
+	return rate, nil
+}
+
+func (s *storage) SaveAlertFiring(_ context.Context, rule entities.AlertRule, firing *entities.AlertFiring) (bool, error) {
+	for _, f := range s.firings {
+		if f.RuleID == rule.ID && f.EventID == firing.EventID {
+			return false, nil
+		}
+	}
+	s.firings = append(s.firings, *firing)
+
+	return true, nil
+}
+
+// fired returns the ids of the rules fired by event.
+func (s *storage) fired(eventID string) []int64 {
+	var ids []int64
+	for _, f := range s.firings {
+		if f.EventID == eventID {
+			ids = append(ids, f.RuleID)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+
+	return ids
+}
+
+func newEngine(s *storage) (*Engine, *clock) {
+	c := &clock{now: time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)}
+
+	return NewEngine(s, nil, c, 30*time.Second), c
+}
+
+func rule(id int64, operator string, threshold float64) entities.AlertRule {
+	return entities.AlertRule{
+		ID:        id,
+		Crypto:    "BTC",
+		Fiat:      "USD",
+		Operator:  operator,
+		Threshold: threshold,
+		Channel:   entities.ChannelNone,
+		Active:    true,
+	}
+}
+
+func update(rate float64, at time.Time) entities.RatesUpdate {
+	return entities.RatesUpdate{
+		Currency:  "BTC",
+		Rates:     map[string]float64{"USD": rate},
+		UpdatedAt: at,
+	}
+}
+
+func evaluate(t *testing.T, e *Engine, eventID string, u entities.RatesUpdate) {
+	t.Helper()
+
+	if err := e.Evaluate(context.Background(), eventID, u); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func equalIDs(got, want []int64) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestMatch(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	firedAt := now.Add(-time.Minute)
+
+	cooling := rule(9, entities.OperatorAbove, 100)
+	cooling.Cooldown = time.Hour
+	cooling.LastFiredAt = &firedAt
+
+	cooled := rule(10, entities.OperatorAbove, 100)
+	cooled.Cooldown = time.Minute
+	cooled.LastFiredAt = &firedAt
+
+	rules := []entities.AlertRule{
+		rule(1, entities.OperatorAbove, 100),
+		rule(2, entities.OperatorAbove, 200),
+		rule(3, entities.OperatorBelow, 100),
+		rule(4, entities.OperatorBelow, 50),
+		rule(5, entities.OperatorCrossesAbove, 100),
+		rule(6, entities.OperatorCrossesAbove, 150),
+		rule(7, entities.OperatorCrossesBelow, 100),
+		rule(8, entities.OperatorCrossesBelow, 50),
+		cooling,
+		cooled,
+	}
+
+	s := &storage{rules: rules}
+	e, _ := newEngine(s)
+	if err := e.Load(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	idx := e.rules[pair{crypto: "BTC", fiat: "USD"}]
+
+	rate := func(v float64) *float64 {
+		return &v
+	}
+
+	tests := []struct {
+		name     string
+		previous *float64
+		current  float64
+		want     []int64
+	}{
+		{name: "above and below at the threshold", current: 100, want: []int64{1, 3, 10}},
+		{name: "between thresholds", current: 150, want: []int64{1, 10}},
+		{name: "above every threshold", current: 250, want: []int64{1, 2, 10}},
+		{name: "below every threshold", current: 40, want: []int64{3, 4}},
+		{name: "no crossings without a previous rate", current: 160, want: []int64{1, 10}},
+		{name: "crosses above up to and including current", previous: rate(90), current: 150, want: []int64{1, 5, 6, 10}},
+		{name: "no crossing from the threshold itself", previous: rate(100), current: 120, want: []int64{1, 10}},
+		{name: "crosses above stops short of current", previous: rate(90), current: 149, want: []int64{1, 5, 10}},
+		{name: "crosses below down to and including current", previous: rate(120), current: 50, want: []int64{3, 4, 7, 8}},
+		{name: "crosses below stops short of current", previous: rate(120), current: 60, want: []int64{3, 7}},
+		{name: "unchanged rate crosses nothing", previous: rate(100), current: 100, want: []int64{1, 3, 10}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []int64
+			for _, r := range match(idx, tt.previous, tt.current, now) {
+				got = append(got, r.ID)
+			}
+			sort.Slice(got, func(i, j int) bool {
+				return got[i] < got[j]
+			})
+
+			if !equalIDs(got, tt.want) {
+				t.Errorf("match = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvaluateCrossing(t *testing.T) {
+	s := &storage{
+		rules:    []entities.AlertRule{rule(1, entities.OperatorCrossesAbove, 70000)},
+		previous: map[string]float64{"BTC/USD": 69000},
+	}
+	e, c := newEngine(s)
+
+	evaluate(t, e, "1", update(71000, c.now))
+
+	if got := s.fired("1"); !equalIDs(got, []int64{1}) {
+		t.Fatalf("fired %v, want rule 1", got)
+	}
+	if f := s.firings[0]; f.Previous == nil || *f.Previous != 69000 || f.Rate != 71000 || !f.FiredAt.Equal(c.now) {
+		t.Errorf("firing = %+v, want 69000 -> 71000 at %v", f, c.now)
+	}
+}
+
+func TestEvaluateWithoutPreviousRate(t *testing.T) {
+	s := &storage{
+		rules: []entities.AlertRule{
+			rule(1, entities.OperatorCrossesAbove, 70000),
+			rule(2, entities.OperatorAbove, 70000),
+		},
+	}
+	e, c := newEngine(s)
+
+	evaluate(t, e, "1", update(71000, c.now))
+
+	if got := s.fired("1"); !equalIDs(got, []int64{2}) {
+		t.Fatalf("fired %v, want only the above rule", got)
+	}
+	if s.firings[0].Previous != nil {
+		t.Errorf("Previous = %v, want none", *s.firings[0].Previous)
+	}
+}
+
+func TestEvaluatePreviousRateError(t *testing.T) {
+	s := &storage{
+		rules:       []entities.AlertRule{rule(1, entities.OperatorCrossesAbove, 70000)},
+		previousErr: errors.New("connection refused"),
+	}
+	e, c := newEngine(s)
+
+	if err := e.Evaluate(context.Background(), "1", update(71000, c.now)); err == nil {
+		t.Fatal("Evaluate succeeded without the previous rate")
+	}
+	if len(s.firings) != 0 {
+		t.Errorf("fired %v", s.firings)
+	}
+}
+
+func TestEvaluateCooldown(t *testing.T) {
+	r := rule(1, entities.OperatorAbove, 70000)
+	r.Cooldown = time.Hour
+
+	s := &storage{rules: []entities.AlertRule{r}}
+	e, c := newEngine(s)
+	// Keep the rules loaded, so only the in-memory cooldown applies.
+	e.refresh = 24 * time.Hour
+
+	evaluate(t, e, "1", update(71000, c.now))
+
+	c.now = c.now.Add(30 * time.Minute)
+	evaluate(t, e, "2", update(72000, c.now))
+
+	c.now = c.now.Add(30 * time.Minute)
+	evaluate(t, e, "3", update(73000, c.now))
+
+	for eventID, want := range map[string][]int64{"1": {1}, "2": nil, "3": {1}} {
+		if got := s.fired(eventID); !equalIDs(got, want) {
+			t.Errorf("event %s fired %v, want %v", eventID, got, want)
+		}
+	}
+}
+
+func TestEvaluateIsIdempotent(t *testing.T) {
+	s := &storage{rules: []entities.AlertRule{rule(1, entities.OperatorAbove, 70000)}}
+	e, c := newEngine(s)
+
+	evaluate(t, e, "1", update(71000, c.now))
+	evaluate(t, e, "1", update(71000, c.now))
+
+	if len(s.firings) != 1 {
+		t.Errorf("%d firings for a redelivered event, want 1", len(s.firings))
+	}
+}
+
+func TestLoadRefresh(t *testing.T) {
+	s := &storage{}
+	e, c := newEngine(s)
+
+	evaluate(t, e, "1", update(71000, c.now))
+	if s.loads != 1 {
+		t.Fatalf("%d loads, want the rules loaded on the first update", s.loads)
+	}
+
+	s.rules = []entities.AlertRule{rule(1, entities.OperatorAbove, 70000)}
+
+	c.now = c.now.Add(10 * time.Second)
+	evaluate(t, e, "2", update(71000, c.now))
+	if s.loads != 1 || len(s.firings) != 0 {
+		t.Fatalf("rules reloaded before the refresh interval: %d loads, %d firings", s.loads, len(s.firings))
+	}
+
+	c.now = c.now.Add(20 * time.Second)
+	evaluate(t, e, "3", update(71000, c.now))
+	if s.loads != 2 {
+		t.Fatalf("%d loads, want a reload after the refresh interval", s.loads)
+	}
+	if got := s.fired("3"); !equalIDs(got, []int64{1}) {
+		t.Errorf("fired %v, want the new rule", got)
+	}
+
+	// A rule gone from storage stops firing after the next reload.
+	s.rules = nil
+	c.now = c.now.Add(30 * time.Second)
+	evaluate(t, e, "4", update(71000, c.now))
+	if got := s.fired("4"); len(got) != 0 {
+		t.Errorf("fired %v after the rule was removed", got)
+	}
+}
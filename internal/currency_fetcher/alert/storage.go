@@ -0,0 +1,34 @@
+package alert
+
+import (
+	"context"
+	"github.com/langowen/exchange/internal/entities"
+	"time"
+)
+
+type Storage interface {
+	ActiveAlertRules(ctx context.Context) ([]entities.AlertRule, error)
+	RateBefore(ctx context.Context, crypto, fiat string, before time.Time) (float64, error)
+
+	// SaveAlertFiring records firing and hands it to the rule's channel. It
+	// reports false, without error, when the rule already fired for the same
+	// event or is still cooling down, possibly in another replica.
+	SaveAlertFiring(ctx context.Context, rule entities.AlertRule, firing *entities.AlertFiring) (bool, error)
+}
+
+type Events interface {
+	ListenUpdated(ctx context.Context, consumer string, handle func(ctx context.Context, eventID string, update entities.RatesUpdate) error) error
+}
+
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// SystemClock is the wall clock.
+var SystemClock Clock = systemClock{}
@@ -2,26 +2,42 @@ package apiApp
 
 import (
 	"context"
-	"fmt"
+	"errors"
 	"github.com/langowen/exchange/deploy/config"
 	"github.com/langowen/exchange/internal/currency_fetcher/adapter/api_client/coin_desk"
+	"github.com/langowen/exchange/internal/currency_fetcher/adapter/events"
+	"github.com/langowen/exchange/internal/currency_fetcher/adapter/webhook_client"
+	"github.com/langowen/exchange/internal/currency_fetcher/alert"
 	"github.com/langowen/exchange/internal/currency_fetcher/fetcher"
+	"github.com/langowen/exchange/internal/currency_fetcher/outbox"
+	"github.com/langowen/exchange/internal/currency_fetcher/ports/http/monitoring"
+	"github.com/langowen/exchange/internal/currency_fetcher/webhook"
+	"github.com/langowen/exchange/internal/eventbus"
+	"github.com/langowen/exchange/internal/eventbus/natsbus"
+	"github.com/langowen/exchange/internal/eventbus/redisbus"
+	"github.com/langowen/exchange/internal/health"
+	"github.com/langowen/exchange/internal/redisclient"
+	"github.com/langowen/exchange/internal/tracing"
 	"os"
+	"sync"
 
 	"github.com/langowen/exchange/internal/currency_fetcher/adapter/storage/postgres"
 	"github.com/langowen/exchange/internal/currency_fetcher/adapter/storage/redis"
-	"log"
 	"log/slog"
 
+	"github.com/nats-io/nats.go"
 	redisPack "github.com/redis/go-redis/v9"
 )
 
 type ApiApp struct {
-	cfg *config.Config
+	cfg        *config.FetcherConfig
+	configPath string
+	logLevel   slog.LevelVar
 }
 
-func NewApiApp(cfg *config.Config) *ApiApp {
-	return &ApiApp{cfg: cfg}
+// NewApiApp creates the app. configPath is the file re-read on SIGHUP, if any.
+func NewApiApp(cfg *config.FetcherConfig, configPath string) *ApiApp {
+	return &ApiApp{cfg: cfg, configPath: configPath}
 }
 
 func (a *ApiApp) Start(ctx context.Context) {
@@ -30,78 +46,252 @@ func (a *ApiApp) Start(ctx context.Context) {
 
 	slog.With("config", a.cfg).Info("starting application")
 
+	shutdownTracing := a.initTracing(ctx)
+	defer shutdownTracing()
+	slog.Info("Tracing initialized", "exporter", a.cfg.Tracing.Exporter)
+
 	pgStorage := a.initDatabase(ctx)
 	slog.Info("Storage initialized")
 
-	httpClient := a.initHTTPClient()
+	scheduler := fetcher.NewScheduler(pgStorage)
+
+	httpClient := a.initHTTPClient(scheduler)
 	slog.Info("HTTP client initialized")
 
-	rdStorage := a.initRedis(ctx)
-	slog.Info("Redis client initialized")
+	rdStorage, rdClient := a.initRedis(ctx)
+
+	bus := a.initEventBus(ctx, rdClient)
+	slog.Info("Event bus initialized", "backend", a.cfg.Events.Backend)
+
+	fetch := a.initFetcher(pgStorage, httpClient, scheduler, bus)
+	slog.Info("Fetcher initialized")
+
+	a.initReload(ctx, fetch)
+
+	relayDone := a.initOutbox(ctx, pgStorage, bus)
+	slog.Info("Outbox relay started")
+
+	webhooksDone := a.initWebhooks(ctx, pgStorage, bus)
+	slog.Info("Webhook workers started")
+
+	alertsDone := a.initAlerts(ctx, pgStorage, bus)
+	slog.Info("Alert engine started")
+
+	checker := a.initHealth(pgStorage, rdStorage, fetch)
+
+	serverDone := monitoring.StartServer(ctx, a.cfg, checker)
+	slog.Info("Monitoring server started", "port", a.cfg.Monitoring.Port)
 
 	slog.Info("starting application")
-	if err := a.initFetcher(ctx, pgStorage, httpClient, rdStorage); err != nil {
-		log.Fatal(err)
+	if err := fetch.StartFetcher(ctx); err != nil && !errors.Is(err, context.Canceled) {
+		fatal("Failed to fetcher", "error", err)
 	}
 
+	<-serverDone
+	<-relayDone
+	<-webhooksDone
+	<-alertsDone
+
+	if err := bus.Close(); err != nil {
+		slog.Error("Failed to close event bus", "error", err)
+	}
+	if rdStorage != nil {
+		if err := rdStorage.Close(); err != nil {
+			slog.Error("Failed to close Redis client", "error", err)
+		}
+	}
 }
 
 func (a *ApiApp) initLogger() {
+	level, err := config.ParseLevel(a.cfg.Log.Level)
+	if err != nil {
+		fatal("Failed to parse log level", "error", err)
+	}
+	a.logLevel.Set(level)
+
 	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
-		Level:     slog.LevelDebug,
+		Level:     &a.logLevel,
 		AddSource: false,
 	}))
 	slog.SetDefault(logger)
 }
 
-func (a *ApiApp) initDatabase(ctx context.Context) *postgres.Storage {
+func (a *ApiApp) initTracing(ctx context.Context) func() {
+	shutdown, err := tracing.Init(ctx, a.cfg.Tracing, "currency_fetcher")
+	if err != nil {
+		fatal("Failed to initialize tracing", "error", err)
+	}
 
-	dsn := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s search_path=%s",
-		a.cfg.Storage.Host,
-		a.cfg.Storage.Port,
-		a.cfg.Storage.User,
-		a.cfg.Storage.Password,
-		a.cfg.Storage.DBName,
-		a.cfg.Storage.SSLMode,
-		a.cfg.Storage.Schema,
-	)
+	return func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), a.cfg.Shutdown.Timeout)
+		defer cancel()
 
-	pgStorage, err := postgres.InitStorage(ctx, dsn)
+		if err := shutdown(shutdownCtx); err != nil {
+			slog.Error("Failed to flush traces", "error", err)
+		}
+	}
+}
+
+func (a *ApiApp) initDatabase(ctx context.Context) *postgres.Storage {
+	pgStorage, err := postgres.InitStorage(ctx, a.cfg.Storage)
 	if err != nil {
-		log.Fatalln("Failed to initialize PostgresSQL storage", "error", err)
+		fatal("Failed to initialize PostgresSQL storage", "error", err)
 	}
 
 	return pgStorage
 }
 
-func (a *ApiApp) initHTTPClient() *coin_desk.HTTPClient {
-	httClient := coin_desk.NewHTTPClient()
+func (a *ApiApp) initHTTPClient(scheduler *fetcher.Scheduler) *coin_desk.HTTPClient {
+	httClient := coin_desk.NewHTTPClient(
+		coin_desk.WithProvider(a.cfg.Fetcher.Provider),
+		coin_desk.WithLimiter(scheduler),
+		coin_desk.WithTimeout(a.cfg.Fetcher.Timeout),
+		coin_desk.WithRetries(a.cfg.Fetcher.Retries, a.cfg.Fetcher.RetryBaseDelay, a.cfg.Fetcher.RetryMaxDelay),
+		coin_desk.WithBreaker(a.cfg.Fetcher.BreakerThreshold, a.cfg.Fetcher.BreakerCooldown),
+	)
 
 	return httClient
 }
 
-func (a *ApiApp) initRedis(ctx context.Context) *redis.Storage {
-	options := &redisPack.Options{
-		Addr:     a.cfg.Redis.Host,
-		Password: a.cfg.Redis.Password,
-		DB:       a.cfg.Redis.DB,
+// initRedis connects to Redis, which only the redis event bus uses. It returns
+// nils with the nats backend.
+func (a *ApiApp) initRedis(ctx context.Context) (*redis.Storage, redisPack.UniversalClient) {
+	if a.cfg.Events.Backend != "redis" {
+		return nil, nil
+	}
+
+	client, err := redisclient.New(a.cfg.Redis)
+	if err != nil {
+		fatal("Failed to create Redis client", "error", err)
 	}
 
-	rdStorage, err := redis.InitStorage(ctx, options)
+	rdStorage, err := redis.InitStorage(ctx, client)
 	if err != nil {
-		log.Fatalln("Failed to initialize Redis storage", "error", err)
+		fatal("Failed to initialize Redis storage", "error", err)
+	}
+	slog.Info("Redis client initialized")
+
+	return rdStorage, client
+}
+
+func (a *ApiApp) initEventBus(ctx context.Context, client redisPack.UniversalClient) eventbus.EventBus {
+	cfg := a.cfg.Events
+
+	switch cfg.Backend {
+	case "redis":
+		return redisbus.New(client, cfg.ConsumerName(),
+			redisbus.WithMaxLen(cfg.MaxLen),
+			redisbus.WithClaimIdle(cfg.ClaimIdle),
+			redisbus.WithMaxDeliveries(cfg.MaxDeliveries),
+		)
+	case "nats":
+		opts := []nats.Option{nats.Name("currency_fetcher"), nats.MaxReconnects(-1)}
+		if cfg.NATS.Token != "" {
+			opts = append(opts, nats.Token(cfg.NATS.Token.Value()))
+		}
+
+		conn, err := nats.Connect(cfg.NATS.URL, opts...)
+		if err != nil {
+			fatal("Failed to connect to NATS", "error", err)
+		}
+
+		bus, err := natsbus.New(ctx, conn, cfg.MaxLen,
+			natsbus.WithStream(cfg.NATS.Stream, cfg.NATS.SubjectPrefix),
+			natsbus.WithAckWait(cfg.ClaimIdle),
+			natsbus.WithMaxDeliveries(cfg.MaxDeliveries),
+		)
+		if err != nil {
+			fatal("Failed to initialize NATS event bus", "error", err)
+		}
+
+		return bus
+	default:
+		fatal("Unknown event bus backend", "backend", cfg.Backend)
+		return nil
 	}
+}
+
+func (a *ApiApp) initFetcher(storage *postgres.Storage, client *coin_desk.HTTPClient, scheduler *fetcher.Scheduler, bus eventbus.EventBus) *fetcher.Fetcher {
+	leader := storage.NewLeader(a.cfg.Fetcher.LeaderLockID)
+
+	return fetcher.NewFetcher(storage, client, events.New(bus), leader, scheduler, a.cfg)
+}
 
-	return rdStorage
+func (a *ApiApp) initOutbox(ctx context.Context, storage *postgres.Storage, bus eventbus.EventBus) <-chan struct{} {
+	relay := outbox.NewRelay(storage, bus, a.cfg.Outbox)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		relay.Run(ctx)
+	}()
+
+	return done
+}
+
+// initWebhooks starts the dispatcher, which queues deliveries for the webhooks
+// fired by rate updates, and the deliverer, which sends them.
+func (a *ApiApp) initWebhooks(ctx context.Context, storage *postgres.Storage, bus eventbus.EventBus) <-chan struct{} {
+	dispatcher := webhook.NewDispatcher(storage, events.New(bus))
+	deliverer := webhook.NewDeliverer(storage, webhook_client.NewHTTPClient(), a.cfg.Webhooks)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		dispatcher.Run(ctx)
+	}()
+	go func() {
+		defer wg.Done()
+		deliverer.Run(ctx)
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	return done
 }
 
-func (a *ApiApp) initFetcher(ctx context.Context, storage *postgres.Storage, client *coin_desk.HTTPClient, redis *redis.Storage) error {
-	fetch := fetcher.NewFetcher(storage, client, redis, a.cfg)
+func (a *ApiApp) initAlerts(ctx context.Context, storage *postgres.Storage, bus eventbus.EventBus) <-chan struct{} {
+	engine := alert.NewEngine(storage, events.New(bus), alert.SystemClock, a.cfg.Alerts.Refresh)
 
-	if err := fetch.StartFetcher(ctx); err != nil {
-		slog.Error("Failed to fetcher", "error", err)
-		return err
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		engine.Run(ctx)
+	}()
+
+	return done
+}
+
+func (a *ApiApp) initHealth(storage *postgres.Storage, redis *redis.Storage, fetch *fetcher.Fetcher) *health.Checker {
+	checker := health.NewChecker()
+	checker.Add("postgres", storage.Ping)
+	if redis != nil {
+		checker.Add("redis", redis.Ping)
 	}
+	checker.Add("fetcher", fetch.CheckFreshness)
+
+	return checker
+}
+
+// initReload applies the safe subset of the config on SIGHUP.
+func (a *ApiApp) initReload(ctx context.Context, fetch *fetcher.Fetcher) {
+	reloader := config.NewReloader(a.configPath, a.cfg)
+	reloader.Subscribe(func(cfg *config.FetcherConfig) {
+		if level, err := config.ParseLevel(cfg.Log.Level); err == nil {
+			a.logLevel.Set(level)
+		}
+		fetch.ApplyConfig(cfg)
+	})
+	reloader.Watch(ctx)
+}
 
-	return nil
+// fatal logs the error the way the rest of the app does and exits.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
 }
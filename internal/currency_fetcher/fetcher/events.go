@@ -0,0 +1,10 @@
+package fetcher
+
+import (
+	"context"
+	"github.com/langowen/exchange/internal/entities"
+)
+
+type Events interface {
+	ListenRequested(ctx context.Context, handle func(ctx context.Context, request entities.CurrencyMessage) error) error
+}
@@ -5,118 +5,423 @@ import (
 	"fmt"
 	"github.com/langowen/exchange/deploy/config"
 	"github.com/langowen/exchange/internal/entities"
+	"github.com/langowen/exchange/internal/metrics"
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"log/slog"
 	"net/url"
+	"sort"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
+var tracer = otel.Tracer("github.com/langowen/exchange/internal/currency_fetcher/fetcher")
+
 type Fetcher struct {
 	storage    Storage
 	httpClient HTTPClient
-	redis      RedisStorage
-	config     *config.Config
+	events     Events
+	leader     Leader
+	scheduler  *Scheduler
+	config     atomic.Pointer[config.FetcherConfig]
+
+	leading        atomic.Bool
+	lastSuccess    atomic.Int64
+	reloadSchedule atomic.Bool
 }
 
-func NewFetcher(storage Storage, client HTTPClient, redis RedisStorage, cfg *config.Config) *Fetcher {
-	return &Fetcher{
+// NewFetcher creates the fetcher. The client is expected to book a slot of
+// scheduler for every provider request it makes, retries included.
+func NewFetcher(storage Storage, client HTTPClient, events Events, leader Leader, scheduler *Scheduler, cfg *config.FetcherConfig) *Fetcher {
+	scheduler.AddProvider(cfg.Fetcher.Provider, Budget{
+		PerMinute: cfg.Fetcher.RequestsPerMinute,
+		PerMonth:  cfg.Fetcher.RequestsPerMonth,
+	})
+
+	f := &Fetcher{
 		storage:    storage,
 		httpClient: client,
-		redis:      redis,
-		config:     cfg,
+		events:     events,
+		leader:     leader,
+		scheduler:  scheduler,
 	}
+	f.config.Store(cfg)
+
+	return f
+}
+
+// ApplyConfig swaps in a reloaded config. The fetch interval, provider URL and
+// quotas take effect on the next scheduling tick. The provider name needs a
+// restart, so that its quota accounting is never split.
+func (f *Fetcher) ApplyConfig(cfg *config.FetcherConfig) {
+	f.scheduler.SetBudget(cfg.Fetcher.Provider, Budget{
+		PerMinute: cfg.Fetcher.RequestsPerMinute,
+		PerMonth:  cfg.Fetcher.RequestsPerMonth,
+	})
+	f.config.Store(cfg)
 }
 
 func (f *Fetcher) StartFetcher(ctx context.Context) error {
 	const op = "fetcher.StartFetcher"
 
-	ticker := time.NewTicker(f.config.Fetcher.TimeTickers)
+	ticker := time.NewTicker(f.config.Load().Fetcher.LeaderRetry)
 	defer ticker.Stop()
 
-	go f.getNewRate(ctx)
+	var (
+		stopLeading context.CancelFunc
+		leadDone    chan error
+	)
+
+	release := func() {
+		releaseCtx, cancel := context.WithTimeout(context.Background(), f.config.Load().Fetcher.Timeout)
+		defer cancel()
+
+		if err := f.leader.Release(releaseCtx); err != nil {
+			slog.Error("Failed to release leadership", "op", op, "error", err)
+		}
+	}
+
+	stop := func() {
+		if stopLeading == nil {
+			return
+		}
+
+		stopLeading()
+		<-leadDone
+		stopLeading, leadDone = nil, nil
+
+		release()
+	}
+	defer stop()
 
 	for {
-		select {
-		case <-ticker.C:
-			rates, err := f.storage.GetRates(ctx)
+		if stopLeading == nil {
+			acquired, err := f.leader.TryAcquire(ctx)
 			if err != nil {
-				return errors.Wrap(err, op)
+				slog.Error("Failed to acquire leadership", "op", op, "error", err)
 			}
 
-			if err := f.fetchRate(ctx, rates); err != nil {
-				slog.Error("Ошибка при обновлении валютного курса", "rate", rates, "error", err)
+			if acquired {
+				slog.Info("Leadership acquired, starting fetcher")
+
+				stopLeading, leadDone = f.startLead(ctx)
 			}
+		} else if err := f.leader.Check(ctx); err != nil {
+			slog.Error("Leadership lost, stopping fetcher", "op", op, "error", err)
+			stop()
+		}
 
+		select {
+		case <-ticker.C:
+		case err := <-leadDone:
+			stopLeading()
+			stopLeading, leadDone = nil, nil
+			release()
+
+			return errors.Wrap(err, op)
 		case <-ctx.Done():
 			return errors.Wrap(ctx.Err(), op)
 		}
 	}
 }
 
-func (f *Fetcher) getNewRate(ctx context.Context) {
-	const op = "fetcher.getNewRate"
+// CheckFreshness fails when the leader has not saved any rate for longer than
+// Fetcher.MaxFetchAge. Standbys are always fresh: they are not expected to fetch.
+func (f *Fetcher) CheckFreshness(_ context.Context) error {
+	if !f.leading.Load() {
+		return nil
+	}
+
+	age := time.Since(time.Unix(0, f.lastSuccess.Load()))
+	if age > f.config.Load().Fetcher.MaxFetchAge {
+		return fmt.Errorf("last successful fetch was %s ago", age.Round(time.Second))
+	}
+
+	return nil
+}
+
+func (f *Fetcher) startLead(ctx context.Context) (context.CancelFunc, chan error) {
+	leadCtx, cancel := context.WithCancel(ctx)
+	done := make(chan error, 1)
+
+	// Freshness is measured from the moment leadership was taken, so a new
+	// leader is not reported stale before its first fetch.
+	f.lastSuccess.Store(time.Now().UnixNano())
+	f.leading.Store(true)
+
+	go func() {
+		defer f.leading.Store(false)
+		done <- f.lead(leadCtx)
+	}()
+
+	return cancel, done
+}
+
+func (f *Fetcher) lead(ctx context.Context) error {
+	const op = "fetcher.lead"
+
+	ticker := time.NewTicker(f.config.Load().Fetcher.ScheduleTick)
+	defer ticker.Stop()
+
+	go f.getNewRate(ctx)
+
+	nextFetch := make(map[string]time.Time)
+
+	var (
+		rates     []entities.ExchangeRate
+		intervals map[string]time.Duration
+		loadedAt  time.Time
+	)
 
 	for {
 		select {
-		case <-ctx.Done():
-			slog.Error("Обновление валютных курсов остановлено", "op", op, "error", ctx.Err())
-			return
-		default:
-			currency, err := f.redis.ListenNew(ctx)
-			if err != nil {
-				slog.Error(op, "error", err)
-			}
+		case <-ticker.C:
+			now := time.Now()
 
-			if err = f.storage.SaveNewCurrency(ctx, currency); err != nil {
-				slog.Error(op, "error", err)
-			}
+			if now.Sub(loadedAt) >= f.config.Load().Fetcher.ScheduleRefresh || f.reloadSchedule.Swap(false) {
+				loadedRates, loadedIntervals, err := f.loadSchedule(ctx)
+				if err != nil {
+					if ctx.Err() == nil {
+						slog.Error("Failed to load the fetch schedule, retrying on the next tick", "op", op, "error", err)
+					}
+					continue
+				}
 
-			rates, err := f.storage.GetRates(ctx)
-			if err != nil {
-				slog.Error(op, "error", err)
+				rates, intervals, loadedAt = loadedRates, loadedIntervals, now
 			}
 
-			if err = f.fetchRate(ctx, rates); err != nil {
-				slog.Error(op, "error", err)
+			due := f.dueRates(rates, intervals, nextFetch, now)
+			if len(due) == 0 {
+				continue
 			}
 
-			err = f.redis.PublishUpd(ctx, currency)
-			if err != nil {
-				slog.Error(op, "error", err)
+			if err := f.fetchRate(ctx, due); err != nil {
+				slog.Error("Ошибка при обновлении валютного курса", "rate", due, "error", err)
 			}
+
+		case <-ctx.Done():
+			return errors.Wrap(ctx.Err(), op)
+		}
+	}
+}
+
+// loadSchedule reads the tracked cryptos and their refresh intervals. lead
+// keeps them for Fetcher.ScheduleRefresh, so idle ticks cost no queries.
+func (f *Fetcher) loadSchedule(ctx context.Context) ([]entities.ExchangeRate, map[string]time.Duration, error) {
+	const op = "fetcher.loadSchedule"
+
+	rates, err := f.storage.GetRates(ctx)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, op)
+	}
+
+	intervals, err := f.storage.GetRefreshIntervals(ctx)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, op)
+	}
+
+	return rates, intervals, nil
+}
+
+// dueRates picks the cryptos whose refresh interval has elapsed and books their
+// next run. Shorter intervals go first, so the high-priority tier lands in the
+// first request when the provider quota runs short.
+func (f *Fetcher) dueRates(rates []entities.ExchangeRate, intervals map[string]time.Duration, nextFetch map[string]time.Time, now time.Time) []entities.ExchangeRate {
+	interval := func(code string) time.Duration {
+		if d, ok := intervals[code]; ok && d > 0 {
+			return d
+		}
+		return f.config.Load().Fetcher.TimeTickers
+	}
+
+	due := make([]entities.ExchangeRate, 0, len(rates))
+	for _, rate := range rates {
+		if now.Before(nextFetch[rate.Title]) {
+			continue
+		}
+
+		nextFetch[rate.Title] = now.Add(interval(rate.Title))
+		due = append(due, rate)
+	}
+
+	sort.SliceStable(due, func(i, j int) bool {
+		return interval(due[i].Title) < interval(due[j].Title)
+	})
+
+	return due
+}
+
+func (f *Fetcher) getNewRate(ctx context.Context) {
+	const op = "fetcher.getNewRate"
+
+	if err := f.events.ListenRequested(ctx, f.registerCurrency); err != nil {
+		slog.Error("Failed to listen for new currencies", "op", op, "error", err)
+		return
+	}
+
+	slog.Info("Обновление валютных курсов остановлено", "op", op, "error", ctx.Err())
+}
+
+// registerCurrency starts tracking the requested currency and answers the
+// request with a currency.registered outbox event. It fails, so that the
+// request is delivered again, only on errors worth retrying: a full cap is
+// reported as rejected, provider errors as unavailable and left to the
+// regular schedule once the currency is saved.
+func (f *Fetcher) registerCurrency(ctx context.Context, request entities.CurrencyMessage) error {
+	const op = "fetcher.registerCurrency"
+
+	currency := request.Currency
+
+	ctx, span := tracer.Start(ctx, op, trace.WithAttributes(attribute.String("currency", currency)))
+	defer span.End()
+
+	if err := f.storage.SaveNewCurrency(ctx, currency, request.MaxTracked); err != nil {
+		span.RecordError(err)
+		if !errors.Is(err, entities.ErrRegistrationForbidden) {
+			return errors.Wrap(err, op)
 		}
+
+		slog.Warn("Currency registration rejected", "op", op, "currency", currency, "error", err)
+		result := entities.RegistrationResult{
+			Currency: currency,
+			Status:   entities.RegistrationRejected,
+			Reason:   fmt.Sprintf("limit of %d tracked currencies reached", request.MaxTracked),
+		}
+		if err = f.storage.SaveRegistrationResult(ctx, result); err != nil {
+			return errors.Wrap(err, op)
+		}
+		return nil
+	}
+	f.reloadSchedule.Store(true)
+
+	rates, err := f.storage.GetRates(ctx)
+	if err != nil {
+		span.RecordError(err)
+		return errors.Wrap(err, op)
+	}
+
+	result := entities.RegistrationResult{Currency: currency, Status: entities.RegistrationTracked}
+	if err = f.fetchRate(ctx, filterRates(rates, currency)); err != nil {
+		span.RecordError(err)
+		if ctx.Err() != nil {
+			return errors.Wrap(err, op)
+		}
+		slog.Error(op, "error", err)
+
+		result.Status = entities.RegistrationUnavailable
+		result.Reason = unavailableReason(err)
+	}
+
+	if err = f.storage.SaveRegistrationResult(ctx, result); err != nil {
+		span.RecordError(err)
+		return errors.Wrap(err, op)
+	}
+
+	return nil
+}
+
+// unavailableReason tells the client why the first rate is missing without
+// passing on provider errors, which may contain the request URL.
+func unavailableReason(err error) string {
+	switch {
+	case errors.Is(err, entities.ErrRateLimited):
+		return entities.ErrRateLimited.Error()
+	case errors.Is(err, entities.ErrQuotaExhausted):
+		return entities.ErrQuotaExhausted.Error()
+	default:
+		return "provider request failed"
 	}
 }
 
 func (f *Fetcher) fetchRate(ctx context.Context, rates []entities.ExchangeRate) error {
 	const op = "fetcher.fetchRate"
 
-	ctx, cancel := context.WithTimeout(ctx, f.config.Fetcher.Timeout)
-	defer cancel()
+	ctx, span := tracer.Start(ctx, op, trace.WithAttributes(attribute.Int("currencies", len(rates))))
+	defer span.End()
 
-	apiURL, err := f.getUrl(rates)
+	chunks, err := f.getUrl(rates)
 	if err != nil {
 		return errors.Wrap(err, op)
 	}
 
-	result, err := f.httpClient.ApiClient(ctx, rates, apiURL)
+	var saved int
+	defer func() {
+		metrics.RowsSaved.Observe(float64(saved))
+	}()
+
+	for _, chunk := range chunks {
+		rows, err := f.fetchChunk(ctx, chunk)
+		saved += rows
+		if err != nil {
+			return errors.Wrap(err, op)
+		}
+	}
+
+	return nil
+}
+
+func (f *Fetcher) fetchChunk(ctx context.Context, chunk urlChunk) (int, error) {
+	const op = "fetcher.fetchChunk"
+
+	provider := f.config.Load().Fetcher.Provider
+
+	start := time.Now()
+	result, err := f.httpClient.ApiClient(ctx, chunk.rates, chunk.url)
+	metrics.FetchDuration.WithLabelValues(provider).Observe(time.Since(start).Seconds())
 	if err != nil {
-		return errors.Wrap(err, op)
+		metrics.FetchErrors.WithLabelValues(provider).Inc()
+
+		var rateLimitErr *entities.RateLimitError
+		if errors.As(err, &rateLimitErr) {
+			f.scheduler.Backoff(provider, rateLimitErr.RetryAfter)
+		}
+		return 0, errors.Wrap(err, op)
 	}
 
+	f.scheduler.Success(provider)
+
 	if err := f.storage.SaveRates(ctx, result); err != nil {
-		return errors.Wrap(err, op)
+		return 0, errors.Wrap(err, op)
+	}
+
+	f.lastSuccess.Store(time.Now().UnixNano())
+
+	var rows int
+	for _, rate := range result {
+		for _, fiat := range rate.FiatValues {
+			metrics.LastSuccess.WithLabelValues(rate.Title, fiat.Currency).Set(float64(rate.DateUpdate.Unix()))
+			rows++
+		}
+	}
+
+	return rows, nil
+}
+
+func filterRates(rates []entities.ExchangeRate, currency string) []entities.ExchangeRate {
+	for _, rate := range rates {
+		if rate.Title == currency {
+			return []entities.ExchangeRate{rate}
+		}
 	}
 
 	return nil
 }
 
-func (f *Fetcher) getUrl(rates []entities.ExchangeRate) (string, error) {
+type urlChunk struct {
+	url   string
+	rates []entities.ExchangeRate
+}
+
+// getUrl splits the crypto symbols into as few requests as possible while
+// keeping every URL within Fetcher.MaxURLLength.
+func (f *Fetcher) getUrl(rates []entities.ExchangeRate) ([]urlChunk, error) {
 	const op = "fetcher.getUrl"
 
 	if len(rates) == 0 {
-		return "", fmt.Errorf("%s: пустой список валют", op)
+		return nil, fmt.Errorf("%s: пустой список валют", op)
 	}
 
 	fsyms := make([]string, len(rates))
@@ -129,15 +434,35 @@ func (f *Fetcher) getUrl(rates []entities.ExchangeRate) (string, error) {
 		tsyms[i] = fiat.Currency
 	}
 
-	u, err := url.Parse(f.config.Fetcher.URL)
+	u, err := url.Parse(f.config.Load().Fetcher.URL)
 	if err != nil {
-		return "", errors.Wrap(err, op)
+		return nil, errors.Wrap(err, op)
 	}
 
-	q := u.Query()
-	q.Set("fsyms", strings.Join(fsyms, ","))
-	q.Set("tsyms", strings.Join(tsyms, ","))
-	u.RawQuery = q.Encode()
+	build := func(fsyms []string) string {
+		chunkURL := *u
+
+		q := chunkURL.Query()
+		q.Set("fsyms", strings.Join(fsyms, ","))
+		q.Set("tsyms", strings.Join(tsyms, ","))
+		chunkURL.RawQuery = q.Encode()
+
+		return chunkURL.String()
+	}
+
+	maxLen := f.config.Load().Fetcher.MaxURLLength
+
+	var chunks []urlChunk
+	start := 0
+	for end := 1; end < len(rates); end++ {
+		if maxLen <= 0 || len(build(fsyms[start:end+1])) <= maxLen {
+			continue
+		}
+
+		chunks = append(chunks, urlChunk{url: build(fsyms[start:end]), rates: rates[start:end]})
+		start = end
+	}
+	chunks = append(chunks, urlChunk{url: build(fsyms[start:]), rates: rates[start:]})
 
-	return u.String(), nil
+	return chunks, nil
 }
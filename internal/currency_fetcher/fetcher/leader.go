@@ -0,0 +1,9 @@
+package fetcher
+
+import "context"
+
+type Leader interface {
+	TryAcquire(ctx context.Context) (bool, error)
+	Check(ctx context.Context) error
+	Release(ctx context.Context) error
+}
@@ -1,8 +0,0 @@
-package fetcher
-
-import "context"
-
-type RedisStorage interface {
-	PublishUpd(ctx context.Context, currency string) error
-	ListenNew(ctx context.Context) (string, error)
-}
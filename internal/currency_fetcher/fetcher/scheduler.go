@@ -0,0 +1,238 @@
+package fetcher
+
+import (
+	"context"
+	"github.com/langowen/exchange/internal/entities"
+	"github.com/langowen/exchange/internal/metrics"
+	"github.com/pkg/errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const (
+	minBackoff = 5 * time.Second
+	maxBackoff = 10 * time.Minute
+)
+
+// Budget is a provider request quota. Zero means unlimited.
+type Budget struct {
+	PerMinute int
+	PerMonth  int
+}
+
+type quota struct {
+	budget Budget
+
+	minuteStart time.Time
+	minuteUsed  int
+
+	monthStart time.Time
+	monthUsed  int
+
+	blockedUntil time.Time
+	throttled    int
+}
+
+// UsageStore counts provider requests per calendar month outside the process,
+// so that the monthly budget survives restarts and leader failovers.
+type UsageStore interface {
+	// AddProviderUsage books one request unless the positive limit is reached
+	// and returns the requests booked in month so far.
+	AddProviderUsage(ctx context.Context, provider string, month time.Time, limit int) (used int, ok bool, err error)
+}
+
+// Scheduler hands out provider request slots according to each provider's
+// budget and keeps providers that answered 429 on hold until they recover.
+// The per-minute budget is counted in memory, the monthly one in UsageStore.
+type Scheduler struct {
+	usage UsageStore
+
+	mu     sync.Mutex
+	quotas map[string]*quota
+}
+
+func NewScheduler(usage UsageStore) *Scheduler {
+	return &Scheduler{
+		usage:  usage,
+		quotas: make(map[string]*quota),
+	}
+}
+
+func (s *Scheduler) AddProvider(provider string, budget Budget) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.quotas[provider] = &quota{budget: budget}
+}
+
+// SetBudget changes the provider budget without resetting the usage counted so far.
+func (s *Scheduler) SetBudget(provider string, budget Budget) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.quota(provider).budget = budget
+}
+
+// Wait blocks until the provider may be called and books the slot. It fails
+// immediately with entities.ErrQuotaExhausted when the monthly budget is spent.
+func (s *Scheduler) Wait(ctx context.Context, provider string) error {
+	const op = "fetcher.Scheduler.Wait"
+
+	var window time.Time
+	for {
+		delay, start, err := s.reserve(provider, time.Now())
+		if err != nil {
+			return errors.Wrap(err, op)
+		}
+
+		if delay == 0 {
+			window = start
+			break
+		}
+
+		slog.Debug("Provider quota reached, waiting", "provider", provider, "delay", delay)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return errors.Wrap(ctx.Err(), op)
+		case <-timer.C:
+		}
+	}
+
+	if err := s.bookMonth(ctx, provider, time.Now()); err != nil {
+		// The request is not made, so it must not count against the minute.
+		s.release(provider, window)
+		return errors.Wrap(err, op)
+	}
+
+	return nil
+}
+
+// Backoff puts the provider on hold after a 429. Without Retry-After the pause
+// doubles with every consecutive throttled response.
+func (s *Scheduler) Backoff(provider string, retryAfter time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q := s.quota(provider)
+	q.throttled++
+
+	if retryAfter <= 0 {
+		retryAfter = minBackoff << min(q.throttled-1, 10)
+	}
+	retryAfter = min(retryAfter, maxBackoff)
+
+	q.blockedUntil = time.Now().Add(retryAfter)
+
+	slog.Warn("Provider rate limited, backing off", "provider", provider, "retry_after", retryAfter)
+}
+
+func (s *Scheduler) Success(provider string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.quota(provider).throttled = 0
+}
+
+// reserve takes a slot of the per-minute budget, or returns how long to wait
+// for one. It also returns the start of the minute the slot belongs to.
+func (s *Scheduler) reserve(provider string, now time.Time) (time.Duration, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q := s.quota(provider)
+
+	if now.Before(q.blockedUntil) {
+		return q.blockedUntil.Sub(now), time.Time{}, nil
+	}
+
+	if now.Sub(q.minuteStart) >= time.Minute {
+		q.minuteStart = now
+		q.minuteUsed = 0
+	}
+
+	// The cached monthly count saves a round trip once the budget is known
+	// to be spent; a new month or a raised budget lets the store decide again.
+	if q.monthStart.Equal(startOfMonth(now)) && q.budget.PerMonth > 0 && q.monthUsed >= q.budget.PerMonth {
+		return 0, time.Time{}, entities.ErrQuotaExhausted
+	}
+
+	if q.budget.PerMinute > 0 && q.minuteUsed >= q.budget.PerMinute {
+		return q.minuteStart.Add(time.Minute).Sub(now), time.Time{}, nil
+	}
+
+	q.minuteUsed++
+
+	s.report(provider, q)
+
+	return 0, q.minuteStart, nil
+}
+
+// release gives back a slot taken by reserve in the minute starting at
+// window, unless that minute is over already.
+func (s *Scheduler) release(provider string, window time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q := s.quota(provider)
+	if q.minuteStart.Equal(window) && q.minuteUsed > 0 {
+		q.minuteUsed--
+		s.report(provider, q)
+	}
+}
+
+// bookMonth counts the request against the monthly budget in the store.
+func (s *Scheduler) bookMonth(ctx context.Context, provider string, now time.Time) error {
+	s.mu.Lock()
+	limit := s.quota(provider).budget.PerMonth
+	s.mu.Unlock()
+
+	month := startOfMonth(now)
+
+	used, ok, err := s.usage.AddProviderUsage(ctx, provider, month, limit)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q := s.quota(provider)
+	q.monthStart = month
+	q.monthUsed = used
+	s.report(provider, q)
+
+	if !ok {
+		return entities.ErrQuotaExhausted
+	}
+
+	return nil
+}
+
+func (s *Scheduler) quota(provider string) *quota {
+	q, ok := s.quotas[provider]
+	if !ok {
+		q = &quota{}
+		s.quotas[provider] = q
+	}
+
+	return q
+}
+
+func (s *Scheduler) report(provider string, q *quota) {
+	if q.budget.PerMinute > 0 {
+		metrics.ProviderQuotaRemaining.WithLabelValues(provider, "minute").Set(float64(q.budget.PerMinute - q.minuteUsed))
+	}
+
+	if q.budget.PerMonth > 0 {
+		metrics.ProviderQuotaRemaining.WithLabelValues(provider, "month").Set(float64(q.budget.PerMonth - q.monthUsed))
+	}
+}
+
+func startOfMonth(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
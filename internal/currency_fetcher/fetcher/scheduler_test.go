@@ -0,0 +1,91 @@
+package fetcher
+
+import (
+	"context"
+	"github.com/langowen/exchange/internal/entities"
+	"github.com/pkg/errors"
+	"testing"
+	"time"
+)
+
+// usage books requests in memory, or fails with err.
+type usage struct {
+	used int
+	err  error
+}
+
+func (u *usage) AddProviderUsage(_ context.Context, _ string, _ time.Time, limit int) (int, bool, error) {
+	if u.err != nil {
+		return 0, false, u.err
+	}
+	if limit > 0 && u.used >= limit {
+		return u.used, false, nil
+	}
+	u.used++
+
+	return u.used, true, nil
+}
+
+func TestWaitReleasesMinuteSlotOnMonthError(t *testing.T) {
+	store := &usage{err: errors.New("connection refused")}
+	s := NewScheduler(store)
+	s.AddProvider("cryptocompare", Budget{PerMinute: 2})
+
+	for range 2 {
+		if err := s.Wait(context.Background(), "cryptocompare"); err == nil {
+			t.Fatal("Wait succeeded without booking the month")
+		}
+	}
+
+	// The failed bookings left the minute budget untouched.
+	store.err = nil
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	for i := range 2 {
+		if err := s.Wait(ctx, "cryptocompare"); err != nil {
+			t.Fatalf("Wait %d returned %v, want a free slot", i+1, err)
+		}
+	}
+}
+
+func TestWaitMonthExhausted(t *testing.T) {
+	store := &usage{used: 5}
+	s := NewScheduler(store)
+	s.AddProvider("cryptocompare", Budget{PerMinute: 1, PerMonth: 5})
+
+	for range 3 {
+		if err := s.Wait(context.Background(), "cryptocompare"); !errors.Is(err, entities.ErrQuotaExhausted) {
+			t.Fatalf("Wait returned %v, want an exhausted quota", err)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if used := s.quotas["cryptocompare"].minuteUsed; used != 0 {
+		t.Errorf("%d minute slots used by refused requests, want 0", used)
+	}
+}
+
+func TestRelease(t *testing.T) {
+	s := NewScheduler(&usage{})
+	s.AddProvider("cryptocompare", Budget{PerMinute: 1})
+
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	_, window, err := s.reserve("cryptocompare", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A slot of a minute that is over is not given back to the next one.
+	later := now.Add(time.Minute)
+	if _, _, err = s.reserve("cryptocompare", later); err != nil {
+		t.Fatal(err)
+	}
+	s.release("cryptocompare", window)
+
+	if delay, _, _ := s.reserve("cryptocompare", later); delay == 0 {
+		t.Error("released a slot of the previous minute into the current one")
+	}
+}
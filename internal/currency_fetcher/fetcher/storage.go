@@ -3,10 +3,14 @@ package fetcher
 import (
 	"context"
 	"github.com/langowen/exchange/internal/entities"
+	"time"
 )
 
 type Storage interface {
 	SaveRates(ctx context.Context, rates []entities.ExchangeRate) error
 	GetRates(ctx context.Context) ([]entities.ExchangeRate, error)
-	SaveNewCurrency(ctx context.Context, currency string) error
+	SaveNewCurrency(ctx context.Context, currency string, maxTracked int) error
+	SaveRegistrationResult(ctx context.Context, result entities.RegistrationResult) error
+	GetRefreshIntervals(ctx context.Context) (map[string]time.Duration, error)
+	UsageStore
 }
@@ -0,0 +1,105 @@
+package outbox
+
+import (
+	"context"
+	"github.com/langowen/exchange/deploy/config"
+	"github.com/langowen/exchange/internal/entities"
+	"github.com/langowen/exchange/internal/eventbus"
+	"github.com/langowen/exchange/internal/metrics"
+	"github.com/langowen/exchange/internal/tracing"
+	"log/slog"
+	"strconv"
+	"time"
+)
+
+// Relay publishes outbox events to the event bus. An event is marked published
+// only after the bus accepted it, so delivery is at least once: a crash between
+// the two publishes it again. Every replica may run a relay, they skip the
+// rows locked by each other.
+type Relay struct {
+	storage   Storage
+	publisher Publisher
+	cfg       config.Outbox
+}
+
+func NewRelay(storage Storage, publisher Publisher, cfg config.Outbox) *Relay {
+	return &Relay{
+		storage:   storage,
+		publisher: publisher,
+		cfg:       cfg,
+	}
+}
+
+// Run relays events until ctx is done.
+func (r *Relay) Run(ctx context.Context) {
+	const op = "outbox.Run"
+
+	ticker := time.NewTicker(r.cfg.Interval)
+	defer ticker.Stop()
+
+	cleanup := time.NewTicker(r.cfg.Retention / 24)
+	defer cleanup.Stop()
+
+	for {
+		if r.relay(ctx) {
+			continue
+		}
+
+		select {
+		case <-ticker.C:
+		case <-r.storage.OutboxWritten():
+		case <-cleanup.C:
+			r.cleanup(ctx)
+		case <-ctx.Done():
+			slog.Info("Outbox relay stopped", "op", op)
+			return
+		}
+	}
+}
+
+// relay publishes one batch and reports whether a full batch went out, that is
+// whether more events are probably waiting.
+func (r *Relay) relay(ctx context.Context) bool {
+	const op = "outbox.relay"
+
+	n, err := r.storage.RelayOutbox(ctx, r.cfg.BatchSize, r.publish)
+	if err != nil {
+		if ctx.Err() == nil {
+			metrics.OutboxErrors.Inc()
+			slog.Error("Failed to relay outbox events", "op", op, "published", n, "error", err)
+		}
+		return false
+	}
+
+	return n == r.cfg.BatchSize
+}
+
+func (r *Relay) publish(ctx context.Context, event entities.OutboxEvent) error {
+	headers := make(map[string]string, len(event.Headers)+1)
+	for key, value := range event.Headers {
+		headers[key] = value
+	}
+	headers[eventbus.HeaderEventID] = strconv.FormatInt(event.ID, 10)
+
+	if err := r.publisher.Publish(tracing.Extract(ctx, event.Headers), event.Topic, event.Payload, headers); err != nil {
+		return err
+	}
+
+	metrics.OutboxPublished.WithLabelValues(event.Topic).Inc()
+
+	return nil
+}
+
+func (r *Relay) cleanup(ctx context.Context) {
+	const op = "outbox.cleanup"
+
+	deleted, err := r.storage.DeleteOutbox(ctx, time.Now().Add(-r.cfg.Retention))
+	if err != nil {
+		slog.Error("Failed to clean up outbox", "op", op, "error", err)
+		return
+	}
+
+	if deleted > 0 {
+		slog.Debug("Outbox cleaned up", "op", op, "deleted", deleted)
+	}
+}
@@ -0,0 +1,17 @@
+package outbox
+
+import (
+	"context"
+	"github.com/langowen/exchange/internal/entities"
+	"time"
+)
+
+type Storage interface {
+	RelayOutbox(ctx context.Context, limit int, publish func(ctx context.Context, event entities.OutboxEvent) error) (int, error)
+	DeleteOutbox(ctx context.Context, before time.Time) (int64, error)
+	OutboxWritten() <-chan struct{}
+}
+
+type Publisher interface {
+	Publish(ctx context.Context, topic string, payload []byte, headers map[string]string) error
+}
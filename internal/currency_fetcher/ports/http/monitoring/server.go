@@ -0,0 +1,51 @@
+package monitoring
+
+import (
+	"context"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/langowen/exchange/deploy/config"
+	"github.com/langowen/exchange/internal/health"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"log/slog"
+	"net/http"
+)
+
+func StartServer(ctx context.Context, cfg *config.FetcherConfig, checker *health.Checker) <-chan struct{} {
+	r := chi.NewRouter()
+
+	r.Handle("/metrics", promhttp.Handler())
+	r.Get("/healthz", checker.Liveness)
+	r.Get("/readyz", checker.Readiness)
+
+	server := &http.Server{
+		Addr:         ":" + cfg.Monitoring.Port,
+		Handler:      r,
+		ReadTimeout:  cfg.Monitoring.Timeout,
+		WriteTimeout: cfg.Monitoring.Timeout,
+		IdleTimeout:  cfg.Monitoring.IdleTimeout,
+	}
+
+	doneChan := make(chan struct{})
+
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("Monitoring server error", "error", err.Error())
+		}
+	}()
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Shutdown.Timeout)
+		defer cancel()
+
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			slog.Error("Failed to stop monitoring server", "error", err)
+		}
+
+		close(doneChan)
+	}()
+
+	return doneChan
+}
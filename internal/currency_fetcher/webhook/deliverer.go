@@ -0,0 +1,147 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/langowen/exchange/deploy/config"
+	"github.com/langowen/exchange/internal/entities"
+	"github.com/langowen/exchange/internal/metrics"
+	"log/slog"
+	"strconv"
+	"time"
+)
+
+// Deliverer POSTs queued payloads to their webhooks. Failed deliveries are
+// retried with exponential backoff and moved to the dead letters after
+// MaxAttempts. A delivery may reach its receiver more than once; receivers
+// deduplicate on the event ID.
+type Deliverer struct {
+	storage Storage
+	client  HTTPClient
+	cfg     config.Webhooks
+}
+
+func NewDeliverer(storage Storage, client HTTPClient, cfg config.Webhooks) *Deliverer {
+	return &Deliverer{
+		storage: storage,
+		client:  client,
+		cfg:     cfg,
+	}
+}
+
+// Run delivers queued payloads until ctx is done.
+func (d *Deliverer) Run(ctx context.Context) {
+	const op = "webhook.Deliverer.Run"
+
+	ticker := time.NewTicker(d.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		if d.deliverBatch(ctx) {
+			continue
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			slog.Info("Webhook deliverer stopped", "op", op)
+			return
+		}
+	}
+}
+
+// deliverBatch reports whether a full batch was claimed, that is whether more
+// deliveries are probably due.
+func (d *Deliverer) deliverBatch(ctx context.Context) bool {
+	const op = "webhook.Deliverer.deliverBatch"
+
+	// The lease outlives the requests of the whole batch, so no other
+	// replica picks the same deliveries meanwhile.
+	lease := time.Duration(d.cfg.BatchSize+1) * d.cfg.Timeout
+
+	deliveries, err := d.storage.ClaimWebhookDeliveries(ctx, d.cfg.BatchSize, lease)
+	if err != nil {
+		if ctx.Err() == nil {
+			slog.Error("Failed to claim webhook deliveries", "op", op, "error", err)
+		}
+		return false
+	}
+
+	for _, delivery := range deliveries {
+		if ctx.Err() != nil {
+			return false
+		}
+		d.deliver(ctx, delivery)
+	}
+
+	return len(deliveries) == d.cfg.BatchSize
+}
+
+func (d *Deliverer) deliver(ctx context.Context, delivery entities.WebhookDelivery) {
+	const op = "webhook.Deliverer.deliver"
+
+	log := slog.With("op", op, "webhook_id", delivery.WebhookID, "event_id", delivery.EventID)
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	headers := map[string]string{
+		entities.WebhookEventIDHeader:   delivery.EventID,
+		entities.WebhookTimestampHeader: timestamp,
+		entities.WebhookSignatureHeader: Sign(delivery.Secret, timestamp, delivery.Payload),
+	}
+
+	postCtx, cancel := context.WithTimeout(ctx, d.cfg.Timeout)
+	err := d.client.Post(postCtx, delivery.URL, delivery.Payload, headers)
+	cancel()
+
+	// Results are recorded even when ctx is done, or a delivered payload
+	// would be sent again after the lease.
+	storeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), d.cfg.Timeout)
+	defer cancel()
+
+	if err == nil {
+		metrics.WebhookDeliveries.WithLabelValues("ok").Inc()
+		if err = d.storage.CompleteWebhookDelivery(storeCtx, delivery.ID); err != nil {
+			log.Error("Failed to complete webhook delivery", "error", err)
+		}
+		return
+	}
+
+	attempts := delivery.Attempts + 1
+	if attempts >= d.cfg.MaxAttempts {
+		metrics.WebhookDeliveries.WithLabelValues("dead").Inc()
+		log.Warn("Webhook delivery failed for good", "attempts", attempts, "error", err)
+		if err = d.storage.DeadLetterWebhookDelivery(storeCtx, delivery.ID, err.Error()); err != nil {
+			log.Error("Failed to dead-letter webhook delivery", "error", err)
+		}
+		return
+	}
+
+	metrics.WebhookDeliveries.WithLabelValues("retry").Inc()
+	log.Debug("Webhook delivery failed, retrying", "attempts", attempts, "error", err)
+	if err = d.storage.RetryWebhookDelivery(storeCtx, delivery.ID, time.Now().Add(d.backoff(attempts)), err.Error()); err != nil {
+		log.Error("Failed to reschedule webhook delivery", "error", err)
+	}
+}
+
+func (d *Deliverer) backoff(attempts int) time.Duration {
+	delay := d.cfg.RetryBaseDelay
+	for i := 1; i < attempts && delay < d.cfg.RetryMaxDelay; i++ {
+		delay *= 2
+	}
+
+	return min(delay, d.cfg.RetryMaxDelay)
+}
+
+// Sign returns the value of the signature header for a request body sent at
+// timestamp, in Unix seconds. Receivers recompute it with the webhook secret
+// and should reject old timestamps to prevent replays.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
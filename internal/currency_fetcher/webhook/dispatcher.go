@@ -0,0 +1,136 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/langowen/exchange/internal/entities"
+	"github.com/pkg/errors"
+	"log/slog"
+	"sort"
+	"strconv"
+)
+
+// Dispatcher evaluates webhook conditions against every rate update and
+// queues a delivery for each webhook that fires. Updates are delivered again
+// when queuing fails; the queue ignores deliveries it already holds.
+type Dispatcher struct {
+	storage Storage
+	events  Events
+}
+
+func NewDispatcher(storage Storage, events Events) *Dispatcher {
+	return &Dispatcher{
+		storage: storage,
+		events:  events,
+	}
+}
+
+// Run evaluates rate updates until ctx is done.
+func (d *Dispatcher) Run(ctx context.Context) {
+	const op = "webhook.Dispatcher.Run"
+
+	if err := d.events.ListenUpdated(ctx, "webhooks", d.dispatch); err != nil {
+		slog.Error("Failed to listen for rate updates", "op", op, "error", err)
+		return
+	}
+
+	slog.Info("Webhook dispatcher stopped", "op", op)
+}
+
+func (d *Dispatcher) dispatch(ctx context.Context, eventID string, update entities.RatesUpdate) error {
+	const op = "webhook.Dispatcher.dispatch"
+
+	fiats := make([]string, 0, len(update.Rates))
+	for fiat := range update.Rates {
+		fiats = append(fiats, fiat)
+	}
+	sort.Strings(fiats)
+
+	for _, fiat := range fiats {
+		if err := d.dispatchPair(ctx, eventID, update, fiat); err != nil {
+			return errors.Wrap(err, op)
+		}
+	}
+
+	return nil
+}
+
+func (d *Dispatcher) dispatchPair(ctx context.Context, eventID string, update entities.RatesUpdate, fiat string) error {
+	hooks, err := d.storage.WebhooksForPair(ctx, update.Currency, fiat)
+	if err != nil || len(hooks) == 0 {
+		return err
+	}
+
+	current := update.Rates[fiat]
+
+	// Every crossing compares with the same previous rate.
+	var (
+		last    float64
+		hasLast bool
+	)
+
+	for _, hook := range hooks {
+		var previous float64
+		err = nil
+
+		switch hook.Condition {
+		case entities.ConditionMoves:
+			previous, err = d.storage.RateBefore(ctx, update.Currency, fiat, update.UpdatedAt.Add(-hook.Window))
+		default:
+			if !hasLast {
+				last, err = d.storage.RateBefore(ctx, update.Currency, fiat, update.UpdatedAt)
+				hasLast = err == nil
+			}
+			previous = last
+		}
+		if errors.Is(err, entities.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if !hook.Fires(previous, current, update.UpdatedAt) {
+			continue
+		}
+
+		if err = d.enqueue(ctx, eventID, hook, update, previous, current); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d *Dispatcher) enqueue(ctx context.Context, eventID string, hook entities.Webhook, update entities.RatesUpdate, previous, current float64) error {
+	payload := entities.WebhookPayload{
+		EventID:   eventID + ":" + strconv.FormatInt(hook.ID, 10),
+		WebhookID: hook.ID,
+		Condition: hook.Condition,
+		Threshold: hook.Threshold,
+		Crypto:    update.Currency,
+		Fiat:      hook.Fiat,
+		Rate:      current,
+		Previous:  previous,
+		UpdatedAt: update.UpdatedAt,
+	}
+	if previous != 0 {
+		payload.ChangePct = (current - previous) / previous * 100
+	}
+	if hook.Window > 0 {
+		payload.Window = hook.Window.String()
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	slog.Debug("Webhook fired", "webhook_id", hook.ID, "pair", update.Currency+"/"+hook.Fiat, "condition", hook.Condition)
+
+	return d.storage.EnqueueWebhookDelivery(ctx, entities.WebhookDelivery{
+		WebhookID: hook.ID,
+		EventID:   payload.EventID,
+		Payload:   body,
+	}, update.UpdatedAt)
+}
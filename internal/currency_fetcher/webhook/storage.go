@@ -0,0 +1,26 @@
+package webhook
+
+import (
+	"context"
+	"github.com/langowen/exchange/internal/entities"
+	"time"
+)
+
+type Storage interface {
+	WebhooksForPair(ctx context.Context, crypto, fiat string) ([]entities.Webhook, error)
+	RateBefore(ctx context.Context, crypto, fiat string, before time.Time) (float64, error)
+	EnqueueWebhookDelivery(ctx context.Context, delivery entities.WebhookDelivery, firedAt time.Time) error
+
+	ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]entities.WebhookDelivery, error)
+	CompleteWebhookDelivery(ctx context.Context, id int64) error
+	RetryWebhookDelivery(ctx context.Context, id int64, next time.Time, lastError string) error
+	DeadLetterWebhookDelivery(ctx context.Context, id int64, lastError string) error
+}
+
+type Events interface {
+	ListenUpdated(ctx context.Context, consumer string, handle func(ctx context.Context, eventID string, update entities.RatesUpdate) error) error
+}
+
+type HTTPClient interface {
+	Post(ctx context.Context, url string, body []byte, headers map[string]string) error
+}
@@ -0,0 +1,116 @@
+package entities
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"time"
+)
+
+// Alert operators. above and below fire on every tick past the threshold,
+// limited by the cooldown; crossings fire on the tick that passes it.
+const (
+	OperatorAbove        = "above"
+	OperatorBelow        = "below"
+	OperatorCrossesAbove = "crosses_above"
+	OperatorCrossesBelow = "crosses_below"
+)
+
+// Alert channels. Firings are always recorded; the webhook channel also
+// POSTs them to a registered webhook.
+const (
+	ChannelNone    = "none"
+	ChannelWebhook = "webhook"
+)
+
+const alertMaxCooldown = 30 * 24 * time.Hour
+
+type AlertRule struct {
+	ID          int64         `json:"id"`
+	APIKeyID    int           `json:"api_key_id,omitempty"`
+	Crypto      string        `json:"crypto"`
+	Fiat        string        `json:"fiat"`
+	Operator    string        `json:"operator"`
+	Threshold   float64       `json:"threshold"`
+	Cooldown    time.Duration `json:"-"`
+	Channel     string        `json:"channel"`
+	WebhookID   int64         `json:"webhook_id,omitempty"`
+	Active      bool          `json:"active"`
+	LastFiredAt *time.Time    `json:"last_fired_at,omitempty"`
+	CreatedAt   time.Time     `json:"created_at"`
+}
+
+func (a AlertRule) MarshalJSON() ([]byte, error) {
+	type alertRule AlertRule
+
+	return json.Marshal(struct {
+		alertRule
+		Cooldown string `json:"cooldown"`
+	}{alertRule(a), a.Cooldown.String()})
+}
+
+// Validate checks the fields set by the user.
+func (a *AlertRule) Validate() error {
+	if !ValidCurrencyCode(a.Crypto) || !ValidCurrencyCode(a.Fiat) {
+		return errors.New("crypto and fiat must be currency codes")
+	}
+
+	switch a.Operator {
+	case OperatorAbove, OperatorBelow, OperatorCrossesAbove, OperatorCrossesBelow:
+	default:
+		return errors.New("operator must be one of above, below, crosses_above, crosses_below")
+	}
+
+	if a.Threshold <= 0 || math.IsInf(a.Threshold, 0) || math.IsNaN(a.Threshold) {
+		return errors.New("threshold must be a positive rate")
+	}
+
+	if a.Cooldown < 0 || a.Cooldown > alertMaxCooldown {
+		return errors.New("cooldown must be within [0, 720h]")
+	}
+
+	switch a.Channel {
+	case ChannelNone:
+		if a.WebhookID != 0 {
+			return errors.New("webhook_id requires the webhook channel")
+		}
+	case ChannelWebhook:
+		if a.WebhookID <= 0 {
+			return errors.New("webhook_id is required with the webhook channel")
+		}
+	default:
+		return errors.New("channel must be one of none, webhook")
+	}
+
+	return nil
+}
+
+// CoolingDown reports whether the rule fired less than Cooldown before now.
+func (a *AlertRule) CoolingDown(now time.Time) bool {
+	return a.LastFiredAt != nil && now.Before(a.LastFiredAt.Add(a.Cooldown))
+}
+
+// AlertFiring records a rule that fired on a rate update. It is also the
+// payload POSTed through the webhook channel.
+type AlertFiring struct {
+	ID        int64     `json:"id"`
+	RuleID    int64     `json:"rule_id"`
+	EventID   string    `json:"event_id"`
+	Crypto    string    `json:"crypto"`
+	Fiat      string    `json:"fiat"`
+	Operator  string    `json:"operator"`
+	Threshold float64   `json:"threshold"`
+	Rate      float64   `json:"rate"`
+	Previous  *float64  `json:"previous,omitempty"`
+	FiredAt   time.Time `json:"fired_at"`
+}
+
+// AlertFiringFilter selects alert firings. Empty fields do not filter.
+type AlertFiringFilter struct {
+	APIKeyID int
+	RuleID   int64
+	From     time.Time
+	To       time.Time
+	Limit    int
+	Offset   int
+}
@@ -0,0 +1,32 @@
+package entities
+
+import "time"
+
+const (
+	ScopePublic = "public"
+	ScopeAdmin  = "admin"
+)
+
+type APIKey struct {
+	ID        int        `json:"id"`
+	Name      string     `json:"name"`
+	Scope     string     `json:"scope"`
+	RateLimit int        `json:"rate_limit"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// Allows reports whether the key may access routes of the given scope.
+// Admin keys can use every public route.
+func (k *APIKey) Allows(scope string) bool {
+	return k.Scope == scope || k.Scope == ScopeAdmin
+}
+
+// RateLimit is the state of a token bucket after a request was counted.
+type RateLimit struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
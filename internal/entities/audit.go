@@ -0,0 +1,74 @@
+package entities
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	ActionCurrencyRegister = "currency.register"
+	ActionCurrencyReject   = "currency.register_rejected"
+	ActionCurrencyDisable  = "currency.disable"
+	ActionCurrencyEnable   = "currency.enable"
+	ActionCurrencyRename   = "currency.rename"
+	ActionCurrencyDelete   = "currency.delete"
+	ActionAPIKeyCreate     = "api_key.create"
+	ActionAPIKeyRevoke     = "api_key.revoke"
+	ActionWebhookCreate    = "webhook.create"
+	ActionWebhookDelete    = "webhook.delete"
+	ActionWebhookRedeliver = "webhook.redeliver"
+	ActionAlertCreate      = "alert.create"
+	ActionAlertUpdate      = "alert.update"
+	ActionAlertDelete      = "alert.delete"
+)
+
+const (
+	ActorSystem    = "system"
+	ActorAnonymous = "anonymous"
+)
+
+type AuditEntry struct {
+	ID        int64          `json:"id"`
+	Actor     string         `json:"actor"`
+	Action    string         `json:"action"`
+	Target    string         `json:"target"`
+	RequestID string         `json:"request_id"`
+	RemoteIP  string         `json:"remote_ip"`
+	Details   map[string]any `json:"details,omitempty"`
+	CreatedAt time.Time      `json:"created_at"`
+}
+
+// AuditFilter selects audit entries. Empty fields do not filter.
+type AuditFilter struct {
+	Actor  string
+	Action string
+	Target string
+	From   time.Time
+	To     time.Time
+	Limit  int
+	Offset int
+}
+
+// RequestMeta identifies who made a request, for the audit trail.
+type RequestMeta struct {
+	Actor     string
+	RequestID string
+	RemoteIP  string
+}
+
+type requestMetaKey struct{}
+
+func WithRequestMeta(ctx context.Context, meta RequestMeta) context.Context {
+	return context.WithValue(ctx, requestMetaKey{}, meta)
+}
+
+// RequestMetaFromContext falls back to ActorSystem for work that was not
+// started by an HTTP request.
+func RequestMetaFromContext(ctx context.Context) RequestMeta {
+	meta, ok := ctx.Value(requestMetaKey{}).(RequestMeta)
+	if !ok {
+		return RequestMeta{Actor: ActorSystem}
+	}
+
+	return meta
+}
@@ -0,0 +1,21 @@
+package entities
+
+import "regexp"
+
+// MaxCurrencyCodeLength is the width of the code columns.
+const MaxCurrencyCodeLength = 10
+
+var currencyCode = regexp.MustCompile(`^[A-Z0-9]{1,10}$`)
+
+// Cryptocurrency is a tracked crypto as seen by admins. Zero intervals mean
+// the service-wide defaults apply.
+type Cryptocurrency struct {
+	Code               string `json:"code"`
+	Active             bool   `json:"active"`
+	RefreshIntervalSec int    `json:"refresh_interval_sec,omitempty"`
+	MaxAgeSec          int    `json:"max_age_sec,omitempty"`
+}
+
+func ValidCurrencyCode(code string) bool {
+	return currencyCode.MatchString(code)
+}
@@ -1,13 +1,43 @@
 package entities
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"time"
+)
 
 //TODO типичные ошибки. Для конструкторов, сервиса
 
 var (
-	ErrNotFound      = errors.New("entity not found")
-	ErrRedisTimeout  = errors.New("timeout waiting for Redis message")
-	ErrRedisCanceled = errors.New("redis subscription canceled")
+	ErrNotFound              = errors.New("entity not found")
+	ErrRedisTimeout          = errors.New("timeout waiting for Redis message")
+	ErrRedisCanceled         = errors.New("redis subscription canceled")
+	ErrRateLimited           = errors.New("provider rate limit exceeded")
+	ErrQuotaExhausted        = errors.New("provider request quota exhausted")
+	ErrStaleRate             = errors.New("rate is older than its max age")
+	ErrUnauthorized          = errors.New("missing or invalid API key")
+	ErrForbidden             = errors.New("API key scope does not allow this action")
+	ErrInvalidArgument       = errors.New("invalid argument")
+	ErrAlreadyExists         = errors.New("entity already exists")
+	ErrRegistrationForbidden = errors.New("currency registration is not allowed")
+	ErrRateUnavailable       = errors.New("no rate available for the currency")
 )
 
+// RateLimitError is returned by provider clients on HTTP 429. RetryAfter is
+// zero when the provider did not say how long to wait.
+type RateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	if e.RetryAfter > 0 {
+		return fmt.Sprintf("%s, retry after %s", ErrRateLimited, e.RetryAfter)
+	}
+	return ErrRateLimited.Error()
+}
+
+func (e *RateLimitError) Is(target error) bool {
+	return target == ErrRateLimited
+}
+
 //TODO завернуть все ошибки https://github.com/pkg/errors
@@ -0,0 +1,82 @@
+package entities
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// CurrencyMessage is the payload exchanged between api_service and
+// currency_fetcher. The trace context travels in the event headers.
+// MaxTracked is the cap on tracked currencies a registration request must
+// respect, 0 for none.
+type CurrencyMessage struct {
+	Currency   string `json:"currency"`
+	MaxTracked int    `json:"max_tracked,omitempty"`
+}
+
+func (m CurrencyMessage) Marshal() (string, error) {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+// ParseCurrencyMessage also accepts the bare currency code sent by
+// services that predate the JSON envelope.
+func ParseCurrencyMessage(payload string) CurrencyMessage {
+	var msg CurrencyMessage
+	if err := json.Unmarshal([]byte(payload), &msg); err != nil || msg.Currency == "" {
+		return CurrencyMessage{Currency: payload}
+	}
+
+	return msg
+}
+
+// RatesUpdate is the payload of a rates.updated event: the new rate of a
+// currency per fiat.
+type RatesUpdate struct {
+	Currency  string             `json:"currency"`
+	Rates     map[string]float64 `json:"rates"`
+	UpdatedAt time.Time          `json:"updated_at"`
+}
+
+func NewRatesUpdate(rate ExchangeRate) RatesUpdate {
+	rates := make(map[string]float64, len(rate.FiatValues))
+	for _, fiat := range rate.FiatValues {
+		rates[fiat.Currency] = fiat.Amount
+	}
+
+	return RatesUpdate{Currency: rate.Title, Rates: rates, UpdatedAt: rate.DateUpdate}
+}
+
+// Outcomes of a registration request.
+const (
+	RegistrationTracked     = "tracked"
+	RegistrationRejected    = "rejected"
+	RegistrationUnavailable = "unavailable"
+)
+
+// RegistrationResult is the payload of a currency.registered event: how the
+// fetcher answered a registration request, and why when it was not tracked.
+type RegistrationResult struct {
+	Currency string `json:"currency"`
+	Status   string `json:"status"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// Err returns nil for a tracked currency and the matching error otherwise.
+func (r RegistrationResult) Err() error {
+	switch r.Status {
+	case RegistrationTracked:
+		return nil
+	case RegistrationRejected:
+		return fmt.Errorf("%w: %s", ErrRegistrationForbidden, r.Reason)
+	case RegistrationUnavailable:
+		return fmt.Errorf("%w: %s", ErrRateUnavailable, r.Reason)
+	default:
+		return fmt.Errorf("unknown registration status %q", r.Status)
+	}
+}
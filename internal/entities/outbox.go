@@ -0,0 +1,10 @@
+package entities
+
+// OutboxEvent is an event saved in the same transaction as the change it
+// announces, waiting to be relayed to the event bus.
+type OutboxEvent struct {
+	ID      int64
+	Topic   string
+	Payload []byte
+	Headers map[string]string
+}
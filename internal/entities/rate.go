@@ -2,15 +2,29 @@ package entities
 
 import "time"
 
+// ExchangeRate holds the rates of a crypto. Age and staleness are only
+// reported for the latest rates: the age is the one of the oldest pair, and
+// the crypto is stale when any of its pairs is.
 type ExchangeRate struct {
 	Title      string
 	FiatValues []FiatPrice
 	DateUpdate time.Time
+	AgeSeconds int64 `json:"age_seconds"`
+	IsStale    bool  `json:"is_stale"`
 }
 
 type FiatPrice struct {
-	Currency string
-	Amount   float64
+	Currency   string
+	Amount     float64
+	DateUpdate time.Time `json:"-"`
+	AgeSeconds int64     `json:"age_seconds,omitempty"`
+	IsStale    bool      `json:"is_stale,omitempty"`
+}
+
+// Pair is a crypto/fiat currency pair.
+type Pair struct {
+	Crypto string
+	Fiat   string
 }
 
 func NewRate(title string, values []FiatPrice, date time.Time) (*ExchangeRate, error) {
@@ -0,0 +1,31 @@
+package entities
+
+import "time"
+
+// RateStats summarizes the rates of a crypto saved within [From, To).
+type RateStats struct {
+	Crypto string      `json:"crypto"`
+	Window string      `json:"window"`
+	From   time.Time   `json:"from"`
+	To     time.Time   `json:"to"`
+	Fiats  []FiatStats `json:"fiats"`
+}
+
+// FiatStats are the statistics of one pair over a window. Open and Current
+// are the first and last rates in the window, StdDev is the sample standard
+// deviation, and TWAP the average weighted by how long each rate was current.
+type FiatStats struct {
+	Currency  string    `json:"currency"`
+	Current   float64   `json:"current"`
+	CurrentAt time.Time `json:"current_at"`
+	Open      float64   `json:"open"`
+	OpenAt    time.Time `json:"open_at"`
+	Change    float64   `json:"change"`
+	ChangePct float64   `json:"change_pct"`
+	High      float64   `json:"high"`
+	Low       float64   `json:"low"`
+	Avg       float64   `json:"avg"`
+	TWAP      float64   `json:"twap"`
+	StdDev    float64   `json:"stddev"`
+	Count     int       `json:"count"`
+}
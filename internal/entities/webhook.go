@@ -0,0 +1,199 @@
+package entities
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/netip"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Webhook conditions. Crossings fire once when the rate passes the threshold;
+// moves fires when the rate changed by more than Threshold percent over
+// Window, at most once per Window.
+const (
+	ConditionCrosses      = "crosses"
+	ConditionCrossesAbove = "crosses_above"
+	ConditionCrossesBelow = "crosses_below"
+	ConditionMoves        = "moves"
+)
+
+// Headers of a webhook request. The signature is the hex HMAC-SHA256 of
+// "<timestamp>.<body>" keyed with the webhook secret, prefixed with "sha256=".
+const (
+	WebhookSignatureHeader = "X-Exchange-Signature"
+	WebhookTimestampHeader = "X-Exchange-Timestamp"
+	WebhookEventIDHeader   = "X-Exchange-Event-Id"
+)
+
+const (
+	webhookMaxURLLength    = 2048
+	webhookMaxThresholdPct = 1000
+	webhookMinWindow       = time.Minute
+	webhookMaxWindow       = 7 * 24 * time.Hour
+)
+
+// nonPublicPrefixes are the ranges, besides the private, loopback,
+// link-local, multicast and unspecified ones, that webhooks must not reach:
+// shared address space, benchmarking, reserved, and translation prefixes
+// that map onto IPv4.
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+	netip.MustParsePrefix("2001::/32"),
+	netip.MustParsePrefix("2002::/16"),
+}
+
+// PublicAddress reports whether addr may be the target of a webhook, that is
+// whether it is a global unicast address outside of the private and reserved
+// ranges. IPv4-mapped IPv6 addresses are checked as IPv4.
+func PublicAddress(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return false
+	}
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+type Webhook struct {
+	ID          int64         `json:"id"`
+	APIKeyID    int           `json:"api_key_id,omitempty"`
+	URL         string        `json:"url"`
+	Secret      string        `json:"-"`
+	Crypto      string        `json:"crypto"`
+	Fiat        string        `json:"fiat"`
+	Condition   string        `json:"condition"`
+	Threshold   float64       `json:"threshold"`
+	Window      time.Duration `json:"-"`
+	LastFiredAt *time.Time    `json:"last_fired_at,omitempty"`
+	CreatedAt   time.Time     `json:"created_at"`
+}
+
+func (w Webhook) MarshalJSON() ([]byte, error) {
+	type webhook Webhook
+
+	var window string
+	if w.Window > 0 {
+		window = w.Window.String()
+	}
+
+	return json.Marshal(struct {
+		webhook
+		Window string `json:"window,omitempty"`
+	}{webhook(w), window})
+}
+
+// Validate checks the fields set by the user. URLs naming an internal host
+// outright are rejected here; the webhook client checks the resolved
+// addresses again on every connection.
+func (w *Webhook) Validate() error {
+	u, err := url.Parse(w.URL)
+	switch {
+	case err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "":
+		return errors.New("url must be an absolute http or https URL")
+	case len(w.URL) > webhookMaxURLLength:
+		return errors.New("url is too long")
+	case !publicHost(u.Hostname()):
+		return errors.New("url must point to a public host")
+	case !ValidCurrencyCode(w.Crypto) || !ValidCurrencyCode(w.Fiat):
+		return errors.New("crypto and fiat must be currency codes")
+	}
+
+	switch w.Condition {
+	case ConditionCrosses, ConditionCrossesAbove, ConditionCrossesBelow:
+		if w.Threshold <= 0 || math.IsInf(w.Threshold, 0) {
+			return errors.New("threshold must be a positive rate")
+		}
+		if w.Window != 0 {
+			return errors.New("window is only used by the moves condition")
+		}
+	case ConditionMoves:
+		if w.Threshold <= 0 || w.Threshold > webhookMaxThresholdPct {
+			return errors.New("threshold must be a percentage within (0, 1000]")
+		}
+		if w.Window < webhookMinWindow || w.Window > webhookMaxWindow {
+			return errors.New("window must be within [1m, 168h]")
+		}
+	default:
+		return errors.New("condition must be one of crosses, crosses_above, crosses_below, moves")
+	}
+
+	return nil
+}
+
+// publicHost rejects IP literals outside of the public ranges and names of
+// the local host. Other names are only checked once resolved.
+func publicHost(host string) bool {
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return PublicAddress(addr)
+	}
+
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	return host != "localhost" && !strings.HasSuffix(host, ".localhost")
+}
+
+// Fires reports whether the condition is met by a rate going from previous to
+// current, previous being the last rate before the update for crossings and
+// the rate Window ago for moves.
+func (w *Webhook) Fires(previous, current float64, now time.Time) bool {
+	switch w.Condition {
+	case ConditionCrosses:
+		return (previous < w.Threshold && current >= w.Threshold) || (previous > w.Threshold && current <= w.Threshold)
+	case ConditionCrossesAbove:
+		return previous < w.Threshold && current >= w.Threshold
+	case ConditionCrossesBelow:
+		return previous > w.Threshold && current <= w.Threshold
+	case ConditionMoves:
+		if previous <= 0 {
+			return false
+		}
+		if w.LastFiredAt != nil && now.Before(w.LastFiredAt.Add(w.Window)) {
+			return false
+		}
+		return math.Abs(current-previous)/previous*100 >= w.Threshold
+	default:
+		return false
+	}
+}
+
+// WebhookPayload is the JSON body POSTed to a webhook.
+type WebhookPayload struct {
+	EventID   string    `json:"event_id"`
+	WebhookID int64     `json:"webhook_id"`
+	Condition string    `json:"condition"`
+	Threshold float64   `json:"threshold"`
+	Window    string    `json:"window,omitempty"`
+	Crypto    string    `json:"crypto"`
+	Fiat      string    `json:"fiat"`
+	Rate      float64   `json:"rate"`
+	Previous  float64   `json:"previous"`
+	ChangePct float64   `json:"change_pct"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// WebhookDelivery is a payload waiting to be POSTed, or that failed for good
+// when it is a dead letter.
+type WebhookDelivery struct {
+	ID        int64           `json:"id"`
+	WebhookID int64           `json:"webhook_id"`
+	URL       string          `json:"-"`
+	Secret    string          `json:"-"`
+	EventID   string          `json:"event_id"`
+	Payload   json.RawMessage `json:"payload"`
+	Attempts  int             `json:"attempts"`
+	LastError string          `json:"last_error,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+	FailedAt  *time.Time      `json:"failed_at,omitempty"`
+}
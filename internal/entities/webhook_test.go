@@ -0,0 +1,29 @@
+package entities
+
+import "testing"
+
+func TestWebhookValidateURL(t *testing.T) {
+	tests := []struct {
+		url   string
+		valid bool
+	}{
+		{url: "https://hooks.example.com/rates", valid: true},
+		{url: "http://93.184.216.34:8080/hook", valid: true},
+		{url: "ftp://hooks.example.com/rates"},
+		{url: "/rates"},
+		{url: "http://localhost:8080/hook"},
+		{url: "http://api.LOCALHOST./hook"},
+		{url: "http://127.0.0.1/hook"},
+		{url: "http://169.254.169.254/latest/meta-data"},
+		{url: "http://10.0.0.5/hook"},
+		{url: "http://[::1]/hook"},
+		{url: "http://[::ffff:192.168.0.1]/hook"},
+	}
+
+	for _, tt := range tests {
+		hook := Webhook{URL: tt.url, Crypto: "BTC", Fiat: "USD", Condition: ConditionCrosses, Threshold: 70000}
+		if err := hook.Validate(); (err == nil) != tt.valid {
+			t.Errorf("Validate(%s) = %v, want valid %v", tt.url, err, tt.valid)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+// Package bustest holds the test helpers shared by the eventbus
+// implementations and a conformance suite that runs against each of them.
+package bustest
+
+import (
+	"context"
+	"github.com/langowen/exchange/internal/eventbus"
+	"github.com/pkg/errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	Topic   = "rates.updated"
+	Group   = "fetcher"
+	Timeout = 5 * time.Second
+)
+
+// Subscribe runs Subscribe in the background and stops it when the test ends.
+func Subscribe(t *testing.T, bus eventbus.EventBus, topic, group string, handler eventbus.Handler) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		_ = bus.Subscribe(ctx, topic, group, handler)
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+// Collect returns a handler that sends every event to the returned channel.
+func Collect() (eventbus.Handler, <-chan eventbus.Event) {
+	events := make(chan eventbus.Event, 100)
+
+	return func(_ context.Context, event eventbus.Event) error {
+		events <- event
+		return nil
+	}, events
+}
+
+func Receive(t *testing.T, events <-chan eventbus.Event) eventbus.Event {
+	t.Helper()
+
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(Timeout):
+		t.Fatal("no event received")
+		return eventbus.Event{}
+	}
+}
+
+// Publish publishes payload with payload as the event ID.
+func Publish(t *testing.T, bus eventbus.EventBus, topic, payload string) {
+	t.Helper()
+
+	if err := bus.Publish(context.Background(), topic, []byte(payload), map[string]string{eventbus.HeaderEventID: payload}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// PublishUntilReceived keeps publishing payload until it arrives on every one
+// of events, for subscribers that start reading in the background, and
+// returns the first event of each.
+func PublishUntilReceived(t *testing.T, bus eventbus.EventBus, topic, payload string, events ...<-chan eventbus.Event) []eventbus.Event {
+	t.Helper()
+
+	first := make([]eventbus.Event, len(events))
+	received := make([]bool, len(events))
+	missing := len(events)
+
+	deadline := time.After(Timeout)
+	for missing > 0 {
+		Publish(t, bus, topic, payload)
+
+		select {
+		case <-time.After(50 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("no event received")
+		}
+
+		for i, ch := range events {
+			if received[i] {
+				continue
+			}
+			select {
+			case first[i] = <-ch:
+				received[i] = true
+				missing--
+			default:
+			}
+		}
+	}
+
+	return first
+}
+
+// Run checks that the bus returned by newBus behaves as eventbus.EventBus
+// documents. newBus must redeliver failed events within a fraction of
+// Timeout and dead-letter them after maxDeliveries.
+func Run(t *testing.T, newBus func(t *testing.T, maxDeliveries int) eventbus.EventBus) {
+	t.Run("GroupReplaysEarlierEvents", func(t *testing.T) {
+		bus := newBus(t, 0)
+
+		Publish(t, bus, Topic, "BTC")
+
+		handler, events := Collect()
+		Subscribe(t, bus, Topic, Group, handler)
+
+		Publish(t, bus, Topic, "ETH")
+
+		for _, want := range []string{"BTC", "ETH"} {
+			event := Receive(t, events)
+			if string(event.Payload) != want || event.Headers[eventbus.HeaderEventID] != want || event.Topic != Topic || event.ID == "" {
+				t.Errorf("got %+v, want payload and event id %s", event, want)
+			}
+		}
+	})
+
+	t.Run("GroupSplitsEvents", func(t *testing.T) {
+		bus := newBus(t, 0)
+
+		handler, events := Collect()
+		Subscribe(t, bus, Topic, Group, handler)
+		Subscribe(t, bus, Topic, Group, handler)
+
+		Publish(t, bus, Topic, "BTC")
+		Publish(t, bus, Topic, "ETH")
+
+		Receive(t, events)
+		Receive(t, events)
+
+		select {
+		case event := <-events:
+			t.Fatalf("event %s delivered twice within a group", event.Payload)
+		case <-time.After(100 * time.Millisecond):
+		}
+	})
+
+	t.Run("BroadcastSkipsEarlierEvents", func(t *testing.T) {
+		bus := newBus(t, 0)
+
+		Publish(t, bus, Topic, "BTC")
+
+		first, firstEvents := Collect()
+		second, secondEvents := Collect()
+		Subscribe(t, bus, Topic, "", first)
+		Subscribe(t, bus, Topic, "", second)
+
+		for _, event := range PublishUntilReceived(t, bus, Topic, "ETH", firstEvents, secondEvents) {
+			if string(event.Payload) != "ETH" {
+				t.Errorf("got %s, want only events published after Subscribe", event.Payload)
+			}
+		}
+	})
+
+	t.Run("FailedEventIsRedelivered", func(t *testing.T) {
+		bus := newBus(t, 0)
+
+		var (
+			mu       sync.Mutex
+			attempts int
+		)
+		handler, events := Collect()
+		Subscribe(t, bus, Topic, Group, func(ctx context.Context, event eventbus.Event) error {
+			mu.Lock()
+			defer mu.Unlock()
+
+			if attempts++; attempts < 3 {
+				return errors.New("temporary failure")
+			}
+			return handler(ctx, event)
+		})
+
+		Publish(t, bus, Topic, "BTC")
+
+		if event := Receive(t, events); string(event.Payload) != "BTC" {
+			t.Fatalf("got %s, want BTC", event.Payload)
+		}
+	})
+
+	t.Run("DeadLetter", func(t *testing.T) {
+		bus := newBus(t, 3)
+
+		var (
+			mu       sync.Mutex
+			attempts int
+		)
+		Subscribe(t, bus, Topic, Group, func(context.Context, eventbus.Event) error {
+			mu.Lock()
+			defer mu.Unlock()
+
+			attempts++
+			return errors.New("permanent failure")
+		})
+
+		handler, dead := Collect()
+		Subscribe(t, bus, eventbus.DeadLetterTopic(Topic), "ops", handler)
+
+		Publish(t, bus, Topic, "BTC")
+
+		event := Receive(t, dead)
+		if string(event.Payload) != "BTC" || event.Headers[eventbus.HeaderEventID] != "BTC" {
+			t.Errorf("dead letter = %+v, want the original event", event)
+		}
+		if event.Headers[eventbus.HeaderDeadGroup] != Group || event.Headers[eventbus.HeaderDeadError] != "permanent failure" {
+			t.Errorf("dead letter headers = %v, want group %s and the handler error", event.Headers, Group)
+		}
+
+		// Dead-lettered events are not delivered again.
+		time.Sleep(300 * time.Millisecond)
+
+		mu.Lock()
+		defer mu.Unlock()
+		if attempts != 3 {
+			t.Errorf("handler called %d times, want 3", attempts)
+		}
+	})
+}
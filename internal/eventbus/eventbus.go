@@ -0,0 +1,72 @@
+package eventbus
+
+import (
+	"context"
+	"github.com/pkg/errors"
+)
+
+// Topics exchanged between api_service and currency_fetcher.
+const (
+	// TopicCurrencyRequested asks the fetcher to start tracking a currency.
+	TopicCurrencyRequested = "currency.requested"
+	// TopicRatesUpdated announces that fresh rates of a currency were saved.
+	TopicRatesUpdated = "rates.updated"
+	// TopicCurrencyRegistered answers a registration request with its outcome.
+	TopicCurrencyRegistered = "currency.registered"
+)
+
+// HeaderEventID identifies an event across redeliveries. Events relayed from
+// the outbox may arrive more than once; consumers deduplicate on it.
+const HeaderEventID = "Exchange-Event-Id"
+
+// Headers added to events moved to a dead-letter topic.
+const (
+	HeaderDeadGroup = "Exchange-Dead-Group"
+	HeaderDeadError = "Exchange-Dead-Error"
+)
+
+var ErrClosed = errors.New("event bus closed")
+
+// DeadLetterTopic is where a group moves the events of topic whose handler
+// kept failing, so that they stop being redelivered and can be inspected or
+// published again by hand.
+func DeadLetterTopic(topic string) string {
+	return topic + ".dead"
+}
+
+// DeadLetterHeaders returns the headers of event moved to the dead-letter
+// topic by group after err.
+func DeadLetterHeaders(event Event, group string, err error) map[string]string {
+	headers := make(map[string]string, len(event.Headers)+2)
+	for key, value := range event.Headers {
+		headers[key] = value
+	}
+	headers[HeaderDeadGroup] = group
+	headers[HeaderDeadError] = err.Error()
+
+	return headers
+}
+
+type Event struct {
+	ID      string
+	Topic   string
+	Payload []byte
+	Headers map[string]string
+}
+
+// Handler processes an event. An event is acknowledged once its handler
+// returns nil and is delivered again otherwise, up to the delivery limit of
+// the bus, after which it goes to DeadLetterTopic.
+type Handler func(ctx context.Context, event Event) error
+
+type EventBus interface {
+	Publish(ctx context.Context, topic string, payload []byte, headers map[string]string) error
+
+	// Subscribe delivers events of topic to handler until ctx is done.
+	// Subscribers sharing a group split its events between them and pick up
+	// what was published while none of them was running. An empty group
+	// receives every event published from now on, without replay.
+	Subscribe(ctx context.Context, topic, group string, handler Handler) error
+
+	Close() error
+}
@@ -0,0 +1,188 @@
+package membus
+
+import (
+	"context"
+	"github.com/langowen/exchange/internal/eventbus"
+	"github.com/pkg/errors"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const retryDelay = 100 * time.Millisecond
+
+// Bus is an in-process eventbus.EventBus for tests and single-binary setups.
+// It keeps every event in memory, so groups replay what was published before
+// they subscribed, the same way consumer groups do with Redis Streams, and
+// moves events that failed maxDeliveries times to the dead-letter topic.
+type Bus struct {
+	mu            sync.Mutex
+	closed        bool
+	notify        chan struct{}
+	nextID        int
+	topics        map[string][]eventbus.Event
+	cursors       map[string]*cursor
+	maxDeliveries int
+}
+
+// cursor is the read position of a group, shared by its subscribers, plus the
+// events whose handler failed and that must be delivered again.
+type cursor struct {
+	next  int
+	retry []delivery
+}
+
+// delivery is an event with the number of times it was delivered before.
+type delivery struct {
+	event eventbus.Event
+	count int
+}
+
+type Option func(b *Bus)
+
+// WithMaxDeliveries moves an event to eventbus.DeadLetterTopic after n failed
+// deliveries to a group, 0 redelivers it forever.
+func WithMaxDeliveries(n int) Option {
+	return func(b *Bus) {
+		b.maxDeliveries = n
+	}
+}
+
+func New(opts ...Option) *Bus {
+	b := &Bus{
+		notify:        make(chan struct{}),
+		topics:        make(map[string][]eventbus.Event),
+		cursors:       make(map[string]*cursor),
+		maxDeliveries: 10,
+	}
+
+	for _, opt := range opts {
+		opt(b)
+	}
+
+	return b
+}
+
+func (b *Bus) Publish(_ context.Context, topic string, payload []byte, headers map[string]string) error {
+	const op = "membus.Publish"
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return errors.Wrap(eventbus.ErrClosed, op)
+	}
+
+	b.nextID++
+	b.topics[topic] = append(b.topics[topic], eventbus.Event{
+		ID:      strconv.Itoa(b.nextID),
+		Topic:   topic,
+		Payload: payload,
+		Headers: headers,
+	})
+
+	close(b.notify)
+	b.notify = make(chan struct{})
+
+	return nil
+}
+
+func (b *Bus) Subscribe(ctx context.Context, topic, group string, handler eventbus.Handler) error {
+	const op = "membus.Subscribe"
+
+	b.mu.Lock()
+	var cur *cursor
+	if group == "" {
+		cur = &cursor{next: len(b.topics[topic])}
+	} else {
+		key := topic + "/" + group
+		if cur = b.cursors[key]; cur == nil {
+			cur = &cursor{}
+			b.cursors[key] = cur
+		}
+	}
+	b.mu.Unlock()
+
+	for {
+		next, ok, notify, err := b.take(topic, cur)
+		if err != nil {
+			return errors.Wrap(err, op)
+		}
+
+		if !ok {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-notify:
+			}
+			continue
+		}
+
+		event := next.event
+		if err = handler(ctx, event); err != nil {
+			next.count++
+
+			switch {
+			case group == "":
+				slog.Warn("Failed to handle event", "topic", topic, "id", event.ID, "error", err)
+			case b.maxDeliveries > 0 && next.count >= b.maxDeliveries:
+				slog.Error("Event failed too often, moved to the dead-letter topic", "topic", topic, "group", group, "id", event.ID, "deliveries", next.count, "error", err)
+				if err = b.Publish(ctx, eventbus.DeadLetterTopic(topic), event.Payload, eventbus.DeadLetterHeaders(event, group, err)); err != nil {
+					return errors.Wrap(err, op)
+				}
+				continue
+			default:
+				slog.Warn("Failed to handle event, it will be redelivered", "topic", topic, "id", event.ID, "error", err)
+				b.mu.Lock()
+				cur.retry = append(cur.retry, next)
+				b.mu.Unlock()
+			}
+
+			select {
+			case <-ctx.Done():
+			case <-time.After(retryDelay):
+			}
+		}
+
+		if ctx.Err() != nil {
+			return nil
+		}
+	}
+}
+
+func (b *Bus) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.closed {
+		b.closed = true
+		close(b.notify)
+	}
+
+	return nil
+}
+
+// take returns the next event of the cursor, or the channel closed on the
+// next publish when there is none.
+func (b *Bus) take(topic string, cur *cursor) (delivery, bool, <-chan struct{}, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return delivery{}, false, nil, eventbus.ErrClosed
+	}
+
+	if len(cur.retry) > 0 {
+		next := cur.retry[0]
+		cur.retry = cur.retry[1:]
+		return next, true, nil, nil
+	}
+
+	if events := b.topics[topic]; cur.next < len(events) {
+		cur.next++
+		return delivery{event: events[cur.next-1]}, true, nil, nil
+	}
+
+	return delivery{}, false, b.notify, nil
+}
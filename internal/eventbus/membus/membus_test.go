@@ -0,0 +1,54 @@
+package membus
+
+import (
+	"context"
+	"github.com/langowen/exchange/internal/eventbus"
+	"github.com/langowen/exchange/internal/eventbus/bustest"
+	"github.com/pkg/errors"
+	"testing"
+	"time"
+)
+
+func TestBus(t *testing.T) {
+	bustest.Run(t, func(t *testing.T, maxDeliveries int) eventbus.EventBus {
+		var opts []Option
+		if maxDeliveries > 0 {
+			opts = append(opts, WithMaxDeliveries(maxDeliveries))
+		}
+
+		bus := New(opts...)
+		t.Cleanup(func() {
+			_ = bus.Close()
+		})
+
+		return bus
+	})
+}
+
+func TestClose(t *testing.T) {
+	bus := New()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- bus.Subscribe(context.Background(), bustest.Topic, bustest.Group, func(context.Context, eventbus.Event) error {
+			return nil
+		})
+	}()
+
+	if err := bus.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, eventbus.ErrClosed) {
+			t.Errorf("Subscribe returned %v, want ErrClosed", err)
+		}
+	case <-time.After(bustest.Timeout):
+		t.Fatal("Subscribe did not return after Close")
+	}
+
+	if err := bus.Publish(context.Background(), bustest.Topic, nil, nil); !errors.Is(err, eventbus.ErrClosed) {
+		t.Errorf("Publish returned %v, want ErrClosed", err)
+	}
+}
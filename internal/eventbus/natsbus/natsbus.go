@@ -0,0 +1,266 @@
+package natsbus
+
+import (
+	"context"
+	"github.com/langowen/exchange/internal/eventbus"
+	"github.com/langowen/exchange/internal/metrics"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/pkg/errors"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// retryDelay is the first redelivery delay of a failed event, doubled on every
+// delivery up to ackWait. It also paces retries of Subscribe.
+const retryDelay = time.Second
+
+// Bus is an eventbus.EventBus on NATS JetStream. All topics live in a single
+// stream under subjectPrefix; groups map to durable consumers, so events
+// published while every consumer is down are delivered once one comes back.
+// Events that are not acknowledged within ackWait are delivered again, failed
+// ones after a growing delay; once delivered maxDeliveries times they move to
+// the dead-letter topic.
+type Bus struct {
+	conn          *nats.Conn
+	js            jetstream.JetStream
+	stream        string
+	subjectPrefix string
+	ackWait       time.Duration
+	maxDeliveries int
+}
+
+type Option func(b *Bus)
+
+func WithStream(name, subjectPrefix string) Option {
+	return func(b *Bus) {
+		b.stream = name
+		b.subjectPrefix = subjectPrefix
+	}
+}
+
+func WithAckWait(ackWait time.Duration) Option {
+	return func(b *Bus) {
+		b.ackWait = ackWait
+	}
+}
+
+// WithMaxDeliveries moves an event to eventbus.DeadLetterTopic after n failed
+// deliveries to a group, 0 redelivers it forever.
+func WithMaxDeliveries(n int) Option {
+	return func(b *Bus) {
+		b.maxDeliveries = n
+	}
+}
+
+// New creates the stream, or updates it to maxMsgs. The bus takes over conn,
+// which may as well point to an embedded server in tests, and drains it on
+// Close.
+func New(ctx context.Context, conn *nats.Conn, maxMsgs int64, opts ...Option) (*Bus, error) {
+	const op = "natsbus.New"
+
+	b := &Bus{
+		conn:          conn,
+		stream:        "EXCHANGE",
+		subjectPrefix: "exchange",
+		ackWait:       30 * time.Second,
+		maxDeliveries: 10,
+	}
+
+	for _, opt := range opts {
+		opt(b)
+	}
+
+	js, err := jetstream.New(conn)
+	if err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+	b.js = js
+
+	_, err = js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:     b.stream,
+		Subjects: []string{b.subjectPrefix + ".>"},
+		MaxMsgs:  maxMsgs,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+
+	return b, nil
+}
+
+func (b *Bus) Publish(ctx context.Context, topic string, payload []byte, headers map[string]string) error {
+	const op = "natsbus.Publish"
+
+	if _, err := b.js.PublishMsg(ctx, b.message(topic, payload, headers)); err != nil {
+		return errors.Wrap(err, op)
+	}
+
+	return nil
+}
+
+// Subscribe retries until the consumer is created, which covers a NATS server
+// that is restarting or has not elected a stream leader yet.
+func (b *Bus) Subscribe(ctx context.Context, topic, group string, handler eventbus.Handler) error {
+	for {
+		consumeCtx, err := b.consume(ctx, topic, group, handler)
+		if err == nil {
+			<-ctx.Done()
+			consumeCtx.Stop()
+			return nil
+		}
+
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		slog.Error("Event bus failed to subscribe, retrying", "topic", topic, "group", group, "error", err)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(retryDelay):
+		}
+	}
+}
+
+// consume creates the consumer of group, an ordered one for an empty group,
+// and starts delivering its events to handler.
+func (b *Bus) consume(ctx context.Context, topic, group string, handler eventbus.Handler) (jetstream.ConsumeContext, error) {
+	const op = "natsbus.consume"
+
+	var (
+		consumer jetstream.Consumer
+		err      error
+	)
+	if group == "" {
+		consumer, err = b.js.OrderedConsumer(ctx, b.stream, jetstream.OrderedConsumerConfig{
+			FilterSubjects: []string{b.subject(topic)},
+			DeliverPolicy:  jetstream.DeliverNewPolicy,
+		})
+	} else {
+		consumer, err = b.js.CreateOrUpdateConsumer(ctx, b.stream, jetstream.ConsumerConfig{
+			Durable:       durableName(group, topic),
+			FilterSubject: b.subject(topic),
+			AckPolicy:     jetstream.AckExplicitPolicy,
+			AckWait:       b.ackWait,
+			DeliverPolicy: jetstream.DeliverAllPolicy,
+		})
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+
+	consumeCtx, err := consumer.Consume(func(msg jetstream.Msg) {
+		b.handle(ctx, topic, group, msg, handler)
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+
+	return consumeCtx, nil
+}
+
+func (b *Bus) Close() error {
+	const op = "natsbus.Close"
+
+	if err := b.conn.Drain(); err != nil {
+		return errors.Wrap(err, op)
+	}
+
+	return nil
+}
+
+func (b *Bus) handle(ctx context.Context, topic, group string, msg jetstream.Msg, handler eventbus.Handler) {
+	event := eventbus.Event{
+		Topic:   topic,
+		Payload: msg.Data(),
+		Headers: make(map[string]string, len(msg.Headers())),
+	}
+
+	var deliveries uint64 = 1
+	if meta, err := msg.Metadata(); err == nil {
+		event.ID = strconv.FormatUint(meta.Sequence.Stream, 10)
+		deliveries = meta.NumDelivered
+	}
+
+	for key := range msg.Headers() {
+		event.Headers[key] = msg.Headers().Get(key)
+	}
+
+	if err := handler(ctx, event); err != nil {
+		if group == "" {
+			slog.Warn("Failed to handle event", "topic", topic, "id", event.ID, "error", err)
+			return
+		}
+
+		if b.maxDeliveries > 0 && deliveries >= uint64(b.maxDeliveries) {
+			b.deadLetter(ctx, topic, group, msg, event, deliveries, err)
+			return
+		}
+
+		slog.Warn("Failed to handle event, it will be redelivered", "topic", topic, "id", event.ID, "error", err)
+		if err = msg.NakWithDelay(b.redeliveryDelay(deliveries)); err != nil {
+			slog.Error("Failed to reject event", "topic", topic, "id", event.ID, "error", err)
+		}
+		return
+	}
+
+	if group == "" {
+		return
+	}
+
+	if err := msg.Ack(); err != nil {
+		slog.Error("Failed to acknowledge event", "topic", topic, "id", event.ID, "error", err)
+	}
+}
+
+// deadLetter publishes event to the dead-letter topic and terminates msg, so
+// that JetStream stops redelivering it. When the publish fails the event is
+// rejected as usual and dead-lettered on its next failure.
+func (b *Bus) deadLetter(ctx context.Context, topic, group string, msg jetstream.Msg, event eventbus.Event, deliveries uint64, cause error) {
+	if err := b.Publish(ctx, eventbus.DeadLetterTopic(topic), event.Payload, eventbus.DeadLetterHeaders(event, group, cause)); err != nil {
+		slog.Error("Failed to dead-letter event", "topic", topic, "id", event.ID, "error", err)
+		if err = msg.NakWithDelay(b.redeliveryDelay(deliveries)); err != nil {
+			slog.Error("Failed to reject event", "topic", topic, "id", event.ID, "error", err)
+		}
+		return
+	}
+
+	if err := msg.Term(); err != nil {
+		slog.Error("Failed to terminate event", "topic", topic, "id", event.ID, "error", err)
+	}
+
+	metrics.EventsDeadLettered.WithLabelValues(topic, group).Inc()
+	slog.Error("Event failed too often, moved to the dead-letter topic", "topic", topic, "group", group, "id", event.ID, "deliveries", deliveries, "error", cause)
+}
+
+// redeliveryDelay backs off exponentially from retryDelay, so that a failing
+// event does not spin, but never waits longer than ackWait.
+func (b *Bus) redeliveryDelay(deliveries uint64) time.Duration {
+	delay := retryDelay << min(deliveries-1, 10)
+
+	return min(delay, b.ackWait)
+}
+
+func (b *Bus) message(topic string, payload []byte, headers map[string]string) *nats.Msg {
+	msg := nats.NewMsg(b.subject(topic))
+	msg.Data = payload
+
+	for key, value := range headers {
+		msg.Header.Set(key, value)
+	}
+
+	return msg
+}
+
+func (b *Bus) subject(topic string) string {
+	return b.subjectPrefix + "." + topic
+}
+
+// durableName builds a consumer name, which may not contain dots.
+func durableName(group, topic string) string {
+	return strings.NewReplacer(".", "_", "*", "_", ">", "_").Replace(group + "_" + topic)
+}
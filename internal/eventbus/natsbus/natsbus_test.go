@@ -0,0 +1,134 @@
+package natsbus
+
+import (
+	"context"
+	"github.com/langowen/exchange/internal/eventbus"
+	"github.com/langowen/exchange/internal/eventbus/bustest"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"testing"
+	"time"
+)
+
+// runServer starts an embedded NATS server with JetStream.
+func runServer(t *testing.T) *server.Server {
+	t.Helper()
+
+	srv, err := server.NewServer(&server.Options{
+		Host:      "127.0.0.1",
+		Port:      -1,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+		NoLog:     true,
+		NoSigs:    true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go srv.Start()
+	t.Cleanup(srv.Shutdown)
+
+	if !srv.ReadyForConnections(bustest.Timeout) {
+		t.Fatal("NATS server did not start")
+	}
+
+	return srv
+}
+
+func connect(t *testing.T, srv *server.Server) *nats.Conn {
+	t.Helper()
+
+	conn, err := nats.Connect(srv.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return conn
+}
+
+func newBus(t *testing.T, opts ...Option) *Bus {
+	t.Helper()
+
+	bus, err := New(context.Background(), connect(t, runServer(t)), 1000, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = bus.Close()
+	})
+
+	return bus
+}
+
+func TestBus(t *testing.T) {
+	bustest.Run(t, func(t *testing.T, maxDeliveries int) eventbus.EventBus {
+		opts := []Option{WithAckWait(100 * time.Millisecond)}
+		if maxDeliveries > 0 {
+			opts = append(opts, WithMaxDeliveries(maxDeliveries))
+		}
+
+		return newBus(t, opts...)
+	})
+}
+
+func TestSubscribeRetries(t *testing.T) {
+	srv := runServer(t)
+	conn := connect(t, srv)
+	t.Cleanup(conn.Close)
+
+	js, err := jetstream.New(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The stream is missing, so creating the consumer fails until New makes it.
+	bus := &Bus{conn: conn, js: js, stream: "EXCHANGE", subjectPrefix: "exchange", ackWait: time.Second}
+
+	handler, events := bustest.Collect()
+	bustest.Subscribe(t, bus, bustest.Topic, bustest.Group, handler)
+
+	time.Sleep(100 * time.Millisecond)
+
+	other, err := New(context.Background(), connect(t, srv), 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = other.Close()
+	})
+
+	bustest.Publish(t, other, bustest.Topic, "BTC")
+
+	if event := bustest.Receive(t, events); string(event.Payload) != "BTC" {
+		t.Fatalf("got %s, want BTC", event.Payload)
+	}
+}
+
+func TestRedeliveryDelay(t *testing.T) {
+	bus := &Bus{ackWait: 30 * time.Second}
+
+	tests := []struct {
+		deliveries uint64
+		want       time.Duration
+	}{
+		{deliveries: 1, want: time.Second},
+		{deliveries: 2, want: 2 * time.Second},
+		{deliveries: 4, want: 8 * time.Second},
+		{deliveries: 6, want: 30 * time.Second},
+		{deliveries: 1000, want: 30 * time.Second},
+	}
+
+	for _, tt := range tests {
+		if got := bus.redeliveryDelay(tt.deliveries); got != tt.want {
+			t.Errorf("redeliveryDelay(%d) = %v, want %v", tt.deliveries, got, tt.want)
+		}
+	}
+}
+
+func TestDurableName(t *testing.T) {
+	if got := durableName("api.service", "rates.*.>"); got != "api_service_rates____" {
+		t.Errorf("durableName = %q", got)
+	}
+}
@@ -0,0 +1,347 @@
+package redisbus
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/langowen/exchange/internal/eventbus"
+	"github.com/langowen/exchange/internal/metrics"
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+const (
+	streamPrefix = "events:"
+	readCount    = 10
+	readBlock    = 5 * time.Second
+	retryDelay   = time.Second
+)
+
+// Bus is an eventbus.EventBus on Redis Streams. Groups map to consumer groups,
+// so events published while every consumer is down are kept in the stream and
+// read once one comes back. Events left unacknowledged by a consumer, because
+// its handler failed or it died, are claimed again after ClaimIdle; once
+// delivered maxDeliveries times they move to the dead-letter stream. Needs
+// Redis 6.2 or later for XAUTOCLAIM.
+type Bus struct {
+	client        redis.UniversalClient
+	consumer      string
+	maxLen        int64
+	claimIdle     time.Duration
+	maxDeliveries int64
+}
+
+type Option func(b *Bus)
+
+// WithMaxLen caps every stream at roughly n events.
+func WithMaxLen(n int64) Option {
+	return func(b *Bus) {
+		b.maxLen = n
+	}
+}
+
+func WithClaimIdle(idle time.Duration) Option {
+	return func(b *Bus) {
+		b.claimIdle = idle
+	}
+}
+
+// WithMaxDeliveries moves an event to eventbus.DeadLetterTopic after n failed
+// deliveries to a group, 0 redelivers it forever.
+func WithMaxDeliveries(n int) Option {
+	return func(b *Bus) {
+		b.maxDeliveries = int64(n)
+	}
+}
+
+// New creates a bus. consumer names this process within consumer groups and
+// should be stable across restarts, so that its pending events are replayed.
+func New(client redis.UniversalClient, consumer string, opts ...Option) *Bus {
+	b := &Bus{
+		client:        client,
+		consumer:      consumer,
+		maxLen:        10000,
+		claimIdle:     30 * time.Second,
+		maxDeliveries: 10,
+	}
+
+	for _, opt := range opts {
+		opt(b)
+	}
+
+	return b
+}
+
+func (b *Bus) Publish(ctx context.Context, topic string, payload []byte, headers map[string]string) error {
+	const op = "redisbus.Publish"
+
+	encodedHeaders, err := json.Marshal(headers)
+	if err != nil {
+		return errors.Wrap(err, op)
+	}
+
+	err = b.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: streamPrefix + topic,
+		MaxLen: b.maxLen,
+		Approx: true,
+		Values: map[string]any{
+			"payload": payload,
+			"headers": encodedHeaders,
+		},
+	}).Err()
+	if err != nil {
+		return errors.Wrap(err, op)
+	}
+
+	return nil
+}
+
+func (b *Bus) Subscribe(ctx context.Context, topic, group string, handler eventbus.Handler) error {
+	if group == "" {
+		b.broadcast(ctx, topic, handler)
+	} else {
+		b.consume(ctx, topic, group, handler)
+	}
+
+	return nil
+}
+
+// Close is a no-op: the Redis client is owned by the caller.
+func (b *Bus) Close() error {
+	return nil
+}
+
+// consume reads the group with XREADGROUP. The pending events of this consumer
+// are replayed first, then new ones are read, and events abandoned by other
+// consumers are claimed every claimIdle.
+func (b *Bus) consume(ctx context.Context, topic, group string, handler eventbus.Handler) {
+	stream := streamPrefix + topic
+
+	for !b.wait(ctx, b.createGroup(ctx, stream, group), "create consumer group", topic) {
+		if ctx.Err() != nil {
+			return
+		}
+	}
+
+	// "0" returns the events delivered to this consumer but never acknowledged.
+	cursor := "0"
+	lastClaim := time.Now()
+
+	for ctx.Err() == nil {
+		if time.Since(lastClaim) >= b.claimIdle {
+			lastClaim = time.Now()
+			b.claim(ctx, topic, group, handler)
+		}
+
+		streams, err := b.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    group,
+			Consumer: b.consumer,
+			Streams:  []string{stream, cursor},
+			Count:    readCount,
+			// Wake up in time for the next claim.
+			Block: min(readBlock, b.claimIdle),
+		}).Result()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if !b.wait(ctx, err, "read events", topic) {
+			continue
+		}
+
+		if len(streams) == 0 {
+			cursor = ">"
+		}
+
+		for _, s := range streams {
+			b.handle(ctx, topic, group, s.Messages, handler)
+
+			if cursor != ">" {
+				// Replay continues after the last pending event, including those
+				// that failed again, until it catches up with new events.
+				cursor = ">"
+				if len(s.Messages) > 0 {
+					cursor = s.Messages[len(s.Messages)-1].ID
+				}
+			}
+		}
+	}
+}
+
+// claim takes over the events of group left idle for claimIdle, batch by
+// batch until XAUTOCLAIM has scanned the whole pending list.
+func (b *Bus) claim(ctx context.Context, topic, group string, handler eventbus.Handler) {
+	start := "0-0"
+
+	for ctx.Err() == nil {
+		messages, next, err := b.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   streamPrefix + topic,
+			Group:    group,
+			Consumer: b.consumer,
+			MinIdle:  b.claimIdle,
+			Start:    start,
+			Count:    readCount,
+		}).Result()
+		if !b.wait(ctx, err, "claim events", topic) {
+			return
+		}
+
+		b.handle(ctx, topic, group, messages, handler)
+
+		// The cursor is back at 0-0 once the end of the list is reached.
+		if next == "" || next == "0-0" {
+			return
+		}
+		start = next
+	}
+}
+
+// broadcast reads the stream with plain XREAD from its current end.
+func (b *Bus) broadcast(ctx context.Context, topic string, handler eventbus.Handler) {
+	stream := streamPrefix + topic
+
+	// Without the last ID, because the stream does not exist yet or Redis
+	// failed, "$" still skips the history. It only counts from each XREAD
+	// though, so the last ID is used as soon as an event arrives.
+	cursor := "$"
+	info, err := b.client.XInfoStream(ctx, stream).Result()
+	if err == nil {
+		cursor = info.LastGeneratedID
+	}
+
+	for ctx.Err() == nil {
+		streams, err := b.client.XRead(ctx, &redis.XReadArgs{
+			Streams: []string{stream, cursor},
+			Count:   readCount,
+			Block:   readBlock,
+		}).Result()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if !b.wait(ctx, err, "read events", topic) {
+			continue
+		}
+
+		for _, s := range streams {
+			for _, msg := range s.Messages {
+				cursor = msg.ID
+
+				if err = handler(ctx, toEvent(topic, msg)); err != nil {
+					slog.Warn("Failed to handle event", "topic", topic, "id", msg.ID, "error", err)
+				}
+			}
+		}
+	}
+}
+
+func (b *Bus) handle(ctx context.Context, topic, group string, messages []redis.XMessage, handler eventbus.Handler) {
+	stream := streamPrefix + topic
+
+	for _, msg := range messages {
+		if err := handler(ctx, toEvent(topic, msg)); err != nil {
+			if !b.deadLetter(ctx, topic, group, msg, err) {
+				slog.Warn("Failed to handle event, it will be redelivered", "topic", topic, "id", msg.ID, "error", err)
+			}
+			continue
+		}
+
+		if err := b.client.XAck(ctx, stream, group, msg.ID).Err(); err != nil {
+			slog.Error("Failed to acknowledge event", "topic", topic, "id", msg.ID, "error", err)
+		}
+	}
+}
+
+// deadLetter moves msg to the dead-letter stream once it was delivered
+// maxDeliveries times and reports whether it did. The delivery count is the
+// one XPENDING keeps for the group.
+func (b *Bus) deadLetter(ctx context.Context, topic, group string, msg redis.XMessage, cause error) bool {
+	if b.maxDeliveries <= 0 {
+		return false
+	}
+
+	stream := streamPrefix + topic
+
+	pending, err := b.client.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: stream,
+		Group:  group,
+		Start:  msg.ID,
+		End:    msg.ID,
+		Count:  1,
+	}).Result()
+	if err != nil {
+		slog.Error("Failed to read event delivery count", "topic", topic, "id", msg.ID, "error", err)
+		return false
+	}
+	if len(pending) == 0 || pending[0].RetryCount < b.maxDeliveries {
+		return false
+	}
+
+	event := toEvent(topic, msg)
+	if err = b.Publish(ctx, eventbus.DeadLetterTopic(topic), event.Payload, eventbus.DeadLetterHeaders(event, group, cause)); err != nil {
+		slog.Error("Failed to dead-letter event", "topic", topic, "id", msg.ID, "error", err)
+		return false
+	}
+
+	// A crash before the acknowledgement dead-letters the event twice, which
+	// beats losing it.
+	if err = b.client.XAck(ctx, stream, group, msg.ID).Err(); err != nil {
+		slog.Error("Failed to acknowledge event", "topic", topic, "id", msg.ID, "error", err)
+	}
+
+	metrics.EventsDeadLettered.WithLabelValues(topic, group).Inc()
+	slog.Error("Event failed too often, moved to the dead-letter stream", "topic", topic, "group", group, "id", msg.ID, "deliveries", pending[0].RetryCount, "error", cause)
+
+	return true
+}
+
+func (b *Bus) createGroup(ctx context.Context, stream, group string) error {
+	// Start from the beginning so that events published before the group
+	// existed are not lost on the first deployment.
+	err := b.client.XGroupCreateMkStream(ctx, stream, group, "0").Err()
+	if err != nil && strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return nil
+	}
+
+	return err
+}
+
+// wait reports whether err is nil. Otherwise it logs err and pauses before
+// the caller retries, which covers Redis restarts and failovers.
+func (b *Bus) wait(ctx context.Context, err error, action, topic string) bool {
+	if err == nil {
+		return true
+	}
+
+	if ctx.Err() != nil {
+		return false
+	}
+
+	slog.Error("Event bus failed to "+action+", retrying", "topic", topic, "error", err)
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(retryDelay):
+	}
+
+	return false
+}
+
+func toEvent(topic string, msg redis.XMessage) eventbus.Event {
+	event := eventbus.Event{
+		ID:    msg.ID,
+		Topic: topic,
+	}
+
+	if payload, ok := msg.Values["payload"].(string); ok {
+		event.Payload = []byte(payload)
+	}
+
+	if headers, ok := msg.Values["headers"].(string); ok {
+		if err := json.Unmarshal([]byte(headers), &event.Headers); err != nil {
+			slog.Warn("Failed to decode event headers", "topic", topic, "id", msg.ID, "error", err)
+		}
+	}
+
+	return event
+}
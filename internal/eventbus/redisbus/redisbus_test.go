@@ -0,0 +1,135 @@
+package redisbus
+
+import (
+	"context"
+	"fmt"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/langowen/exchange/internal/eventbus"
+	"github.com/langowen/exchange/internal/eventbus/bustest"
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+	"testing"
+	"time"
+)
+
+func newBus(t *testing.T, opts ...Option) (*Bus, *redis.Client) {
+	t.Helper()
+
+	// Cancelling Subscribe must interrupt blocking reads.
+	client := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr(), ContextTimeoutEnabled: true})
+	t.Cleanup(func() {
+		_ = client.Close()
+	})
+
+	return New(client, "test", opts...), client
+}
+
+func TestBus(t *testing.T) {
+	bustest.Run(t, func(t *testing.T, maxDeliveries int) eventbus.EventBus {
+		opts := []Option{WithClaimIdle(20 * time.Millisecond)}
+		if maxDeliveries > 0 {
+			opts = append(opts, WithMaxDeliveries(maxDeliveries))
+		}
+
+		bus, _ := newBus(t, opts...)
+
+		return bus
+	})
+}
+
+func TestBroadcastSkipsEarlierEventsAfterError(t *testing.T) {
+	srv := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: srv.Addr(), ContextTimeoutEnabled: true})
+	t.Cleanup(func() {
+		_ = client.Close()
+	})
+	bus := New(client, "test")
+
+	bustest.Publish(t, bus, bustest.Topic, "BTC")
+
+	// Subscribe cannot look up the end of the stream.
+	srv.SetError("ERR unavailable")
+
+	handler, events := bustest.Collect()
+	bustest.Subscribe(t, bus, bustest.Topic, "", handler)
+
+	time.Sleep(50 * time.Millisecond)
+	srv.SetError("")
+
+	if event := bustest.PublishUntilReceived(t, bus, bustest.Topic, "ETH", events)[0]; string(event.Payload) != "ETH" {
+		t.Fatalf("got %s, want only events published after Subscribe", event.Payload)
+	}
+}
+
+func TestDeadLetterIsAcknowledged(t *testing.T) {
+	bus, client := newBus(t, WithClaimIdle(20*time.Millisecond), WithMaxDeliveries(3))
+
+	bustest.Subscribe(t, bus, bustest.Topic, bustest.Group, func(context.Context, eventbus.Event) error {
+		return errors.New("permanent failure")
+	})
+
+	handler, dead := bustest.Collect()
+	bustest.Subscribe(t, bus, eventbus.DeadLetterTopic(bustest.Topic), "ops", handler)
+
+	bustest.Publish(t, bus, bustest.Topic, "BTC")
+	bustest.Receive(t, dead)
+
+	waitPending(t, client, 0)
+}
+
+func TestClaimPagesThroughPendingList(t *testing.T) {
+	bus, client := newBus(t, WithClaimIdle(time.Millisecond))
+	ctx := context.Background()
+
+	if err := bus.createGroup(ctx, streamPrefix+bustest.Topic, bustest.Group); err != nil {
+		t.Fatal(err)
+	}
+
+	// Events read by a consumer that died before acknowledging them, more than
+	// one XAUTOCLAIM batch.
+	const abandoned = 3*readCount + 1
+	for i := range abandoned {
+		bustest.Publish(t, bus, bustest.Topic, fmt.Sprint(i))
+	}
+	err := client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    bustest.Group,
+		Consumer: "dead",
+		Streams:  []string{streamPrefix + bustest.Topic, ">"},
+		Count:    abandoned,
+	}).Err()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+
+	handler, events := bustest.Collect()
+	bus.claim(ctx, bustest.Topic, bustest.Group, handler)
+
+	if len(events) != abandoned {
+		t.Fatalf("claimed %d events in one pass, want %d", len(events), abandoned)
+	}
+
+	waitPending(t, client, 0)
+}
+
+// waitPending waits until the group has n unacknowledged events.
+func waitPending(t *testing.T, client *redis.Client, n int64) {
+	t.Helper()
+
+	deadline := time.Now().Add(bustest.Timeout)
+	for {
+		pending, err := client.XPending(context.Background(), streamPrefix+bustest.Topic, bustest.Group).Result()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pending.Count == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d events pending, want %d", pending.Count, n)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
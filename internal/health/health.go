@@ -0,0 +1,106 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const checkTimeout = 2 * time.Second
+
+type Check func(ctx context.Context) error
+
+// Checker serves liveness and readiness probes. Liveness only says the
+// process is able to answer; readiness runs every registered dependency check.
+type Checker struct {
+	mu     sync.RWMutex
+	checks map[string]Check
+}
+
+type response struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+func NewChecker() *Checker {
+	return &Checker{
+		checks: make(map[string]Check),
+	}
+}
+
+func (c *Checker) Add(name string, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.checks[name] = check
+}
+
+func (c *Checker) Liveness(w http.ResponseWriter, _ *http.Request) {
+	respond(w, http.StatusOK, response{Status: "ok"})
+}
+
+func (c *Checker) Readiness(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), checkTimeout)
+	defer cancel()
+
+	results := c.run(ctx)
+
+	resp := response{Status: "ok", Checks: make(map[string]string, len(results))}
+	code := http.StatusOK
+
+	for name, err := range results {
+		if err != nil {
+			resp.Checks[name] = err.Error()
+			resp.Status = "unavailable"
+			code = http.StatusServiceUnavailable
+			continue
+		}
+		resp.Checks[name] = "ok"
+	}
+
+	if code != http.StatusOK {
+		slog.Warn("Readiness check failed", "checks", resp.Checks)
+	}
+
+	respond(w, code, resp)
+}
+
+func (c *Checker) run(ctx context.Context) map[string]error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		results = make(map[string]error, len(c.checks))
+	)
+
+	for name, check := range c.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			err := check(ctx)
+
+			mu.Lock()
+			results[name] = err
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	return results
+}
+
+func respond(w http.ResponseWriter, code int, resp response) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		slog.Error("Failed to encode health response", "error", err.Error())
+	}
+}
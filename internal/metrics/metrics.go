@@ -0,0 +1,129 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"time"
+)
+
+const namespace = "exchange"
+
+var ProviderQuotaRemaining = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: namespace,
+	Subsystem: "fetcher",
+	Name:      "provider_quota_remaining",
+	Help:      "Requests left in the provider budget for the current window.",
+}, []string{"provider", "window"})
+
+var ProviderBreakerState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: namespace,
+	Subsystem: "fetcher",
+	Name:      "provider_breaker_state",
+	Help:      "Circuit breaker state per provider: 0 closed, 1 open, 2 half-open.",
+}, []string{"provider"})
+
+var ProviderRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Subsystem: "fetcher",
+	Name:      "provider_retries_total",
+	Help:      "Retried provider requests.",
+}, []string{"provider"})
+
+var FetchDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: namespace,
+	Subsystem: "fetcher",
+	Name:      "fetch_duration_seconds",
+	Help:      "Provider request latency, retries included.",
+	Buckets:   prometheus.DefBuckets,
+}, []string{"provider"})
+
+var FetchErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Subsystem: "fetcher",
+	Name:      "fetch_errors_total",
+	Help:      "Failed provider requests.",
+}, []string{"provider"})
+
+var RowsSaved = promauto.NewHistogram(prometheus.HistogramOpts{
+	Namespace: namespace,
+	Subsystem: "fetcher",
+	Name:      "rows_saved",
+	Help:      "Exchange rate rows saved per fetch tick.",
+	Buckets:   prometheus.ExponentialBuckets(1, 2, 12),
+})
+
+var LastSuccess = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: namespace,
+	Subsystem: "fetcher",
+	Name:      "last_success_timestamp_seconds",
+	Help:      "Unix time of the last saved rate per currency pair.",
+}, []string{"crypto", "fiat"})
+
+var OutboxPublished = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Subsystem: "fetcher",
+	Name:      "outbox_published_total",
+	Help:      "Outbox events relayed to the event bus.",
+}, []string{"topic"})
+
+var OutboxErrors = promauto.NewCounter(prometheus.CounterOpts{
+	Namespace: namespace,
+	Subsystem: "fetcher",
+	Name:      "outbox_errors_total",
+	Help:      "Failed outbox relay attempts.",
+})
+
+var WebhookDeliveries = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Subsystem: "fetcher",
+	Name:      "webhook_deliveries_total",
+	Help:      "Webhook delivery attempts by result: ok, retry or dead.",
+}, []string{"result"})
+
+var AlertFirings = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Subsystem: "fetcher",
+	Name:      "alert_firings_total",
+	Help:      "Alert rules fired per operator and channel.",
+}, []string{"operator", "channel"})
+
+var HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: namespace,
+	Subsystem: "api",
+	Name:      "http_request_duration_seconds",
+	Help:      "HTTP request latency per route and status.",
+	Buckets:   prometheus.DefBuckets,
+}, []string{"method", "route", "status"})
+
+var RegistrationDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: namespace,
+	Subsystem: "api",
+	Name:      "registration_duration_seconds",
+	Help:      "Round trip of a new currency request through the event bus.",
+	Buckets:   prometheus.DefBuckets,
+}, []string{"result"})
+
+var DBQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: namespace,
+	Subsystem: "storage",
+	Name:      "query_duration_seconds",
+	Help:      "Postgres latency per storage method.",
+	Buckets:   prometheus.DefBuckets,
+}, []string{"method"})
+
+// ObserveDBQuery starts a timer for a storage method; call the returned
+// function when the method is done, usually with defer.
+func ObserveDBQuery(method string) func() {
+	start := time.Now()
+
+	return func() {
+		DBQueryDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+	}
+}
+
+var EventsDeadLettered = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Subsystem: "events",
+	Name:      "dead_lettered_total",
+	Help:      "Events moved to the dead-letter topic after too many failed deliveries.",
+}, []string{"topic", "group"})
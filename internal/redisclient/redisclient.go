@@ -0,0 +1,46 @@
+package redisclient
+
+import (
+	"github.com/langowen/exchange/deploy/config"
+	"github.com/langowen/exchange/internal/tlsconfig"
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+)
+
+// New builds a single node, Sentinel failover or cluster client depending on
+// the configured mode. All of them reconnect on their own after a failover.
+func New(cfg config.Redis) (redis.UniversalClient, error) {
+	const op = "redisclient.New"
+
+	tlsConfig, err := tlsconfig.Client(cfg.TLS)
+	if err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+
+	switch cfg.Mode {
+	case "", "single":
+		return redis.NewClient(&redis.Options{
+			Addr:      cfg.Host,
+			Password:  cfg.Password.Value(),
+			DB:        cfg.Database(),
+			TLSConfig: tlsConfig,
+		}), nil
+	case "sentinel":
+		return redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:       cfg.MasterName,
+			SentinelAddrs:    cfg.Addrs,
+			SentinelPassword: cfg.SentinelPassword.Value(),
+			Password:         cfg.Password.Value(),
+			DB:               cfg.Database(),
+			TLSConfig:        tlsConfig,
+		}), nil
+	case "cluster":
+		return redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:     cfg.Addrs,
+			Password:  cfg.Password.Value(),
+			TLSConfig: tlsConfig,
+		}), nil
+	default:
+		return nil, errors.Errorf("%s: unknown mode %q", op, cfg.Mode)
+	}
+}
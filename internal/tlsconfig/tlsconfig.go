@@ -0,0 +1,98 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"github.com/langowen/exchange/deploy/config"
+	"github.com/pkg/errors"
+	"os"
+)
+
+// Client builds the TLS config of a client connection. It returns nil when
+// TLS is disabled. Without a configured server name it is taken from the
+// address of each connection, which is what cluster and sentinel setups need.
+func Client(cfg config.ClientTLS) (*tls.Config, error) {
+	const op = "tlsconfig.Client"
+
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	tlsCfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: cfg.ServerName,
+	}
+
+	if cfg.CAFile != "" {
+		pool, err := loadPool(cfg.CAFile)
+		if err != nil {
+			return nil, errors.Wrap(err, op)
+		}
+		tlsCfg.RootCAs = pool
+	}
+
+	if cfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, op)
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsCfg, nil
+}
+
+// Server builds the TLS config of an HTTPS server. It returns nil when no
+// certificate is configured.
+func Server(cfg config.ServerTLS) (*tls.Config, error) {
+	const op = "tlsconfig.Server"
+
+	if cfg.CertFile == "" {
+		return nil, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+
+	tlsCfg := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}
+
+	switch cfg.ClientAuth {
+	case "", "none":
+		return tlsCfg, nil
+	case "optional":
+		tlsCfg.ClientAuth = tls.VerifyClientCertIfGiven
+	case "require":
+		tlsCfg.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, errors.Errorf("%s: unknown client auth %q", op, cfg.ClientAuth)
+	}
+
+	pool, err := loadPool(cfg.ClientCAFile)
+	if err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+	tlsCfg.ClientCAs = pool
+
+	return tlsCfg, nil
+}
+
+func loadPool(path string) (*x509.CertPool, error) {
+	const op = "tlsconfig.loadPool"
+
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, errors.Errorf("%s: no certificates found in %s", op, path)
+	}
+
+	return pool, nil
+}
@@ -0,0 +1,313 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/langowen/exchange/deploy/config"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// pki holds the files of a throwaway CA with a server and a client
+// certificate signed by it.
+type pki struct {
+	caFile     string
+	serverCert string
+	serverKey  string
+	clientCert string
+	clientKey  string
+}
+
+func newPKI(t *testing.T) pki {
+	t.Helper()
+
+	dir := t.TempDir()
+
+	caKey := newKey(t)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "exchange test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issue := func(name string, serial int64, usage x509.ExtKeyUsage) (string, string) {
+		key := newKey(t)
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: name},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+			DNSNames:     []string{"localhost"},
+			IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		keyDER, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return writePEM(t, dir, name+".crt", "CERTIFICATE", der), writePEM(t, dir, name+".key", "EC PRIVATE KEY", keyDER)
+	}
+
+	p := pki{caFile: writePEM(t, dir, "ca.crt", "CERTIFICATE", caDER)}
+	p.serverCert, p.serverKey = issue("server", 2, x509.ExtKeyUsageServerAuth)
+	p.clientCert, p.clientKey = issue("client", 3, x509.ExtKeyUsageClientAuth)
+
+	return p
+}
+
+func newKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key
+}
+
+func writePEM(t *testing.T, dir, name, blockType string, der []byte) string {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+// serve starts an HTTPS server with the config built by Server.
+func serve(t *testing.T, cfg config.ServerTLS) *httptest.Server {
+	t.Helper()
+
+	tlsCfg, err := Server(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.TLS = tlsCfg
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func get(t *testing.T, url string, cfg config.ClientTLS) error {
+	t.Helper()
+
+	tlsCfg, err := Client(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsCfg}}
+	defer client.CloseIdleConnections()
+
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+
+	return resp.Body.Close()
+}
+
+func TestServer(t *testing.T) {
+	p := newPKI(t)
+
+	anonymous := config.ClientTLS{Enabled: true, CAFile: p.caFile}
+	withCert := config.ClientTLS{Enabled: true, CAFile: p.caFile, CertFile: p.clientCert, KeyFile: p.clientKey}
+
+	tests := []struct {
+		name          string
+		clientAuth    string
+		want          tls.ClientAuthType
+		anonymousOK   bool
+		certificateOK bool
+	}{
+		{name: "none", clientAuth: "none", want: tls.NoClientCert, anonymousOK: true, certificateOK: true},
+		{name: "empty means none", clientAuth: "", want: tls.NoClientCert, anonymousOK: true, certificateOK: true},
+		{name: "optional", clientAuth: "optional", want: tls.VerifyClientCertIfGiven, anonymousOK: true, certificateOK: true},
+		{name: "require", clientAuth: "require", want: tls.RequireAndVerifyClientCert, anonymousOK: false, certificateOK: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.ServerTLS{CertFile: p.serverCert, KeyFile: p.serverKey, ClientCAFile: p.caFile, ClientAuth: tt.clientAuth}
+
+			tlsCfg, err := Server(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tlsCfg.ClientAuth != tt.want {
+				t.Errorf("ClientAuth = %v, want %v", tlsCfg.ClientAuth, tt.want)
+			}
+			if tlsCfg.MinVersion != tls.VersionTLS12 {
+				t.Errorf("MinVersion = %x, want TLS 1.2", tlsCfg.MinVersion)
+			}
+
+			srv := serve(t, cfg)
+
+			if err := get(t, srv.URL, anonymous); (err == nil) != tt.anonymousOK {
+				t.Errorf("request without a client certificate: err = %v, want success %v", err, tt.anonymousOK)
+			}
+			if err := get(t, srv.URL, withCert); (err == nil) != tt.certificateOK {
+				t.Errorf("request with a client certificate: err = %v, want success %v", err, tt.certificateOK)
+			}
+		})
+	}
+}
+
+func TestServerRejectsUntrustedClientCertificate(t *testing.T) {
+	p := newPKI(t)
+	other := newPKI(t)
+
+	srv := serve(t, config.ServerTLS{CertFile: p.serverCert, KeyFile: p.serverKey, ClientCAFile: p.caFile, ClientAuth: "optional"})
+
+	err := get(t, srv.URL, config.ClientTLS{Enabled: true, CAFile: p.caFile, CertFile: other.clientCert, KeyFile: other.clientKey})
+	if err == nil {
+		t.Fatal("a client certificate from another CA was accepted")
+	}
+}
+
+func TestServerErrors(t *testing.T) {
+	p := newPKI(t)
+
+	tests := []struct {
+		name string
+		cfg  config.ServerTLS
+	}{
+		{name: "unknown client auth", cfg: config.ServerTLS{CertFile: p.serverCert, KeyFile: p.serverKey, ClientCAFile: p.caFile, ClientAuth: "sometimes"}},
+		{name: "missing key", cfg: config.ServerTLS{CertFile: p.serverCert, KeyFile: filepath.Join(t.TempDir(), "missing.key")}},
+		{name: "key of another certificate", cfg: config.ServerTLS{CertFile: p.serverCert, KeyFile: p.clientKey}},
+		{name: "missing client CA", cfg: config.ServerTLS{CertFile: p.serverCert, KeyFile: p.serverKey, ClientAuth: "require"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Server(tt.cfg); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestServerWithoutCertificate(t *testing.T) {
+	tlsCfg, err := Server(config.ServerTLS{ClientAuth: "require"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tlsCfg != nil {
+		t.Fatalf("got %+v, want nil without a certificate", tlsCfg)
+	}
+}
+
+func TestClient(t *testing.T) {
+	p := newPKI(t)
+
+	t.Run("disabled", func(t *testing.T) {
+		tlsCfg, err := Client(config.ClientTLS{CAFile: p.caFile})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tlsCfg != nil {
+			t.Fatalf("got %+v, want nil when TLS is disabled", tlsCfg)
+		}
+	})
+
+	t.Run("server name and client certificate", func(t *testing.T) {
+		tlsCfg, err := Client(config.ClientTLS{Enabled: true, CAFile: p.caFile, CertFile: p.clientCert, KeyFile: p.clientKey, ServerName: "localhost"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tlsCfg.ServerName != "localhost" {
+			t.Errorf("ServerName = %q, want localhost", tlsCfg.ServerName)
+		}
+		if len(tlsCfg.Certificates) != 1 {
+			t.Errorf("got %d client certificates, want 1", len(tlsCfg.Certificates))
+		}
+		if tlsCfg.RootCAs == nil {
+			t.Error("RootCAs is not set")
+		}
+	})
+
+	t.Run("verifies the server against the CA", func(t *testing.T) {
+		srv := serve(t, config.ServerTLS{CertFile: p.serverCert, KeyFile: p.serverKey})
+
+		if err := get(t, srv.URL, config.ClientTLS{Enabled: true, CAFile: p.caFile}); err != nil {
+			t.Errorf("request trusting the CA failed: %v", err)
+		}
+		if err := get(t, srv.URL, config.ClientTLS{Enabled: true, CAFile: newPKI(t).caFile}); err == nil {
+			t.Error("request trusting another CA succeeded")
+		}
+	})
+
+	t.Run("missing client key", func(t *testing.T) {
+		_, err := Client(config.ClientTLS{Enabled: true, CertFile: p.clientCert, KeyFile: filepath.Join(t.TempDir(), "missing.key")})
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+}
+
+func TestLoadPool(t *testing.T) {
+	p := newPKI(t)
+
+	notPEM := filepath.Join(t.TempDir(), "not.pem")
+	if err := os.WriteFile(notPEM, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		wantErr bool
+	}{
+		{name: "CA certificate", path: p.caFile},
+		{name: "missing file", path: filepath.Join(t.TempDir(), "missing.crt"), wantErr: true},
+		{name: "no certificates", path: notPEM, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool, err := loadPool(tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && pool == nil {
+				t.Fatal("pool is nil")
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package tracing
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type querySpanKey struct{}
+
+// PgxTracer creates a span per query. Queries outside of a trace are skipped,
+// otherwise the fetcher's background polling would flood the exporter with
+// single-span traces.
+type PgxTracer struct {
+	tracer trace.Tracer
+}
+
+func NewPgxTracer() *PgxTracer {
+	return &PgxTracer{tracer: otel.Tracer("github.com/langowen/exchange/internal/tracing/pgx")}
+}
+
+func (t *PgxTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return ctx
+	}
+
+	ctx, span := t.tracer.Start(ctx, "postgres.query",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemNamePostgreSQL,
+			semconv.DBQueryText(data.SQL),
+		),
+	)
+
+	return context.WithValue(ctx, querySpanKey{}, span)
+}
+
+func (t *PgxTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	span, ok := ctx.Value(querySpanKey{}).(trace.Span)
+	if !ok {
+		return
+	}
+
+	if data.Err != nil {
+		span.RecordError(data.Err)
+		span.SetStatus(codes.Error, data.Err.Error())
+	}
+
+	span.End()
+}